@@ -0,0 +1,44 @@
+package obsgo
+
+import (
+	"context"
+	"encoding/xml"
+
+	"github.com/pkg/errors"
+)
+
+// ServerInfo is the parsed content of the OBS /about route, describing the
+// server the project is on.
+type ServerInfo struct {
+	Title       string `xml:"title"`
+	Description string `xml:"description"`
+	// Version of the OBS server, e.g. "2.10.x"
+	Revision string `xml:"revision"`
+	// Commit of the deployed OBS code
+	Commit         string `xml:"commit"`
+	LastDeployment string `xml:"last_deployment"`
+}
+
+// Returns the information about the OBS server, e.g. to check its version.
+// The information is retrieved once and cached by the project.
+func (proj *Project) About() (ServerInfo, error) {
+	proj.aboutMutex.Lock()
+	defer proj.aboutMutex.Unlock()
+
+	if proj.about != nil {
+		return *proj.about, nil
+	}
+
+	xmlResp, err := proj.readURLPath(context.Background(), "/about", listingHeader())
+	if err != nil {
+		return ServerInfo{}, errors.Wrapf(err, "failed to get OBS server information")
+	}
+
+	var info ServerInfo
+	if err := xml.Unmarshal(xmlResp, &info); err != nil {
+		return ServerInfo{}, errors.Wrapf(err, "failed to parse OBS server information")
+	}
+
+	proj.about = &info
+	return info, nil
+}
@@ -0,0 +1,46 @@
+package obsgo
+
+import "testing"
+
+// Response of the /about route of api.opensuse.org
+const aboutXML = `<about>
+  <title>Open Build Service API</title>
+  <description>API to the Open Build Service</description>
+  <revision>2.10.15</revision>
+  <last_deployment>2023-06-01 08:12:34 +0000</last_deployment>
+  <commit>4f1d2c3b5a6e7f8091a2b3c4d5e6f708192a3b4c</commit>
+</about>`
+
+func TestAbout(t *testing.T) {
+	srv, rec := recordingServer(t, map[string]string{"/about": aboutXML})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	want := ServerInfo{
+		Title:          "Open Build Service API",
+		Description:    "API to the Open Build Service",
+		Revision:       "2.10.15",
+		Commit:         "4f1d2c3b5a6e7f8091a2b3c4d5e6f708192a3b4c",
+		LastDeployment: "2023-06-01 08:12:34 +0000",
+	}
+	// The information is requested once.
+	for i := 0; i < 2; i++ {
+		if info, err := proj.About(); err != nil || info != want {
+			t.Fatalf("got %+v, %v", info, err)
+		}
+	}
+	if got := rec.paths(); len(got) != 1 {
+		t.Fatalf("got requests %v", got)
+	}
+
+	// Failures are not cached.
+	flaky := newFlakyServer(t, map[string]string{"/about": aboutXML})
+	flaky.fail("/about", 1)
+	proj = testProject(flaky.URL)
+	if _, err := proj.About(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if info, err := proj.About(); err != nil || info != want {
+		t.Fatalf("got %+v, %v", info, err)
+	}
+}
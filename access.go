@@ -0,0 +1,99 @@
+package obsgo
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// AccessInfo reports the operations on a project permitted to the project
+// credentials, as probed by CheckAccess.
+type AccessInfo struct {
+	// Listing the build results, as done by FindAllPackages
+	ListBuild bool
+	// Listing the sources, as done by SourceFiles
+	ListSource bool
+	// Reading the build logs. Only probed when a package is found
+	ReadLogs bool
+}
+
+// Probes which operations on the project the project credentials permit, to
+// diagnose partial failures. An operation is reported as not permitted when
+// OBS rejects its request with a 401, 403 or 404 status code, while the
+// other failures, e.g. when the server is unreachable, are returned.
+func (proj *Project) CheckAccess() (AccessInfo, error) {
+	ctx := context.Background()
+	var info AccessInfo
+	var err error
+
+	if info.ListBuild, err = proj.probe(ctx, proj.buildPath("", nil), ""); err != nil {
+		return info, err
+	}
+	if info.ListSource, err = proj.probe(ctx, path.Join("/source", proj.Name), ""); err != nil {
+		return info, err
+	}
+
+	if info.ListBuild {
+		logPath, err := proj.firstPackageLog(ctx)
+		if err != nil {
+			return info, err
+		}
+		if logPath != "" {
+			// Only the first byte, the logs can be big.
+			if info.ReadLogs, err = proj.probe(ctx, proj.buildPath(logPath, nil), "bytes=0-0"); err != nil {
+				return info, err
+			}
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"project":    proj.Name,
+		"listBuild":  info.ListBuild,
+		"listSource": info.ListSource,
+		"readLogs":   info.ReadLogs,
+	}).Debug("OBS project access checked")
+
+	return info, nil
+}
+
+// Requests urlPath, reporting whether the request is permitted.
+func (proj *Project) probe(ctx context.Context, urlPath, byteRange string) (bool, error) {
+	resp, err := proj.doRangeRequest(ctx, proj.httpClient(), urlPath, byteRange)
+	if err == nil {
+		resp.Body.Close()
+		return true, nil
+	}
+
+	if httpErr, ok := errors.Cause(err).(*HTTPError); ok && (httpErr.Is(ErrUnauthorized) || httpErr.Is(ErrNotFound)) {
+		return false, nil
+	}
+	return false, err
+}
+
+// Returns the path of the build log of the first package found in the
+// project, relative to the project, or an empty path when there is none.
+func (proj *Project) firstPackageLog(ctx context.Context) (string, error) {
+	repos, err := proj.listRepos(ctx)
+	if err != nil {
+		return "", err
+	}
+	metas := proj.metaOnce()
+	for _, repo := range repos {
+		archs, err := proj.listArchs(ctx, repo, metas)
+		if err != nil {
+			return "", err
+		}
+		for _, arch := range archs {
+			pkgs, err := proj.listPackages(ctx, repo, arch)
+			if err != nil {
+				return "", err
+			}
+			if len(pkgs) > 0 {
+				return path.Join(repo, arch, pkgs[0], "_log"), nil
+			}
+		}
+	}
+	return "", nil
+}
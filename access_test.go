@@ -0,0 +1,54 @@
+package obsgo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckAccess(t *testing.T) {
+	const logPath = "/build/proj/repo1/x86_64/pkga/_log"
+	routes := basicRoutes()
+	routes[logPath] = "build log"
+	routes["/source/proj"] = dir("pkga")
+
+	for _, tc := range []struct {
+		name   string
+		status map[string]int
+		want   AccessInfo
+	}{
+		{"full", nil, AccessInfo{ListBuild: true, ListSource: true, ReadLogs: true}},
+		{"build", map[string]int{"/source/proj": http.StatusForbidden, logPath: http.StatusForbidden}, AccessInfo{ListBuild: true}},
+		{"no logs", map[string]int{logPath: http.StatusNotFound}, AccessInfo{ListBuild: true, ListSource: true}},
+		// The logs are only probed when the build results can be listed.
+		{"source", map[string]int{"/build/proj": http.StatusUnauthorized}, AccessInfo{ListSource: true}},
+	} {
+		mock := mockHandler(routes)
+		var logRange string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if code := tc.status[r.URL.Path]; code != 0 {
+				w.WriteHeader(code)
+				return
+			}
+			if r.URL.Path == logPath {
+				logRange = r.Header.Get("Range")
+			}
+			mock.ServeHTTP(w, r)
+		}))
+
+		info, err := testProject(srv.URL).CheckAccess()
+		srv.Close()
+		if err != nil || info != tc.want {
+			t.Errorf("%s: got %+v, %v", tc.name, info, err)
+		}
+		if tc.want.ReadLogs && logRange != "bytes=0-0" {
+			t.Errorf("%s: got log range %q", tc.name, logRange)
+		}
+	}
+
+	// The other failures are not reported as denied operations.
+	srv := statusServer(t, http.StatusInternalServerError)
+	if _, err := testProject(srv.URL).CheckAccess(); err == nil {
+		t.Error("expected an error from a failing server")
+	}
+}
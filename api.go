@@ -1,11 +1,19 @@
 package obsgo
 
 import (
+	"context"
 	"encoding/xml"
+	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -17,26 +25,232 @@ type PkgBinary struct {
 	Filename string `xml:"filename,attr"`
 	Size     string `xml:"size,attr"`
 	Mtime    string `xml:"mtime,attr"`
+	// Name of the package that built the binary, only reported by some
+	// listings, e.g. the repository level ones
+	Package string `xml:"package,attr"`
+	// Repository and architecture of the binary, only set by AllBinaries
+	Repo string `xml:"-"`
+	Arch string `xml:"-"`
+	// Size in KiB, rounded up, and MD5 checksum of the RPM header, only set
+	// when listed with the binaryversions view, that has no Size and Mtime.
+	SizeK  string `xml:"sizek,attr"`
+	HdrMD5 string `xml:"hdrmd5,attr"`
+	// Direct download link of the binary, e.g. on a CDN, only reported by
+	// some OBS versions. When set, the binary is downloaded from it without
+	// credentials, rather than through the API.
+	DownloadURL string `xml:"downloadurl,attr"`
+}
+
+// Entry of the binaryversions view of a package binaries
+type binaryVersion struct {
+	Name   string `xml:"name,attr"`
+	SizeK  string `xml:"sizek,attr"`
+	HdrMD5 string `xml:"hdrmd5,attr"`
+}
+
+type binaryVersionList struct {
+	XMLName xml.Name        `xml:"binaryversionlist"`
+	Bins    []binaryVersion `xml:"binary"`
+}
+
+// SizeBytes returns the size of the binary file in bytes. For the files listed
+// with the binaryversions view, the size is only known rounded up to KiB.
+func (b PkgBinary) SizeBytes() (int64, error) {
+	if b.Size == "" && b.SizeK != "" {
+		sizek, err := strconv.ParseInt(b.SizeK, 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "could not parse size of file %s", b.Filename)
+		}
+		return sizek * 1024, nil
+	}
+
+	size, err := strconv.ParseInt(b.Size, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not parse size of file %s", b.Filename)
+	}
+	return size, nil
+}
+
+// MtimeUnix returns the modification time of the binary file, as seconds since
+// the Unix epoch.
+func (b PkgBinary) MtimeUnix() (int64, error) {
+	if b.Mtime == "" {
+		return 0, errors.Errorf("no mtime for file %s", b.Filename)
+	}
+	mtime, err := strconv.ParseInt(b.Mtime, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not parse mtime of file %s", b.Filename)
+	}
+	return mtime, nil
+}
+
+// Entry of a binary list. Besides the attributes, the entries of newer OBS
+// versions may have the file name in a name attribute, and the other fields as
+// child elements.
+type xmlBinary struct {
+	Filename    string `xml:"filename,attr"`
+	Name        string `xml:"name,attr"`
+	Size        string `xml:"size,attr"`
+	Mtime       string `xml:"mtime,attr"`
+	Package     string `xml:"package,attr"`
+	DownloadURL string `xml:"downloadurl,attr"`
+
+	SizeElem        string `xml:"size"`
+	MtimeElem       string `xml:"mtime"`
+	DownloadURLElem string `xml:"downloadurl"`
 }
 
 type binaryList struct {
 	XMLName xml.Name    `xml:"binarylist"`
-	Bins    []PkgBinary `xml:"binary"`
+	Bins    []xmlBinary `xml:"binary"`
 }
 
 type xmlDirList struct {
 	XMLName xml.Name `xml:"directory"`
-	Dirs    []struct {
+	DirInfo
+	Dirs []struct {
 		Name string `xml:"name,attr"`
 	} `xml:"entry"`
 }
 
+// DirInfo holds the attributes of an OBS directory listing, such as the
+// revision of a source package. OBS only sets them on some listings, the
+// others are empty. Two DirInfo can be compared with == to detect changes.
+type DirInfo struct {
+	Rev    string `xml:"rev,attr"`
+	Vrev   string `xml:"vrev,attr"`
+	Srcmd5 string `xml:"srcmd5,attr"`
+}
+
 const (
 	apiBaseURL = "https://api.opensuse.org"
+	// Default path prefix of the build results API routes
+	defaultPathPrefix = "/build"
+	// Prefix of the anonymous API routes used by public projects
+	publicPathPrefix = "/public"
+	// Default size of the buffer used to copy a downloaded binary. Copying a
+	// 64 MiB file from a local server to disk is about 8% faster than with
+	// the 32 KiB used by io.Copy, and slower again with 1 MiB, as measured by
+	// BenchmarkDownloadBinary.
+	defaultCopyBufferSize = 256 * 1024
 )
 
-func (proj *Project) obsRequest(resource string) (io.ReadCloser, error) {
-	url := apiBaseURL + path.Join("/build", proj.Name, resource)
+func (proj *Project) obsRequest(ctx context.Context, resource string) (io.ReadCloser, error) {
+	return proj.obsRequestQuery(ctx, resource, nil)
+}
+
+func (proj *Project) obsRequestQuery(ctx context.Context, resource string, query url.Values) (io.ReadCloser, error) {
+	return proj.apiRequest(ctx, proj.buildPath(resource, query))
+}
+
+// Returns the URL path of resource under the build results API routes.
+func (proj *Project) buildPath(resource string, query url.Values) string {
+	urlPath := path.Join(proj.pathPrefix(), proj.Name, resource)
+	if len(query) > 0 {
+		urlPath += "?" + query.Encode()
+	}
+	return urlPath
+}
+
+func (proj *Project) baseURL() string {
+	if proj.BaseURL == "" {
+		return apiBaseURL
+	}
+	return strings.TrimSuffix(proj.BaseURL, "/")
+}
+
+// Returns the full URL of the API route at urlPath.
+func (proj *Project) requestURL(urlPath string) string {
+	if proj.Public {
+		urlPath = publicPathPrefix + urlPath
+	}
+	return proj.baseURL() + urlPath
+}
+
+func (proj *Project) pathPrefix() string {
+	if proj.PathPrefix == "" {
+		return defaultPathPrefix
+	}
+	return path.Join("/", proj.PathPrefix)
+}
+
+func (proj *Project) publishedRequest(ctx context.Context, resource string) (io.ReadCloser, error) {
+	return proj.apiRequest(ctx, path.Join("/published", proj.Name, resource))
+}
+
+func (proj *Project) sourceRequest(ctx context.Context, resource string) (io.ReadCloser, error) {
+	return proj.apiRequest(ctx, path.Join("/source", proj.Name, resource))
+}
+
+func (proj *Project) apiRequest(ctx context.Context, urlPath string) (io.ReadCloser, error) {
+	return proj.apiHeaderRequest(ctx, urlPath, nil)
+}
+
+func (proj *Project) apiHeaderRequest(ctx context.Context, urlPath string, header http.Header) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := proj.retry(ctx, proj.MaxRetries, func() error {
+		var err error
+		body, err = proj.doRequest(ctx, urlPath, header)
+		return err
+	})
+	return body, err
+}
+
+// Returns the header of the listing requests. The listings parsers expect
+// XML, so it is asked for to gateways that negotiate the content type. It is
+// not sent when downloading files.
+func listingHeader() http.Header {
+	return http.Header{"Accept": []string{"application/xml"}}
+}
+
+func (proj *Project) doRequest(ctx context.Context, urlPath string, header http.Header) (io.ReadCloser, error) {
+	resp, err := proj.doHeaderRequest(ctx, proj.httpClient(), urlPath, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// The API never returns HTML, but the maintenance pages do.
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		resp.Body.Close()
+		return nil, errors.Wrapf(ErrMaintenance, "%s", urlPath)
+	}
+	return resp.Body, nil
+}
+
+// Reports whether code is a successful response status code: any 2xx code,
+// and 304 Not Modified for the conditional requests.
+func isSuccess(code int, conditional bool) bool {
+	if code == http.StatusNotModified {
+		return conditional
+	}
+	return code >= 200 && code < 300
+}
+
+// Issues a request for urlPath with client. When byteRange is not empty, it is
+// sent as the Range header, and a 206 partial content status code is accepted
+// as well.
+func (proj *Project) doRangeRequest(ctx context.Context, client *http.Client, urlPath string, byteRange string) (*http.Response, error) {
+	header := make(http.Header)
+	if byteRange != "" {
+		header.Set("Range", byteRange)
+	}
+	return proj.doHeaderRequest(ctx, client, urlPath, header)
+}
+
+// Sends a GET request for urlPath with the given header, that the project
+// Headers take precedence over.
+func (proj *Project) doHeaderRequest(ctx context.Context, client *http.Client, urlPath string, header http.Header) (*http.Response, error) {
+	return proj.doURLRequest(ctx, client, proj.requestURL(urlPath), urlPath, header, false)
+}
+
+// Sends a GET request for url like doHeaderRequest, reporting it to the
+// metrics as resource. When thirdParty is set, e.g. for the direct download
+// links, neither the project credentials nor its Headers are sent.
+func (proj *Project) doURLRequest(ctx context.Context, client *http.Client, url, resource string, header http.Header, thirdParty bool) (*http.Response, error) {
+	if proj.isClosed() {
+		return nil, ErrClosed
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"url": url,
 	}).Debug("obsRequest")
@@ -45,36 +259,108 @@ func (proj *Project) obsRequest(resource string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(proj.User, proj.Password)
-	client := &http.Client{}
+	req = req.WithContext(ctx)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	// The custom headers may hold credentials too, such as API gateway
+	// keys, so they are not sent to third parties either.
+	if !thirdParty {
+		for name, values := range proj.Headers {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+		if proj.Public {
+			req.Header.Del("Authorization")
+		} else if req.Header.Get("Authorization") == "" {
+			req.SetBasicAuth(proj.User, proj.Password)
+		}
+	}
+	start := time.Now()
 	resp, err := client.Do(req)
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+	}
+	proj.metrics().ObserveRequest(resource, status, time.Since(start))
 	if err != nil {
+		proj.logRequest(req.Method, url, 0, 0)
 		return nil, err
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, errors.Errorf("obsRequest unexpected HTTP response status code: %d", resp.StatusCode)
+	conditional := req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+	if !isSuccess(resp.StatusCode, conditional) {
+		proj.logRequest(req.Method, url, resp.StatusCode, 0)
+		resp.Body.Close()
+		return nil, &HTTPError{
+			StatusCode: resp.StatusCode,
+			URL:        url,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
 	logrus.Debugf("obsRequest got HTTP response")
 
-	return resp.Body, nil
+	if proj.RequestLog != nil {
+		resp.Body = &loggedBody{
+			ReadCloser: resp.Body,
+			proj:       proj,
+			method:     req.Method,
+			url:        url,
+			status:     resp.StatusCode,
+		}
+	}
+
+	return resp, nil
 }
 
-func (proj *Project) listDirectories(path string) ([]string, error) {
-	resp, err := proj.obsRequest(path)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Close()
+// Reads the whole response body of the build results resource at path, as
+// done by readURLPath.
+func (proj *Project) readResource(ctx context.Context, path string) ([]byte, error) {
+	return proj.readResourceQuery(ctx, path, nil)
+}
 
-	xmlResp, err := ioutil.ReadAll(resp)
+func (proj *Project) readResourceQuery(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	return proj.readURLPath(ctx, proj.buildPath(path, query), listingHeader())
+}
+
+// Reads the whole response body of the API resource at urlPath, requested
+// with header. The request is retried up to MaxRetries times also when reading
+// the body fails, discarding the data read by the failed attempt, which is
+// then returned as a BodyReadError.
+func (proj *Project) readURLPath(ctx context.Context, urlPath string, header http.Header) ([]byte, error) {
+	var data []byte
+	err := proj.retry(ctx, proj.MaxRetries, func() error {
+		resp, err := proj.doRequest(ctx, urlPath, header)
+		if err != nil {
+			return err
+		}
+		defer resp.Close()
+
+		data, err = ioutil.ReadAll(resp)
+		if err != nil {
+			return &BodyReadError{Path: urlPath, Err: err}
+		}
+		return nil
+	})
+	return data, err
+}
+
+func (proj *Project) readDirList(ctx context.Context, path string) (*xmlDirList, error) {
+	xmlResp, err := proj.readResource(ctx, path)
 	if err != nil {
 		return nil, err
 	}
 
 	var list xmlDirList
 	err = xml.Unmarshal(xmlResp, &list)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse directory list of %s", path)
+	}
+	return &list, nil
+}
+
+func (proj *Project) listDirectories(ctx context.Context, path string) ([]string, error) {
+	list, err := proj.readDirList(ctx, path)
 	if err != nil {
 		return nil, err
 	}
@@ -86,39 +372,207 @@ func (proj *Project) listDirectories(path string) ([]string, error) {
 	return dirs, nil
 }
 
-func (proj *Project) listBinaries(path string) ([]PkgBinary, error) {
-	var binaries []PkgBinary
-
-	resp, err := proj.obsRequest(path)
-	if err != nil {
-		return binaries, err
+func (proj *Project) listBinaries(ctx context.Context, path string) ([]PkgBinary, error) {
+	if proj.BinaryVersions {
+		return proj.listBinaryVersions(ctx, path)
 	}
-	defer resp.Close()
 
-	xmlResp, err := ioutil.ReadAll(resp)
+	xmlResp, err := proj.readResource(ctx, path)
 	if err != nil {
-		return binaries, err
+		return nil, err
 	}
 
 	var bList binaryList
 	if err := xml.Unmarshal(xmlResp, &bList); err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "Failed to parse binary list of %s", path)
 	}
 
-	return bList.Bins, nil
+	binaries := make([]PkgBinary, 0, len(bList.Bins))
+	for _, b := range bList.Bins {
+		bin := PkgBinary{
+			Filename:    firstNonEmpty(b.Filename, b.Name),
+			Size:        firstNonEmpty(b.Size, b.SizeElem),
+			Mtime:       firstNonEmpty(b.Mtime, b.MtimeElem),
+			Package:     strings.TrimSpace(b.Package),
+			DownloadURL: firstNonEmpty(b.DownloadURL, b.DownloadURLElem),
+		}
+		if bin.Filename == "" {
+			logrus.WithFields(logrus.Fields{
+				"path": path,
+			}).Warn("Skipping OBS binary list entry without file name")
+			continue
+		}
+		binaries = append(binaries, bin)
+	}
+	return binaries, nil
+}
+
+// Returns the first of values not empty, ignoring the surrounding spaces.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
 }
 
-func (proj *Project) downloadBinary(path string, dest io.Writer) error {
-	resp, err := proj.obsRequest(path)
+func (proj *Project) listBinaryVersions(ctx context.Context, path string) ([]PkgBinary, error) {
+	xmlResp, err := proj.readResourceQuery(ctx, path, url.Values{"view": []string{"binaryversions"}})
 	if err != nil {
+		return nil, err
+	}
+
+	var vList binaryVersionList
+	if err := xml.Unmarshal(xmlResp, &vList); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse binary versions of %s", path)
+	}
+
+	binaries := make([]PkgBinary, 0, len(vList.Bins))
+	for _, v := range vList.Bins {
+		binaries = append(binaries, PkgBinary{
+			Filename: v.Name,
+			SizeK:    v.SizeK,
+			HdrMD5:   v.HdrMD5,
+		})
+	}
+	return binaries, nil
+}
+
+// Buffers used to copy the downloaded binaries
+var copyBuffers sync.Pool
+
+// Returns a buffer of CopyBufferSize bytes to copy a downloaded binary, to be
+// given back to copyBuffers once done.
+func (proj *Project) getCopyBuffer() *[]byte {
+	size := proj.CopyBufferSize
+	if size <= 0 {
+		size = defaultCopyBufferSize
+	}
+
+	if buf, ok := copyBuffers.Get().(*[]byte); ok && len(*buf) == size {
+		return buf
+	}
+	buf := make([]byte, size)
+	return &buf
+}
+
+// Requests the binary file at path, or byteRange of it, from its directURL
+// when not empty, e.g. a CDN link reported by the binary list, or else from
+// the API. Direct links are public, so no credentials are sent to them. When
+// the direct request fails, the file is requested from the API.
+func (proj *Project) doBinaryRequest(ctx context.Context, path, directURL, byteRange string) (*http.Response, error) {
+	if directURL != "" {
+		header := make(http.Header)
+		if byteRange != "" {
+			header.Set("Range", byteRange)
+		}
+		resp, err := proj.doURLRequest(ctx, proj.downloadClient(), directURL, directURL, header, true)
+		if err == nil || ctx.Err() != nil || errors.Cause(err) == ErrClosed {
+			return resp, err
+		}
+		logrus.WithFields(logrus.Fields{
+			"url":   directURL,
+			"error": err,
+		}).Warn("Failed to download OBS binary from its direct link, using the API")
+	}
+	return proj.doRangeRequest(ctx, proj.downloadClient(), proj.buildPath(path, nil), byteRange)
+}
+
+// Downloads the binary file at path to dest, from directURL when not empty,
+// as done by doBinaryRequest. When h is not nil, the downloaded data is also
+// written to h, to compute its checksum without reading dest.
+func (proj *Project) downloadBinary(ctx context.Context, path, directURL string, dest io.Writer, h hash.Hash) (int64, error) {
+	return proj.downloadBinaryFrom(ctx, path, directURL, dest, h, 0)
+}
+
+// Downloads the binary file at path to dest like downloadBinary, skipping its
+// first offset bytes, which have already been downloaded. Returns the number
+// of bytes written to dest.
+func (proj *Project) downloadBinaryFrom(ctx context.Context, path, directURL string, dest io.Writer, h hash.Hash, offset int64) (int64, error) {
+	if h != nil {
+		dest = io.MultiWriter(dest, h)
+	}
+
+	var written int64
+	start := time.Now()
+	defer func() {
+		proj.metrics().ObserveDownload(written, time.Since(start))
+	}()
+
+	err := proj.retry(ctx, proj.DownloadMaxRetries, func() error {
+		// After a failure mid-copy, e.g. a connection reset, the download
+		// resumes from the bytes already written.
+		resume := ""
+		if offset+written > 0 {
+			resume = fmt.Sprintf("bytes=%d-", offset+written)
+		}
+		resp, err := proj.doBinaryRequest(ctx, path, directURL, resume)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resume != "" && written == 0 && resp.StatusCode != http.StatusPartialContent {
+			// Range not supported, skip the bytes of the previous download.
+			if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+				return err
+			}
+		} else if resume != "" && (resp.StatusCode != http.StatusPartialContent ||
+			!strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset+written))) {
+			// The data already written to dest can not be discarded.
+			return noRetry{errors.Errorf("could not resume download of %s at byte %d", path, offset+written)}
+		}
+
+		buf := proj.getCopyBuffer()
+		defer copyBuffers.Put(buf)
+
+		// Hide io.ReaderFrom implementations of dest, that would not use buf.
+		n, err := io.CopyBuffer(struct{ io.Writer }{dest}, resp.Body, *buf)
+		written += n
 		return err
+	})
+	return written, err
+}
+
+// Data structure used for XML unmarshaling of the OBS API responses to retrieve
+// the list of files inside a source package.
+type xmlSourceList struct {
+	XMLName xml.Name `xml:"directory"`
+	DirInfo
+	Files []struct {
+		Name  string `xml:"name,attr"`
+		Size  string `xml:"size,attr"`
+		Mtime string `xml:"mtime,attr"`
+	} `xml:"entry"`
+}
+
+func (proj *Project) readSourceList(ctx context.Context, pkg string) (*xmlSourceList, error) {
+	xmlResp, err := proj.readURLPath(ctx, path.Join("/source", proj.Name, pkg), listingHeader())
+	if err != nil {
+		return nil, err
+	}
+
+	var list xmlSourceList
+	if err := xml.Unmarshal(xmlResp, &list); err != nil {
+		return nil, err
 	}
-	defer resp.Close()
+	return &list, nil
+}
 
-	_, err = io.Copy(dest, resp)
+func (proj *Project) listSourceFiles(ctx context.Context, pkg string) ([]PkgBinary, error) {
+	list, err := proj.readSourceList(ctx, pkg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	files := make([]PkgBinary, 0, len(list.Files))
+	for _, f := range list.Files {
+		files = append(files, PkgBinary{
+			Filename: f.Name,
+			Size:     f.Size,
+			Mtime:    f.Mtime,
+		})
+	}
+	return files, nil
 }
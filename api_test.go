@@ -0,0 +1,596 @@
+package obsgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Records the paths, and the headers by path, of the requests received by a
+// recordingServer.
+type recorder struct {
+	mutex    sync.Mutex
+	received []string
+	header   map[string]http.Header
+}
+
+// Returns the paths of the requests received, in order.
+func (rec *recorder) paths() []string {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	return append([]string(nil), rec.received...)
+}
+
+// Returns the headers of the last request received for path, or nil.
+func (rec *recorder) headers(path string) http.Header {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	return rec.header[path]
+}
+
+// Returns a server answering like mockServer, and the recorder of the
+// requests it receives.
+func recordingServer(t *testing.T, routes map[string]string) (*httptest.Server, *recorder) {
+	rec := &recorder{header: make(map[string]http.Header)}
+	mock := mockHandler(routes)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec.mutex.Lock()
+		rec.received = append(rec.received, r.URL.Path)
+		rec.header[r.URL.Path] = r.Header.Clone()
+		rec.mutex.Unlock()
+		mock.ServeHTTP(w, r)
+	}))
+	return srv, rec
+}
+
+// Returns a server answering like mockServer, that closes the connection
+// halfway through the body of the first drops[path] responses to path.
+func droppingServer(t *testing.T, routes map[string]string, drops map[string]int) *httptest.Server {
+	var mutex sync.Mutex
+	mock := mockHandler(routes)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		drop := drops[r.URL.Path] > 0
+		if drop {
+			drops[r.URL.Path]--
+		}
+		mutex.Unlock()
+		if !drop {
+			mock.ServeHTTP(w, r)
+			return
+		}
+
+		body := routes[r.URL.Path]
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body[:len(body)/2]))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPathPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		prefix, path string
+	}{
+		{"", "/build/proj"},
+		{"/obs/build", "/obs/build/proj"},
+		{"api/results/", "/api/results/proj"},
+	} {
+		srv, rec := recordingServer(t, map[string]string{
+			tc.path: dir("repo1"),
+		})
+		proj := testProject(srv.URL)
+		proj.PathPrefix = tc.prefix
+
+		repos, err := proj.ListRepos()
+		if err != nil || len(repos) != 1 {
+			t.Errorf("prefix %q: got %v, %v", tc.prefix, repos, err)
+		}
+		if got := rec.paths(); len(got) != 1 || got[0] != tc.path {
+			t.Errorf("prefix %q: requested %v", tc.prefix, got)
+		}
+		srv.Close()
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	if got := (&Project{}).baseURL(); got != apiBaseURL {
+		t.Errorf("default base URL %q", got)
+	}
+
+	var user, password string
+	mock := mockHandler(map[string]string{"/build/proj": dir("repo1")})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ = r.BasicAuth()
+		mock.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// A plain http server is reached without TLS, with the trailing slash
+	// of the base URL ignored.
+	proj := testProject("http://" + srv.Listener.Addr().String() + "/")
+	proj.User, proj.Password = "user", "secret"
+	repos, err := proj.ListRepos()
+	if err != nil || len(repos) != 1 || repos[0] != "repo1" {
+		t.Fatalf("got %v, %v", repos, err)
+	}
+	if user != "user" || password != "secret" {
+		t.Errorf("got credentials %q, %q", user, password)
+	}
+}
+
+func TestMtimeUnix(t *testing.T) {
+	for _, tc := range []struct {
+		mtime string
+		want  int64
+		ok    bool
+	}{
+		{"1557993534", 1557993534, true},
+		{"0", 0, true},
+		{"", 0, false},
+		{"yesterday", 0, false},
+		{"15579.93", 0, false},
+	} {
+		got, err := PkgBinary{Filename: "f", Mtime: tc.mtime}.MtimeUnix()
+		if got != tc.want || (err == nil) != tc.ok {
+			t.Errorf("mtime %q: got %d, %v", tc.mtime, got, err)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	srv, rec := recordingServer(t, basicRoutes())
+	defer srv.Close()
+	const file = "/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm"
+
+	proj := testProject(srv.URL)
+	proj.User, proj.Password = "user", "secret"
+	proj.Headers = http.Header{"X-Api-Key": {"key"}}
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The custom headers are sent with the credentials, on listings and
+	// downloads alike.
+	for _, path := range []string{"/build/proj/repo1/x86_64/pkga", file} {
+		h := rec.headers(path)
+		req := http.Request{Header: h}
+		user, password, _ := req.BasicAuth()
+		if h.Get("X-Api-Key") != "key" || user != "user" || password != "secret" {
+			t.Errorf("%s: got headers %v", path, h)
+		}
+	}
+
+	// An Authorization header replaces the credentials.
+	proj.Headers = http.Header{"authorization": {"Bearer token"}}
+	if _, err := proj.ListRepos(); err != nil {
+		t.Fatal(err)
+	}
+	if h := rec.headers("/build/proj"); h.Get("Authorization") != "Bearer token" {
+		t.Errorf("got headers %v", h)
+	}
+}
+
+func TestReadResourceDroppedBody(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	want, err := testProject(srv.URL).FindAllPackages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both a directory and a binary list are cut short once.
+	srv = droppingServer(t, basicRoutes(), map[string]int{
+		"/build/proj/repo1/x86_64":      1,
+		"/build/proj/repo1/x86_64/pkga": 1,
+	})
+	proj := testProject(srv.URL)
+	if _, err := proj.FindAllPackages(); err == nil {
+		t.Fatal("expected an error without retries")
+	}
+
+	srv = droppingServer(t, basicRoutes(), map[string]int{
+		"/build/proj/repo1/x86_64":      1,
+		"/build/proj/repo1/x86_64/pkga": 1,
+	})
+	proj = testProject(srv.URL)
+	proj.MaxRetries = 1
+	got, err := proj.FindAllPackages()
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+}
+
+func TestCopyBufferSize(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	for _, size := range []int{0, 2, 1 << 20} {
+		proj := testProject(srv.URL)
+		proj.CopyBufferSize = size
+		var buf bytes.Buffer
+		n, err := proj.downloadBinary(context.Background(), "repo1/x86_64/pkga/a-1.0-1.x86_64.rpm", "", &buf, nil)
+		if err != nil || n != 5 || buf.String() != "AAAAA" {
+			t.Errorf("size %d: got %q, %d bytes, %v", size, buf.String(), n, err)
+		}
+	}
+}
+
+// Compares the throughput of downloading a 64 MiB binary from a local server
+// to disk with a few copy buffer sizes.
+func BenchmarkDownloadBinary(b *testing.B) {
+	data := make([]byte, 64<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+	localFile := filepath.Join(b.TempDir(), "file")
+
+	for _, size := range []int{32 << 10, 128 << 10, 256 << 10, 1 << 20} {
+		b.Run(strconv.Itoa(size>>10)+"KiB", func(b *testing.B) {
+			proj := testProject(srv.URL)
+			proj.CopyBufferSize = size
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				file, err := os.Create(localFile)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, err = proj.downloadBinary(context.Background(), "file", "", file, nil)
+				if closeErr := file.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPublic(t *testing.T) {
+	routes := make(map[string]string)
+	for p, body := range basicRoutes() {
+		routes["/public"+p] = body
+	}
+	srv, rec := recordingServer(t, routes)
+	defer srv.Close()
+	const file = "/public/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm"
+
+	proj := testProject(srv.URL)
+	proj.User, proj.Password = "user", "secret"
+	proj.Public = true
+	proj.Headers = http.Header{"Authorization": {"Bearer token"}}
+
+	pkgs, err := proj.FindAllPackages()
+	if err != nil || len(pkgs) != 2 {
+		t.Fatalf("got %+v, %v", pkgs, err)
+	}
+	if _, _, err := proj.DownloadPackageFiles(pkgs[0], t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the credentials nor an Authorization header are sent.
+	for _, path := range []string{"/public/build/proj", "/public/build/proj/repo1/x86_64/pkga", file} {
+		h := rec.headers(path)
+		if h == nil || h.Get("Authorization") != "" {
+			t.Errorf("%s: got headers %v", path, h)
+		}
+	}
+}
+
+func TestDownloadBinaryResume(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, tc := range []struct {
+		name     string
+		ranges   bool
+		retries  int
+		requests int
+		ok       bool
+	}{
+		{"resumed", true, 1, 2, true},
+		// The resumed request counts against the retry budget.
+		{"no retries", true, 0, 1, false},
+		// The data already written can not be downloaded again.
+		{"no ranges", false, 1, 2, false},
+	} {
+		srv, received := rangeServer(t, data, tc.ranges, true)
+		proj := testProject(srv.URL)
+		proj.DownloadMaxRetries = tc.retries
+
+		var buf bytes.Buffer
+		n, err := proj.downloadBinary(context.Background(), "file", "", &buf, nil)
+		if tc.ok && (err != nil || n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data)) {
+			t.Errorf("%s: got %d bytes, %v", tc.name, n, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		// The part received before the reset is not requested again.
+		got := received()
+		if len(got) != tc.requests || got[0] != "" || (len(got) > 1 && (!strings.HasPrefix(got[1], "bytes=") || got[1] == "bytes=0-")) {
+			t.Errorf("%s: got requests for ranges %q", tc.name, got)
+		}
+	}
+}
+
+func TestIsSuccess(t *testing.T) {
+	for _, tc := range []struct {
+		code        int
+		conditional bool
+		want        bool
+	}{
+		{http.StatusOK, false, true},
+		{http.StatusNoContent, false, true},
+		{http.StatusPartialContent, false, true},
+		{http.StatusNotModified, true, true},
+		{http.StatusNotModified, false, false},
+		{http.StatusFound, false, false},
+		{http.StatusNotFound, true, false},
+	} {
+		if got := isSuccess(tc.code, tc.conditional); got != tc.want {
+			t.Errorf("%d, conditional %v: got %v", tc.code, tc.conditional, got)
+		}
+	}
+
+	// The status codes are accepted on actual requests.
+	for _, tc := range []struct {
+		code   int
+		header http.Header
+		ok     bool
+	}{
+		{http.StatusOK, nil, true},
+		{http.StatusPartialContent, http.Header{"Range": {"bytes=1-"}}, true},
+		{http.StatusNotModified, http.Header{"If-None-Match": {`"etag"`}}, true},
+		{http.StatusNotModified, nil, false},
+	} {
+		srv := statusServer(t, tc.code)
+		proj := testProject(srv.URL)
+		resp, err := proj.doHeaderRequest(context.Background(), proj.httpClient(), "/build/proj", tc.header)
+		if (err == nil) != tc.ok {
+			t.Errorf("%d: got %v", tc.code, err)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+func TestAccept(t *testing.T) {
+	routes := basicRoutes()
+	routes["/source/proj/pkga"] = `<directory name="pkga"><entry name="pkga.spec" size="4" mtime="10"/></directory>`
+	routes["/source/proj/pkga/pkga.spec"] = "spec"
+	routes["/source/proj/_pubkey"] = "key"
+	routes["/build/proj/repo1/x86_64/pkga?view=cpio"] = string(newcArchive(cpioEntry{"a.rpm", 0100644, "hello"}))
+
+	// A gateway answering the build results listings with JSON, unless XML
+	// is asked for.
+	mock := mockHandler(routes)
+	var mutex sync.Mutex
+	var accept []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		accept = append(accept, r.Header.Get("Accept"))
+		mutex.Unlock()
+		listing := strings.HasPrefix(r.URL.Path, "/build/") && !strings.HasSuffix(r.URL.Path, ".rpm") && r.URL.RawQuery == ""
+		if listing && r.Header.Get("Accept") != "application/xml" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"entries": []}`))
+			return
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	// Returns the Accept headers of the requests sent by fn.
+	accepted := func(fn func() error) []string {
+		mutex.Lock()
+		accept = nil
+		mutex.Unlock()
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		return accept
+	}
+
+	// The listings ask for XML, and are parsed.
+	got := accepted(func() error {
+		pkgs, err := proj.FindAllPackages()
+		if err == nil && len(pkgs) != 2 {
+			err = fmt.Errorf("got %+v", pkgs)
+		}
+		return err
+	})
+	for _, a := range got {
+		if a != "application/xml" {
+			t.Errorf("listings: got Accept headers %q", got)
+			break
+		}
+	}
+
+	// The downloads do not.
+	for _, tc := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"binaries", func() error {
+			pkg := PackageInfo{Path: "repo1/x86_64/pkga", Files: []PkgBinary{{Filename: "a-1.0-1.x86_64.rpm", Size: "5"}}}
+			_, _, err := proj.DownloadPackageFiles(pkg, t.TempDir())
+			return err
+		}},
+		{"cpio", func() error {
+			_, err := proj.DownloadCPIO("repo1", "x86_64", "pkga", t.TempDir())
+			return err
+		}},
+		{"sources", func() error {
+			_, err := proj.DownloadSourceFiles("pkga", []PkgBinary{{Filename: "pkga.spec", Size: "4"}}, t.TempDir())
+			return err
+		}},
+		{"public key", func() error {
+			_, err := proj.PublicKey()
+			return err
+		}},
+	} {
+		if got := accepted(tc.fn); !reflect.DeepEqual(got, []string{""}) {
+			t.Errorf("%s: got Accept headers %q", tc.name, got)
+		}
+	}
+}
+
+// Binary versions of a package, as listed by OBS
+const binaryVersionsXML = `<binaryversionlist>
+  <binary name="a-1.0-1.x86_64.rpm" sizek="1" hdrmd5="0fa8b7c5d1e2f3a4b5c6d7e8f9a0b1c2" leadsigmd5="1b2c3d"/>
+  <binary name="a-debuginfo-1.0-1.x86_64.rpm" sizek="1" hdrmd5="9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b" leadsigmd5="4e5f6a"/>
+  <binary name="_statistics" sizek="1"/>
+</binaryversionlist>`
+
+func TestBinaryVersions(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga?view=binaryversions"] = binaryVersionsXML
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		versions bool
+		want     []PkgBinary
+	}{
+		{false, []PkgBinary{
+			{Filename: "a-1.0-1.x86_64.rpm", Size: "5", Mtime: "100"},
+			{Filename: "a-debuginfo-1.0-1.x86_64.rpm", Size: "3", Mtime: "100"},
+		}},
+		{true, []PkgBinary{
+			{Filename: "a-1.0-1.x86_64.rpm", SizeK: "1", HdrMD5: "0fa8b7c5d1e2f3a4b5c6d7e8f9a0b1c2"},
+			{Filename: "a-debuginfo-1.0-1.x86_64.rpm", SizeK: "1", HdrMD5: "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b"},
+		}},
+	} {
+		proj := testProject(srv.URL)
+		proj.BinaryVersions = tc.versions
+		pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+		if err != nil || !reflect.DeepEqual(pkg.Files, tc.want) {
+			t.Fatalf("versions %v: got %+v, %v", tc.versions, pkg.Files, err)
+		}
+
+		// The files are downloaded, then skipped as already present.
+		root := t.TempDir()
+		for _, want := range []int64{8, 0} {
+			if _, n, err := proj.DownloadPackageFiles(pkg, root); err != nil || n != want {
+				t.Fatalf("versions %v: got %d bytes, %v", tc.versions, n, err)
+			}
+		}
+	}
+
+	// The size rounded up to KiB.
+	if size, err := (PkgBinary{SizeK: "3"}).SizeBytes(); err != nil || size != 3072 {
+		t.Fatalf("got %d, %v", size, err)
+	}
+}
+
+// Binary list of a repository, as returned by the _repository view, with the
+// package that built each binary
+const repositoryBinaryList = `<binarylist>
+  <binary filename="a-1.0-1.x86_64.rpm" size="5" mtime="100" package="pkga"/>
+  <binary filename="a-debuginfo-1.0-1.x86_64.rpm" size="3" mtime="100" package="pkga"/>
+  <binary filename="b-1.0-1.noarch.rpm" size="0" mtime="200" package="pkgb:flavor"/>
+  <binary filename="c-1.0-1.noarch.rpm" size="1" mtime="300"/>
+</binarylist>`
+
+func TestListBinariesPackage(t *testing.T) {
+	srv := mockServer(t, map[string]string{"/build/proj/repo1/x86_64/_repository": repositoryBinaryList})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	bins, err := proj.listBinaries(context.Background(), "repo1/x86_64/_repository")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, b := range bins {
+		got = append(got, b.Package)
+	}
+	if want := []string{"pkga", "pkga", "pkgb:flavor", ""}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got packages %q, want %q", got, want)
+	}
+}
+
+// Binary list of a package as returned by a newer OBS, with extra attributes
+// and some of the fields as elements
+const modernBinaryList = `<?xml version="1.0" encoding="UTF-8"?>
+<binarylist package="pkga" schema="2">
+  <binary filename="a-1.0-1.x86_64.rpm" size="5" mtime="100" downloadurl="https://cdn.example.org/a-1.0-1.x86_64.rpm" checksum="sha256:00" />
+  <binary name="a-devel-1.0-1.x86_64.rpm">
+    <size> 7 </size>
+    <mtime>200</mtime>
+    <downloadurl>https://cdn.example.org/a-devel-1.0-1.x86_64.rpm</downloadurl>
+  </binary>
+  <binary size="1"/>
+  <binary filename="_statistics" size="600" mtime="100"/>
+</binarylist>`
+
+func TestListBinariesModern(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga"] = modernBinaryList
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	got, err := proj.listBinaries(context.Background(), "repo1/x86_64/pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The binaries without a name are dropped.
+	want := []PkgBinary{
+		{Filename: "a-1.0-1.x86_64.rpm", Size: "5", Mtime: "100", DownloadURL: "https://cdn.example.org/a-1.0-1.x86_64.rpm"},
+		{Filename: "a-devel-1.0-1.x86_64.rpm", Size: "7", Mtime: "200", DownloadURL: "https://cdn.example.org/a-devel-1.0-1.x86_64.rpm"},
+		{Filename: "_statistics", Size: "600", Mtime: "100"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestDownloadBinaryDirectURL(t *testing.T) {
+	api, apiRec := recordingServer(t, basicRoutes())
+	defer api.Close()
+	cdn, cdnRec := recordingServer(t, map[string]string{"/a.rpm": "CDNCD"})
+	defer cdn.Close()
+	proj := testProject(api.URL)
+
+	const file = "repo1/x86_64/pkga/a-1.0-1.x86_64.rpm"
+	var buf bytes.Buffer
+	if n, err := proj.downloadBinary(context.Background(), file, cdn.URL+"/a.rpm", &buf, nil); err != nil || n != 5 || buf.String() != "CDNCD" {
+		t.Fatalf("got %q, %d bytes, %v", buf.String(), n, err)
+	}
+	if paths := apiRec.paths(); len(paths) != 0 {
+		t.Fatalf("got API requests for %q", paths)
+	}
+	if paths := cdnRec.paths(); !reflect.DeepEqual(paths, []string{"/a.rpm"}) {
+		t.Fatalf("got direct requests for %q", paths)
+	}
+}
@@ -0,0 +1,66 @@
+package obsgo
+
+import (
+	"path"
+	"strings"
+)
+
+// Debian architecture names of the OBS architectures
+var debArchitectures = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+	"ppc64le": "ppc64el",
+	"s390x":   "s390x",
+	"i586":    "i386",
+	"armv7l":  "armhf",
+}
+
+// Other RPM architectures of the packages built in the repositories of the
+// OBS architectures, e.g. "i686" packages in "i586" repositories
+var rpmArchAliases = map[string][]string{
+	"i586":   {"i686"},
+	"armv7l": {"armv7hl"},
+}
+
+// CanonicalArch returns the RPM name of the architecture arch, e.g. "x86_64"
+// for "amd64". Unknown architectures are returned unchanged.
+func CanonicalArch(arch string) string {
+	for rpmArch, debArch := range debArchitectures {
+		if arch == debArch {
+			return rpmArch
+		}
+	}
+	for rpmArch, aliases := range rpmArchAliases {
+		for _, alias := range aliases {
+			if arch == alias {
+				return rpmArch
+			}
+		}
+	}
+	return arch
+}
+
+// DebianArch returns the Debian name of the architecture arch, e.g. "amd64"
+// for "x86_64". Unknown architectures are returned unchanged.
+func DebianArch(arch string) string {
+	if debArch, ok := debArchitectures[CanonicalArch(arch)]; ok {
+		return debArch
+	}
+	return arch
+}
+
+// Returns the path of the package directory in the local layout, that is the
+// OBS path of its binaries, with the canonical architecture name when
+// NormalizeArchs is set.
+func (proj *Project) localPkgPath(pkgInfo PackageInfo) string {
+	pkgPath := binaryPath(pkgInfo)
+	if !proj.NormalizeArchs {
+		return pkgPath
+	}
+
+	parts := strings.Split(pkgPath, "/")
+	if len(parts) > 1 {
+		parts[1] = CanonicalArch(parts[1])
+	}
+	return path.Join(parts...)
+}
@@ -0,0 +1,51 @@
+package obsgo
+
+import "testing"
+
+func TestCanonicalArch(t *testing.T) {
+	for _, tc := range []struct {
+		arch, rpm, deb string
+	}{
+		{"x86_64", "x86_64", "amd64"},
+		{"amd64", "x86_64", "amd64"},
+		{"aarch64", "aarch64", "arm64"},
+		{"arm64", "aarch64", "arm64"},
+		{"ppc64le", "ppc64le", "ppc64el"},
+		{"ppc64el", "ppc64le", "ppc64el"},
+		{"s390x", "s390x", "s390x"},
+		{"i586", "i586", "i386"},
+		{"i386", "i586", "i386"},
+		{"i686", "i586", "i386"},
+		{"armv7l", "armv7l", "armhf"},
+		{"armhf", "armv7l", "armhf"},
+		{"armv7hl", "armv7l", "armhf"},
+		// Unknown architectures are kept.
+		{"riscv64", "riscv64", "riscv64"},
+		{"noarch", "noarch", "noarch"},
+	} {
+		if got := CanonicalArch(tc.arch); got != tc.rpm {
+			t.Errorf("CanonicalArch(%s): got %s, want %s", tc.arch, got, tc.rpm)
+		}
+		if got := DebianArch(tc.arch); got != tc.deb {
+			t.Errorf("DebianArch(%s): got %s, want %s", tc.arch, got, tc.deb)
+		}
+	}
+}
+
+func TestLocalPkgPath(t *testing.T) {
+	for _, tc := range []struct {
+		normalize bool
+		path      string
+		want      string
+	}{
+		{false, "Debian_12/amd64/pkg", "Debian_12/amd64/pkg"},
+		{true, "Debian_12/amd64/pkg", "Debian_12/x86_64/pkg"},
+		{true, "repo/x86_64/pkg", "repo/x86_64/pkg"},
+		{true, "repo/riscv64/pkg", "repo/riscv64/pkg"},
+	} {
+		proj := &Project{NormalizeArchs: tc.normalize}
+		if got := proj.localPkgPath(PackageInfo{Path: tc.path}); got != tc.want {
+			t.Errorf("normalize %v, %s: got %s, want %s", tc.normalize, tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package obsgo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Downloads all the binaries built for the given repo and arch, and writes
+// them to w as a tar archive, gzip compressed if GzipArchives is set. Files are
+// stored as <repo>/<arch>/<package>/<file>, with the OBS modification time.
+func (proj *Project) ArchiveArch(repo, arch string, w io.Writer) error {
+	pkgList, err := proj.RepoArchBinaries(repo, arch)
+	if err != nil {
+		return err
+	}
+
+	var gz *gzip.Writer
+	if proj.GzipArchives {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	for _, pkgInfo := range pkgList {
+		for _, f := range pkgInfo.Files {
+			if err := proj.archiveBinary(tw, pkgInfo, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(err, "could not write tar archive")
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return errors.Wrap(err, "could not write gzip stream")
+		}
+	}
+
+	return nil
+}
+
+// Downloads the binary file f of package pkgInfo as a new entry of tw.
+func (proj *Project) archiveBinary(tw *tar.Writer, pkgInfo PackageInfo, f PkgBinary) error {
+	remotePath := path.Join(binaryPath(pkgInfo), f.Filename)
+
+	var mtime time.Time
+	if epoch, err := f.MtimeUnix(); err == nil {
+		mtime = time.Unix(epoch, 0)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"filename": f.Filename,
+	}).Debug("Archiving OBS file")
+
+	// The tar header needs the exact size, only rounded to KiB with the
+	// binaryversions view: the file is then spooled to a temporary file
+	// first.
+	if f.Size == "" {
+		return proj.archiveSpooled(tw, remotePath, f, mtime)
+	}
+
+	size, err := f.SizeBytes()
+	if err != nil {
+		return err
+	}
+	if err := writeTarHeader(tw, remotePath, size, mtime); err != nil {
+		return err
+	}
+
+	written, err := proj.downloadBinary(context.Background(), remotePath, f.DownloadURL, tw, nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not download binary at %s", remotePath)
+	}
+	if written != size {
+		return errors.Errorf("downloaded %d bytes instead of %d for %s", written, size, remotePath)
+	}
+
+	return nil
+}
+
+// Downloads the binary file f at remotePath to a temporary file, and then
+// copies it as a new entry of tw, with its actual size.
+func (proj *Project) archiveSpooled(tw *tar.Writer, remotePath string, f PkgBinary, mtime time.Time) error {
+	tmp, err := ioutil.TempFile("", "obsgo-archive-")
+	if err != nil {
+		return errors.Wrapf(err, "could not create temporary file for %s", remotePath)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := proj.downloadBinary(context.Background(), remotePath, f.DownloadURL, tmp, nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not download binary at %s", remotePath)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "could not read temporary file for %s", remotePath)
+	}
+
+	if err := writeTarHeader(tw, remotePath, size, mtime); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, tmp); err != nil {
+		return errors.Wrapf(err, "could not write %s to tar archive", remotePath)
+	}
+
+	return nil
+}
+
+// Writes the header of a regular file entry named name to tw.
+func writeTarHeader(tw *tar.Writer, name string, size int64, mtime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  mtime,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not write tar header for %s", name)
+	}
+	return nil
+}
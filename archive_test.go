@@ -0,0 +1,104 @@
+package obsgo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArchiveArch(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	for _, gzipped := range []bool{false, true} {
+		proj := testProject(srv.URL)
+		proj.GzipArchives = gzipped
+		var buf bytes.Buffer
+		if err := proj.ArchiveArch("repo1", "x86_64", &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		var r io.Reader = &buf
+		if gzipped {
+			gz, err := gzip.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gz
+		}
+
+		// Extracts the archive.
+		files := make(map[string]string)
+		mtimes := make(map[string]time.Time)
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("gzip %v: %v", gzipped, err)
+			}
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[hdr.Name] = string(data)
+			mtimes[hdr.Name] = hdr.ModTime
+		}
+
+		want := map[string]string{
+			"repo1/x86_64/pkga/a-1.0-1.x86_64.rpm":           "AAAAA",
+			"repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm": "DDD",
+			"repo1/x86_64/pkgb/b-1.0-1.noarch.rpm":           "",
+		}
+		if !reflect.DeepEqual(files, want) {
+			t.Fatalf("gzip %v: got %q", gzipped, files)
+		}
+		if m := mtimes["repo1/x86_64/pkgb/b-1.0-1.noarch.rpm"]; !m.Equal(time.Unix(200, 0)) {
+			t.Errorf("gzip %v: got mtime %v", gzipped, m)
+		}
+	}
+}
+
+func TestArchiveArchBinaryVersions(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga?view=binaryversions"] = binaryVersionsXML
+	routes["/build/proj/repo1/x86_64/pkgb?view=binaryversions"] = `<binaryversionlist><binary name="b-1.0-1.noarch.rpm" sizek="0"/></binaryversionlist>`
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.BinaryVersions = true
+
+	var buf bytes.Buffer
+	if err := proj.ArchiveArch("repo1", "x86_64", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entries have the actual sizes, not the ones rounded to KiB.
+	sizes := make(map[string]int64)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[hdr.Name] = hdr.Size
+	}
+	want := map[string]int64{
+		"repo1/x86_64/pkga/a-1.0-1.x86_64.rpm":           5,
+		"repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm": 3,
+		"repo1/x86_64/pkgb/b-1.0-1.noarch.rpm":           0,
+	}
+	if !reflect.DeepEqual(sizes, want) {
+		t.Fatalf("got %v", sizes)
+	}
+}
@@ -0,0 +1,46 @@
+package obsgo
+
+import "sync"
+
+// Bytes of the ByteBudget used by a run
+type byteBudget struct {
+	mutex sync.Mutex
+	used  int64
+}
+
+// ResetBudget starts a new run of the ByteBudget for the DownloadPackageFiles
+// calls, making the whole budget available again to the following downloads.
+// Each Mirror call has its own budget.
+func (proj *Project) ResetBudget() {
+	proj.budget.mutex.Lock()
+	proj.budget.used = 0
+	proj.budget.mutex.Unlock()
+}
+
+// Reserves n bytes of the ByteBudget for a download of the run of b, returning
+// false when they would exceed it.
+func (proj *Project) reserveBudget(b *byteBudget, n int64) bool {
+	if proj.ByteBudget <= 0 {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.used+n > proj.ByteBudget {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// Returns n bytes reserved with reserveBudget and not downloaded.
+func (proj *Project) releaseBudget(b *byteBudget, n int64) {
+	if proj.ByteBudget <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	b.used -= n
+	b.mutex.Unlock()
+}
@@ -0,0 +1,117 @@
+package obsgo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestByteBudget(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.MirrorWorkers = 1
+	// The second file of pkga, of 3 bytes, does not fit after the first
+	// one of 5 bytes.
+	proj.ByteBudget = 6
+
+	root := t.TempDir()
+	summary, err := proj.Mirror(root)
+	if !errors.Is(err, ErrBudgetExceeded) || summary.Bytes != 5 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+	// Stopped before the file, not in the middle of it.
+	pkgDir := filepath.Join(root, "proj/repo1/x86_64/pkga")
+	matches, err := filepath.Glob(filepath.Join(pkgDir, "a-debuginfo-1.0-1.x86_64.rpm*"))
+	if err != nil || len(matches) != 0 {
+		t.Fatalf("got %v, %v", matches, err)
+	}
+
+	// The next run gets a new budget, and completes the mirror.
+	summary, err = proj.Mirror(root)
+	if err != nil || summary.Bytes != 3 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+	for _, file := range []string{
+		filepath.Join(pkgDir, "a-1.0-1.x86_64.rpm"),
+		filepath.Join(pkgDir, "a-debuginfo-1.0-1.x86_64.rpm"),
+		filepath.Join(root, "proj/repo1/x86_64/pkgb/b-1.0-1.noarch.rpm"),
+	} {
+		if _, err := os.Stat(file); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestByteBudgetDownloadPackageFiles(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.ByteBudget = 6
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The files fetched before the budget is exceeded are returned.
+	files, n, err := proj.DownloadPackageFiles(pkg, t.TempDir())
+	if !errors.Is(err, ErrBudgetExceeded) || n != 5 || len(files) != 1 || filepath.Base(files[0]) != "a-1.0-1.x86_64.rpm" {
+		t.Fatalf("got %v, %d bytes, %v", files, n, err)
+	}
+
+	// The bytes downloaded are summed across calls, until ResetBudget.
+	if files, n, err := proj.DownloadPackageFiles(pkg, t.TempDir()); !errors.Is(err, ErrBudgetExceeded) || n != 0 || len(files) != 0 {
+		t.Fatalf("got %v, %d bytes, %v", files, n, err)
+	}
+	proj.ResetBudget()
+	if _, n, err := proj.DownloadPackageFiles(pkg, t.TempDir()); !errors.Is(err, ErrBudgetExceeded) || n != 5 {
+		t.Fatalf("got %d bytes, %v after ResetBudget", n, err)
+	}
+
+	proj.ByteBudget = 0
+	if _, n, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil || n != 8 {
+		t.Fatalf("got %d bytes, %v without a budget", n, err)
+	}
+}
+
+func TestByteBudgetConcurrentMirrors(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.MirrorWorkers = 1
+	proj.ByteBudget = 8
+
+	// The DownloadPackageFiles budget is not reset by the Mirror runs.
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, n, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil || n != 8 {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+
+	// Each run has the whole budget, however the runs interleave.
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if summary, err := proj.Mirror(t.TempDir()); err != nil || summary.Bytes != 8 {
+				errs <- fmt.Errorf("got %+v, %v", summary, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package obsgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultCheckpointInterval = 100
+
+// Returned when the checkpoint position is after the last package of the
+// project, e.g. because the following repos have been removed.
+var errCheckpointPastEnd = errors.New("checkpoint position past the last package")
+
+// Checkpoint is the state of an interrupted project enumeration, used to
+// resume it with ResumeFindAllPackages.
+type Checkpoint struct {
+	// Repository, architecture and name of the last enumerated package
+	Repo    string
+	Arch    string
+	Package string
+	// The packages enumerated so far
+	Packages []PackageInfo
+}
+
+// SaveCheckpoint atomically writes cp to the local file at path.
+func SaveCheckpoint(path string, cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode checkpoint")
+	}
+	data = append(data, '\n')
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create checkpoint file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "Failed to write checkpoint file %s", tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to write checkpoint file %s", tmp.Name())
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Appends to the checkpoint file at path, as written by SaveCheckpoint, a
+// record moving its position to the one of cp, with the packages enumerated
+// since the previous record, so that the packages already saved are not
+// written again.
+func appendCheckpoint(path string, cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode checkpoint")
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open checkpoint file")
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return errors.Wrapf(err, "Failed to write checkpoint file %s", path)
+	}
+	if err := file.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to write checkpoint file %s", path)
+	}
+	return nil
+}
+
+// LoadCheckpoint reads the Checkpoint saved to the local file at path. The
+// records appended while enumerating are merged, and a last record left
+// incomplete by an interruption is ignored.
+func LoadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cp, errors.Wrapf(err, "Failed to read checkpoint file")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for n := 0; ; n++ {
+		var record Checkpoint
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && n > 0 {
+			logrus.WithFields(logrus.Fields{
+				"file":  path,
+				"error": err,
+			}).Warn("Ignoring incomplete checkpoint record")
+			break
+		}
+		if err != nil {
+			return cp, errors.Wrapf(err, "Failed to decode checkpoint file %s", path)
+		}
+
+		cp.Repo, cp.Arch, cp.Package = record.Repo, record.Arch, record.Package
+		cp.Packages = append(cp.Packages, record.Packages...)
+	}
+
+	return cp, nil
+}
+
+// Resumes the enumeration of FindAllPackages from the Checkpoint saved at
+// path, and returns all the packages files published on the OBS project,
+// including those enumerated before the checkpoint. New checkpoints are saved
+// to the same file.
+func (proj *Project) ResumeFindAllPackages(path string) ([]PackageInfo, error) {
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return proj.findAllPackagesCheckpoint(context.Background(), path, &cp)
+}
+
+// Enumerates the project packages starting after from, when not nil, saving
+// a checkpoint to path every CheckpointInterval packages and on failure. The
+// file is rewritten by the first save, which drops any incomplete record, and
+// the later saves only append the packages enumerated since the previous one.
+func (proj *Project) findAllPackagesCheckpoint(ctx context.Context, path string, from *Checkpoint) ([]PackageInfo, error) {
+	interval := proj.CheckpointInterval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+
+	var cp Checkpoint
+	if from != nil {
+		cp = *from
+	}
+
+	// Number of packages of cp already in the file, -1 until the first save
+	saved := -1
+	save := func() error {
+		if saved < 0 {
+			if err := SaveCheckpoint(path, cp); err != nil {
+				return err
+			}
+		} else {
+			record := cp
+			record.Packages = cp.Packages[saved:]
+			if err := appendCheckpoint(path, record); err != nil {
+				return err
+			}
+		}
+		saved = len(cp.Packages)
+		return nil
+	}
+
+	n := 0
+	err := proj.findAllPackagesFrom(ctx, from, func(pkg PackageInfo) error {
+		cp.Packages = append(cp.Packages, pkg)
+		cp.Repo, cp.Arch, cp.Package = pkg.Repo, pkg.Arch, pkg.Name
+
+		n++
+		if n%interval == 0 {
+			return save()
+		}
+		return nil
+	})
+	if err != nil {
+		if saveErr := save(); saveErr != nil {
+			logrus.WithFields(logrus.Fields{
+				"file":  path,
+				"error": saveErr,
+			}).Warn("Failed to save enumeration checkpoint")
+		}
+		return cp.Packages, err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return cp.Packages, errors.Wrapf(err, "Failed to remove checkpoint file")
+	}
+
+	return cp.Packages, nil
+}
@@ -0,0 +1,142 @@
+package obsgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResumeFindAllPackages(t *testing.T) {
+	srv := newFlakyServer(t, threeRepoRoutes())
+	full, err := testProject(srv.URL).FindAllPackages()
+	if err != nil || len(full) != 6 {
+		t.Fatalf("got %d packages, %v", len(full), err)
+	}
+
+	cpFile := filepath.Join(t.TempDir(), "checkpoint")
+	proj := testProject(srv.URL)
+	proj.CheckpointFile = cpFile
+	proj.CheckpointInterval = 2
+
+	// The enumeration fails on the last package.
+	srv.fail("/build/proj/repo3/x86_64/pkgb", 1)
+	pkgs, err := proj.FindAllPackages()
+	if err == nil || len(pkgs) != 5 {
+		t.Fatalf("got %d packages, %v", len(pkgs), err)
+	}
+	cp, err := LoadCheckpoint(cpFile)
+	if err != nil || cp.Repo != "repo3" || cp.Arch != "x86_64" || cp.Package != "pkga" {
+		t.Fatalf("got checkpoint %+v, %v", cp, err)
+	}
+	if !reflect.DeepEqual(cp.Packages, full[:5]) {
+		t.Fatalf("got checkpoint packages %+v", cp.Packages)
+	}
+
+	resumed, err := proj.ResumeFindAllPackages(cpFile)
+	if err != nil || !reflect.DeepEqual(resumed, full) {
+		t.Fatalf("got %+v, %v", resumed, err)
+	}
+	// The checkpoint is removed once the enumeration completes.
+	if _, err := os.Stat(cpFile); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint file left, %v", err)
+	}
+}
+
+func TestResumeFindAllPackagesEmptiedArch(t *testing.T) {
+	routes := threeRepoRoutes()
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	full, err := testProject(srv.URL).FindAllPackages()
+	if err != nil || len(full) != 6 {
+		t.Fatalf("got %d packages, %v", len(full), err)
+	}
+	cpFile := filepath.Join(t.TempDir(), "checkpoint")
+	if err := SaveCheckpoint(cpFile, Checkpoint{Repo: "repo2", Arch: "x86_64", Package: "pkga", Packages: full[:3]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The packages of the checkpoint arch are all removed.
+	routes["/build/proj/repo2/x86_64"] = dir()
+	srv = mockServer(t, routes)
+	defer srv.Close()
+	resumed, err := testProject(srv.URL).ResumeFindAllPackages(cpFile)
+	if err != nil || !reflect.DeepEqual(resumed, append(full[:3:3], full[4:]...)) {
+		t.Fatalf("got %+v, %v", resumed, err)
+	}
+}
+
+func TestResumeFindAllPackagesRemovedPosition(t *testing.T) {
+	srv := mockServer(t, threeRepoRoutes())
+	defer srv.Close()
+	full, err := testProject(srv.URL).FindAllPackages()
+	if err != nil || len(full) != 6 {
+		t.Fatalf("got %d packages, %v", len(full), err)
+	}
+
+	for name, removed := range map[string]map[string]string{
+		"repo": {"/build/proj": dir("repo1", "repo3")},
+		"arch": {"/build/proj/repo2": dir()},
+	} {
+		cpFile := filepath.Join(t.TempDir(), "checkpoint")
+		if err := SaveCheckpoint(cpFile, Checkpoint{Repo: "repo2", Arch: "x86_64", Package: "pkga", Packages: full[:3]}); err != nil {
+			t.Fatal(err)
+		}
+
+		// The enumeration continues from the next repo.
+		routes := threeRepoRoutes()
+		for p, body := range removed {
+			routes[p] = body
+		}
+		srv := mockServer(t, routes)
+		defer srv.Close()
+		resumed, err := testProject(srv.URL).ResumeFindAllPackages(cpFile)
+		if err != nil || !reflect.DeepEqual(resumed, append(full[:3:3], full[4:]...)) {
+			t.Errorf("removed %s: got %+v, %v", name, resumed, err)
+		}
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	cpFile := filepath.Join(t.TempDir(), "checkpoint")
+	first := Checkpoint{Repo: "repo1", Arch: "x86_64", Package: "pkga", Packages: []PackageInfo{{Name: "pkga"}}}
+	if err := SaveCheckpoint(cpFile, first); err != nil {
+		t.Fatal(err)
+	}
+	second := Checkpoint{Repo: "repo1", Arch: "x86_64", Package: "pkgb", Packages: []PackageInfo{{Name: "pkgb"}}}
+	if err := appendCheckpoint(cpFile, second); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(cpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The records are one per line.
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Fatalf("got %d lines in %q", n, data)
+	}
+
+	want := Checkpoint{Repo: "repo1", Arch: "x86_64", Package: "pkgb", Packages: []PackageInfo{{Name: "pkga"}, {Name: "pkgb"}}}
+	for _, tc := range []struct {
+		name string
+		data string
+		want Checkpoint
+		err  bool
+	}{
+		// The appended records are merged.
+		{"appended", string(data), want, false},
+		// A record cut short by an interruption is ignored.
+		{"truncated", string(data) + `{"Repo":"repo2","Packa`, want, false},
+		{"corrupted", `{"Repo":`, Checkpoint{}, true},
+	} {
+		if err := ioutil.WriteFile(cpFile, []byte(tc.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cp, err := LoadCheckpoint(cpFile)
+		if (err != nil) != tc.err || !reflect.DeepEqual(cp, tc.want) {
+			t.Errorf("%s: got %+v, %v", tc.name, cp, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package obsgo
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Name of the file listing the SHA-256 checksums of the files of a package,
+// in the format used by the sha256sum tool
+const checksumsFileName = "SHA256SUMS"
+
+// Reads the checksums listed in the file at path, indexed by file name. An
+// empty map is returned when the file does not exist.
+func readChecksums(store Storage, path string) (map[string]string, error) {
+	sums := make(map[string]string)
+
+	file, err := store.Open(path)
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open checksums file %s", path)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "could not read checksums file %s", path)
+	}
+
+	return sums, nil
+}
+
+// Writes to the file at path the checksums of the files with the given names,
+// in the given order. Files without a known checksum are not listed.
+func writeChecksums(store Storage, path string, sums map[string]string, names []string) error {
+	file, err := store.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "could not create checksums file %s", path)
+	}
+
+	w := bufio.NewWriter(file)
+	for _, name := range names {
+		if sum, ok := sums[name]; ok {
+			fmt.Fprintf(w, "%s  %s\n", sum, name)
+		}
+	}
+
+	err = w.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not write checksums file %s", path)
+	}
+	return nil
+}
+
+// Returns the hex encoded SHA-256 checksum of the file at path.
+func hashFile(store Storage, path string) (string, error) {
+	file, err := store.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
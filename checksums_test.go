@@ -0,0 +1,173 @@
+package obsgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Returns the hex encoded SHA-256 checksum of s.
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDownloadPackageFilesChecksums(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.Checksums = true
+
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	sumsFile := filepath.Join(root, "proj/repo1/x86_64/pkga", checksumsFileName)
+	want := sha256Hex("AAAAA") + "  a-1.0-1.x86_64.rpm\n" +
+		sha256Hex("DDD") + "  a-debuginfo-1.0-1.x86_64.rpm\n"
+
+	// The checksums computed while downloading match the files, and are
+	// kept when the files are already downloaded.
+	for i := 0; i < 2; i++ {
+		if _, _, err := proj.DownloadPackageFiles(pkg, root); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(sumsFile)
+		if err != nil || string(data) != want {
+			t.Fatalf("run %d: got %q, %v", i, data, err)
+		}
+	}
+
+	sums, err := readChecksums(FileStorage{}, sumsFile)
+	if err != nil || len(sums) != 2 || sums["a-1.0-1.x86_64.rpm"] != sha256Hex("AAAAA") {
+		t.Fatalf("got %v, %v", sums, err)
+	}
+}
+
+func TestDownloadBinaryHash(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	var buf bytes.Buffer
+	h := sha256.New()
+	n, err := proj.downloadBinary(context.Background(), "repo1/x86_64/pkga/a-1.0-1.x86_64.rpm", "", &buf, h)
+	if err != nil || n != 5 || buf.String() != "AAAAA" {
+		t.Fatalf("got %q, %d bytes, %v", buf.String(), n, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != sha256Hex("AAAAA") {
+		t.Fatalf("got checksum %s", sum)
+	}
+}
+
+// Compares hashing a downloaded file while writing it, with hashing it after
+// it has been written. The file written is still in the page cache when it is
+// read again here, so the post-hoc hashing does not pay the extra disk read
+// saved by the inline one on large mirrors.
+func BenchmarkDownloadChecksum(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<18)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	localFile := filepath.Join(b.TempDir(), "file")
+
+	download := func(b *testing.B, inline bool) {
+		file, err := os.Create(localFile)
+		if err != nil {
+			b.Fatal(err)
+		}
+		h := sha256.New()
+		if !inline {
+			h = nil
+		}
+		_, err = proj.downloadBinary(context.Background(), "file", "", file, h)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !inline {
+			if _, err := hashFile(FileStorage{}, localFile); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	for _, bc := range []struct {
+		name   string
+		inline bool
+	}{
+		{"inline", true},
+		{"post-hoc", false},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				download(b, bc.inline)
+			}
+		})
+	}
+}
+
+func TestDownloadPackageFilesForceVerify(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.Checksums = true
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	files, _, err := proj.DownloadPackageFiles(pkg, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Corrupted without changing its size or mtime.
+	if err := ioutil.WriteFile(files[0], []byte("BBBBB"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		force bool
+		bytes int64
+		want  string
+	}{
+		// The recorded checksums are trusted.
+		{false, 0, "BBBBB"},
+		{true, 5, "AAAAA"},
+	} {
+		proj.ForceVerify = tc.force
+		if _, n, err := proj.DownloadPackageFiles(pkg, root); err != nil || n != tc.bytes {
+			t.Fatalf("force %v: got %d bytes, %v", tc.force, n, err)
+		}
+		if data, err := ioutil.ReadFile(files[0]); err != nil || string(data) != tc.want {
+			t.Fatalf("force %v: got %q, %v", tc.force, data, err)
+		}
+	}
+
+	// The files missing from the checksums file are hashed and recorded.
+	proj.ForceVerify = false
+	sumsFile := filepath.Join(root, "proj/repo1/x86_64/pkga", checksumsFileName)
+	if err := os.Remove(sumsFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, n, err := proj.DownloadPackageFiles(pkg, root); err != nil || n != 0 {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+	sums, err := readChecksums(FileStorage{}, sumsFile)
+	if err != nil || sums["a-1.0-1.x86_64.rpm"] != sha256Hex("AAAAA") || sums["a-debuginfo-1.0-1.x86_64.rpm"] != sha256Hex("DDD") {
+		t.Fatalf("got %v, %v", sums, err)
+	}
+}
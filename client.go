@@ -0,0 +1,94 @@
+package obsgo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Maximum number of idle connections kept open to the OBS server. Enumeration
+// issues many small sequential or concurrent requests to the same host, so
+// keeping connections around avoids a TCP and TLS handshake per request.
+const maxIdleConnsPerHost = 16
+
+// defaultClient is the HTTP client shared by all the projects not configuring
+// their own Client. Its transport enables HTTP/2 and keep-alives.
+var defaultClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+func (proj *Project) httpClient() *http.Client {
+	if proj.Client == nil {
+		return defaultClient
+	}
+	return proj.Client
+}
+
+func (proj *Project) downloadClient() *http.Client {
+	if proj.DownloadClient == nil {
+		return proj.httpClient()
+	}
+	return proj.DownloadClient
+}
+
+// Close releases the resources held by the project, closing the idle
+// connections of its Client and DownloadClient, when set, and dropping its
+// caches. The connections of the default client, shared with the other
+// projects, are kept. Any further request of the project fails with
+// ErrClosed. Closing a project more than once has no effect.
+func (proj *Project) Close() error {
+	if !atomic.CompareAndSwapInt32(&proj.closed, 0, 1) {
+		return nil
+	}
+
+	if proj.Client != nil {
+		proj.Client.CloseIdleConnections()
+	}
+	if proj.DownloadClient != nil {
+		proj.DownloadClient.CloseIdleConnections()
+	}
+
+	proj.aboutMutex.Lock()
+	proj.about = nil
+	proj.aboutMutex.Unlock()
+	proj.exclusionsMutex.Lock()
+	proj.excluded = nil
+	proj.exclusionsMutex.Unlock()
+	return nil
+}
+
+func (proj *Project) isClosed() bool {
+	return atomic.LoadInt32(&proj.closed) != 0
+}
+
+// Ping checks with a single request that the OBS server is reachable, and that
+// the project exists and can be accessed with the project credentials. The
+// returned error matches, via errors.Is, ErrUnreachable, ErrUnauthorized or
+// ErrNotFound for each of those failures.
+func (proj *Project) Ping() error {
+	body, err := proj.doRequest(context.Background(), proj.buildPath("", nil), listingHeader())
+	if err != nil {
+		cause := errors.Cause(err)
+		if _, ok := cause.(*HTTPError); ok || cause == ErrClosed || cause == ErrMaintenance {
+			return err
+		}
+		return errors.Wrapf(ErrUnreachable, "%v", err)
+	}
+	return body.Close()
+}
@@ -0,0 +1,277 @@
+package obsgo
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Returns the routes of project "proj" with a repository, 2 archs and n
+// packages built for each.
+func mediumProjectRoutes(n int) map[string]string {
+	routes := map[string]string{
+		"/build/proj":       dir("repo1"),
+		"/build/proj/repo1": dir("x86_64", "aarch64"),
+	}
+	for _, arch := range []string{"x86_64", "aarch64"} {
+		var pkgs []string
+		for i := 0; i < n; i++ {
+			pkg := fmt.Sprintf("pkg%03d", i)
+			pkgs = append(pkgs, pkg)
+			routes["/build/proj/repo1/"+arch+"/"+pkg] = testBinaryList(pkg + "-1.0-1." + arch + ".rpm")
+		}
+		routes["/build/proj/repo1/"+arch] = dir(pkgs...)
+	}
+	return routes
+}
+
+// Returns a server like mockServer, counting the connections opened to it.
+func countingServer(t testing.TB, routes map[string]string) (*httptest.Server, *int32) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(mockHandler(routes))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	return srv, &conns
+}
+
+func TestDefaultClientReusesConnections(t *testing.T) {
+	srv, conns := countingServer(t, mediumProjectRoutes(20))
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	pkgs, err := proj.FindAllPackages()
+	if err != nil || len(pkgs) != 40 {
+		t.Fatalf("got %d packages, %v", len(pkgs), err)
+	}
+	// The sequential requests all go through the same connection.
+	if n := atomic.LoadInt32(conns); n != 1 {
+		t.Fatalf("%d connections opened for %d packages", n, len(pkgs))
+	}
+}
+
+func TestDefaultClientHTTP2(t *testing.T) {
+	var proto int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&proto, int32(r.ProtoMajor))
+		w.Write([]byte(dir("repo1")))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The default transport, trusting the test server certificate.
+	transport := defaultClient.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	proj := testProject(srv.URL)
+	proj.Client = &http.Client{Transport: transport}
+	defer transport.CloseIdleConnections()
+
+	if _, err := proj.ListRepos(); err != nil {
+		t.Fatal(err)
+	}
+	if p := atomic.LoadInt32(&proto); p != 2 {
+		t.Fatalf("got HTTP/%d", p)
+	}
+}
+
+// A transport recording the paths of the requests going through it.
+type recordingTransport struct {
+	mutex sync.Mutex
+	paths []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mutex.Lock()
+	rt.paths = append(rt.paths, req.URL.Path)
+	rt.mutex.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Returns the paths of the requests gone through the transport.
+func (rt *recordingTransport) requested() []string {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	return append([]string(nil), rt.paths...)
+}
+
+func TestDownloadClient(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	listings, downloads := &recordingTransport{}, &recordingTransport{}
+	proj := testProject(srv.URL)
+	proj.Client = &http.Client{Transport: listings}
+	proj.DownloadClient = &http.Client{Transport: downloads}
+
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/build/proj/repo1/x86_64/pkga"}
+	if got := listings.requested(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got listings %q, want %q", got, want)
+	}
+	got := downloads.requested()
+	sort.Strings(got)
+	want = []string{
+		"/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm",
+		"/build/proj/repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got downloads %q, want %q", got, want)
+	}
+
+	// Without a download client, the downloads go through the main client.
+	proj.DownloadClient = nil
+	if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(listings.requested()); n != 3 {
+		t.Errorf("got %d requests through the main client", n)
+	}
+}
+
+func TestClose(t *testing.T) {
+	var open int32
+	srv := httptest.NewUnstartedServer(mockHandler(basicRoutes()))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			atomic.AddInt32(&open, 1)
+		case http.StateClosed, http.StateHijacked:
+			atomic.AddInt32(&open, -1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	transport := defaultClient.Transport.(*http.Transport).Clone()
+	proj := testProject(srv.URL)
+	proj.Client = &http.Client{Transport: transport}
+	// Uses the default client.
+	other := testProject(srv.URL)
+	for _, p := range []*Project{proj, other} {
+		if _, err := p.ListRepos(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing more than once has no effect.
+	for i := 0; i < 2; i++ {
+		if err := proj.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"listing", func() error {
+			_, err := proj.ListRepos()
+			return err
+		}},
+		{"download", func() error {
+			_, _, err := proj.DownloadPackageFiles(pkg, t.TempDir())
+			return err
+		}},
+		{"ping", proj.Ping},
+	} {
+		if err := tc.fn(); !errors.Is(err, ErrClosed) {
+			t.Errorf("%s: got %v", tc.name, err)
+		}
+	}
+
+	// The idle connection of the project client is closed, the one of the
+	// default client is kept and still used.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&open) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&open); n != 1 {
+		t.Fatalf("%d connections open", n)
+	}
+	if _, err := other.ListRepos(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&open); n != 1 {
+		t.Fatalf("%d connections open", n)
+	}
+}
+
+func TestPing(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	closed := mockServer(t, basicRoutes())
+	closed.Close()
+
+	for _, tc := range []struct {
+		name string
+		url  string
+		want error
+	}{
+		{"ok", srv.URL, nil},
+		{"unreachable", closed.URL, ErrUnreachable},
+		{"unauthorized", statusServer(t, http.StatusUnauthorized).URL, ErrUnauthorized},
+		{"forbidden", statusServer(t, http.StatusForbidden).URL, ErrUnauthorized},
+		{"not found", statusServer(t, http.StatusNotFound).URL, ErrNotFound},
+	} {
+		err := testProject(tc.url).Ping()
+		if (tc.want == nil && err != nil) || (tc.want != nil && !errors.Is(err, tc.want)) {
+			t.Errorf("%s: got %v", tc.name, err)
+		}
+		// The outcomes are distinct.
+		for _, other := range []error{ErrUnreachable, ErrUnauthorized, ErrNotFound} {
+			if other != tc.want && errors.Is(err, other) {
+				t.Errorf("%s: got %v", tc.name, err)
+			}
+		}
+	}
+}
+
+// Compares the enumeration of a medium project with the default client, and
+// with a client opening a new connection for every request.
+func BenchmarkFindAllPackages(b *testing.B) {
+	srv, _ := countingServer(b, mediumProjectRoutes(100))
+	defer srv.Close()
+
+	noReuse := defaultClient.Transport.(*http.Transport).Clone()
+	noReuse.DisableKeepAlives = true
+	for _, bc := range []struct {
+		name   string
+		client *http.Client
+	}{
+		{"default", nil},
+		{"no-keepalive", &http.Client{Transport: noReuse}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			proj := testProject(srv.URL)
+			proj.Client = bc.client
+			for i := 0; i < b.N; i++ {
+				if _, err := proj.FindAllPackages(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package obsgo
+
+import (
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	cpioNewcMagic   = "070701"
+	cpioHeaderSize  = 110
+	cpioTrailerName = "TRAILER!!!"
+	cpioModeType    = 0170000
+	cpioModeRegular = 0100000
+	// Limit of the entry names, PATH_MAX on Linux, checked before allocating
+	// them
+	cpioMaxNameSize = 4096
+)
+
+// cpioHeader holds the fields of a "newc" cpio entry header needed to extract
+// the archived binaries.
+type cpioHeader struct {
+	Name  string
+	Mode  int64
+	Mtime int64
+	Size  int64
+}
+
+// cpioReader reads the entries of a "newc" cpio archive, the format used by
+// the OBS "view=cpio" API.
+type cpioReader struct {
+	r io.Reader
+	// Bytes of the current entry data not read yet, plus padding
+	remaining int64
+	pad       int64
+}
+
+func newCpioReader(r io.Reader) *cpioReader {
+	return &cpioReader{r: r}
+}
+
+// Advances to the next entry of the archive, discarding any unread data of
+// the current one. io.EOF is returned when the archive trailer is reached.
+func (cr *cpioReader) Next() (*cpioHeader, error) {
+	if _, err := io.CopyN(ioutil.Discard, cr.r, cr.remaining+cr.pad); err != nil {
+		return nil, err
+	}
+	cr.remaining, cr.pad = 0, 0
+
+	var raw [cpioHeaderSize]byte
+	if _, err := io.ReadFull(cr.r, raw[:]); err != nil {
+		return nil, errors.Wrap(err, "could not read cpio header")
+	}
+	if string(raw[:6]) != cpioNewcMagic {
+		return nil, errors.Errorf("invalid cpio header magic %q", raw[:6])
+	}
+
+	// Fields are 8 characters hex numbers, following the magic.
+	field := func(i int) (int64, error) {
+		start := 6 + i*8
+		return strconv.ParseInt(string(raw[start:start+8]), 16, 64)
+	}
+
+	var hdr cpioHeader
+	var err error
+	if hdr.Mode, err = field(1); err != nil {
+		return nil, errors.Wrap(err, "invalid cpio mode")
+	}
+	if hdr.Mtime, err = field(5); err != nil {
+		return nil, errors.Wrap(err, "invalid cpio mtime")
+	}
+	if hdr.Size, err = field(6); err != nil {
+		return nil, errors.Wrap(err, "invalid cpio file size")
+	}
+	nameSize, err := field(11)
+	if err != nil || nameSize < 1 || nameSize > cpioMaxNameSize {
+		return nil, errors.Errorf("invalid cpio name size %q", raw[94:102])
+	}
+
+	// The name is NUL terminated, and header plus name are padded to a
+	// multiple of 4 bytes.
+	name := make([]byte, nameSize+cpioPadding(cpioHeaderSize+nameSize))
+	if _, err := io.ReadFull(cr.r, name); err != nil {
+		return nil, errors.Wrap(err, "could not read cpio entry name")
+	}
+	hdr.Name = string(name[:nameSize-1])
+
+	if hdr.Name == cpioTrailerName {
+		return nil, io.EOF
+	}
+
+	cr.remaining = hdr.Size
+	cr.pad = cpioPadding(hdr.Size)
+
+	return &hdr, nil
+}
+
+// Reads the data of the current entry.
+func (cr *cpioReader) Read(p []byte) (int, error) {
+	if cr.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.r.Read(p)
+	cr.remaining -= int64(n)
+	if err == io.EOF && cr.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (hdr *cpioHeader) isRegular() bool {
+	return hdr.Mode&cpioModeType == cpioModeRegular
+}
+
+func cpioPadding(n int64) int64 {
+	return (4 - n%4) % 4
+}
@@ -0,0 +1,170 @@
+package obsgo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type cpioEntry struct {
+	name string
+	mode int
+	data string
+}
+
+// Returns a "newc" cpio archive of entries, as served by OBS with view=cpio.
+func newcArchive(entries ...cpioEntry) []byte {
+	var b bytes.Buffer
+	add := func(e cpioEntry) {
+		fmt.Fprintf(&b, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+			1, e.mode, 0, 0, 1, 1234, len(e.data), 0, 0, 0, 0, len(e.name)+1, 0)
+		b.WriteString(e.name)
+		b.WriteByte(0)
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+		b.WriteString(e.data)
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+	}
+	for _, e := range entries {
+		add(e)
+	}
+	add(cpioEntry{name: cpioTrailerName})
+	return b.Bytes()
+}
+
+func TestCpioReader(t *testing.T) {
+	arc := newcArchive(
+		cpioEntry{"a.rpm", 0100644, "hello"},
+		cpioEntry{"dir", 040755, ""},
+		cpioEntry{"bb.rpm", 0100644, "xy"},
+	)
+	cr := newCpioReader(bytes.NewReader(arc))
+
+	var names []string
+	for {
+		hdr, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Mtime != 1234 {
+			t.Errorf("%s: mtime %d", hdr.Name, hdr.Mtime)
+		}
+		if !hdr.isRegular() {
+			continue
+		}
+		// The data of the first entry is left unread.
+		if hdr.Name == "bb.rpm" {
+			if data, err := ioutil.ReadAll(cr); err != nil || string(data) != "xy" {
+				t.Fatalf("got %q, %v", data, err)
+			}
+		}
+		names = append(names, hdr.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"a.rpm", "bb.rpm"}) {
+		t.Fatalf("got %v", names)
+	}
+
+	// A truncated archive is an error, not the end of the archive.
+	cr = newCpioReader(bytes.NewReader(arc[:len(arc)-20]))
+	var err error
+	for err == nil {
+		_, err = cr.Next()
+	}
+	if err == io.EOF {
+		t.Fatal("truncated archive not detected")
+	}
+
+	if _, err := newCpioReader(bytes.NewReader([]byte("070707"))).Next(); err == nil {
+		t.Fatal("expected an error for an invalid magic")
+	}
+
+	// A name larger than the limit is rejected before allocating it.
+	huge := newcArchive(cpioEntry{"a.rpm", 0100644, "hello"})
+	copy(huge[94:102], "fffffff0")
+	if _, err := newCpioReader(bytes.NewReader(huge)).Next(); err == nil || !strings.Contains(err.Error(), "name size") {
+		t.Fatalf("got %v for a huge name size", err)
+	}
+}
+
+func TestDownloadCPIO(t *testing.T) {
+	arc := newcArchive(
+		cpioEntry{"a.rpm", 0100644, "hello"},
+		cpioEntry{"bb.rpm", 0100644, "xy"},
+		cpioEntry{"../evil", 0100644, "z"},
+	)
+	srv := mockServer(t, map[string]string{
+		"/build/proj/repo1/x86_64/pkga?view=cpio": string(arc),
+	})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	root := t.TempDir()
+	files, err := proj.DownloadCPIO("repo1", "x86_64", "pkga", root)
+	if err != nil || len(files) != 3 {
+		t.Fatalf("got %v, %v", files, err)
+	}
+	// Entry names are not trusted to escape the package directory.
+	for name, want := range map[string]string{"a.rpm": "hello", "bb.rpm": "xy", "evil": "z"} {
+		data, err := ioutil.ReadFile(filepath.Join(root, "proj/repo1/x86_64/pkga", name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v", name, data, err)
+		}
+	}
+
+	if _, err := proj.DownloadCPIO("repo1", "x86_64", "missing", root); err == nil {
+		t.Fatal("expected an error for a missing package")
+	}
+	if parts, _ := filepath.Glob(filepath.Join(root, "proj/repo1/x86_64/pkga/*.part")); len(parts) != 0 {
+		t.Fatalf("partial files left: %v", parts)
+	}
+}
+
+func TestDownloadCPIOInvalid(t *testing.T) {
+	names := []string{"", ".", "..", "a/.."}
+	routes := make(map[string]string)
+	for i, name := range names {
+		routes[fmt.Sprintf("/build/proj/repo1/x86_64/p%d?view=cpio", i)] = string(newcArchive(cpioEntry{name, 0100644, "z"}))
+	}
+	// The truncated entry does not replace the file of a previous download.
+	arc := newcArchive(cpioEntry{"a.rpm", 0100644, "hello"})
+	routes["/build/proj/repo1/x86_64/truncated?view=cpio"] = string(arc[:118])
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	root := t.TempDir()
+	for i, name := range names {
+		if _, err := proj.DownloadCPIO("repo1", "x86_64", fmt.Sprintf("p%d", i), root); err == nil || !strings.Contains(err.Error(), "invalid cpio entry name") {
+			t.Errorf("%q: got %v", name, err)
+		}
+	}
+
+	local := filepath.Join(root, "proj/repo1/x86_64/truncated/a.rpm")
+	if err := os.MkdirAll(filepath.Dir(local), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(local, []byte("previous"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proj.DownloadCPIO("repo1", "x86_64", "truncated", root); err == nil {
+		t.Fatal("expected an error for a truncated archive")
+	}
+	if data, err := ioutil.ReadFile(local); err != nil || string(data) != "previous" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if _, err := os.Stat(local + ".part"); !os.IsNotExist(err) {
+		t.Fatalf("partial file left: %v", err)
+	}
+}
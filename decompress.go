@@ -0,0 +1,95 @@
+package obsgo
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Decompressor returns a reader of the decompressed content of r, e.g.
+// gzip.NewReader for gzip files. Decompressors for other formats, such as
+// xz or zstd, can be provided by third party packages.
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+// GzipDecompressor is the Decompressor of the gzip files.
+func GzipDecompressor(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// Returns the Decompressor of filename from Decompress, and the extension it
+// is selected by, the longest matching one. Returns nil when the file is not
+// decompressed.
+func (proj *Project) decompressor(filename string) (Decompressor, string) {
+	var dec Decompressor
+	var ext string
+	for e, d := range proj.Decompress {
+		if strings.HasSuffix(filename, e) && len(e) > len(ext) && len(e) < len(filename) {
+			dec, ext = d, e
+		}
+	}
+	return dec, ext
+}
+
+// Reports whether localFile in store is the complete decompressed copy of the
+// binary file f. As its size is unknown, it must have been written after f
+// was built.
+func isDecompressed(store Storage, localFile string, f PkgBinary) (bool, error) {
+	info, err := store.Stat(localFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	mtime, err := f.MtimeUnix()
+	if err != nil {
+		return false, nil
+	}
+	return info.ModTime().After(time.Unix(mtime, 0)), nil
+}
+
+// decompressWriter decompresses the data written to it with a Decompressor,
+// writing the result to another writer.
+type decompressWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func newDecompressWriter(w io.Writer, dec Decompressor) *decompressWriter {
+	pr, pw := io.Pipe()
+	dw := &decompressWriter{pw: pw, done: make(chan error, 1)}
+
+	go func() {
+		r, err := dec(pr)
+		if err == nil {
+			_, err = io.Copy(w, r)
+			if closeErr := r.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		// Unblocks the writer if the decompressor stops reading early.
+		pr.CloseWithError(err)
+		dw.done <- err
+	}()
+
+	return dw
+}
+
+func (dw *decompressWriter) Write(p []byte) (int, error) {
+	n, err := dw.pw.Write(p)
+	if err != nil {
+		// Invalid data, downloading it again would not help.
+		return n, noRetry{err}
+	}
+	return n, nil
+}
+
+// Close ends the compressed data, and returns the decompression error, if
+// any.
+func (dw *decompressWriter) Close() error {
+	dw.pw.Close()
+	return <-dw.done
+}
@@ -0,0 +1,106 @@
+package obsgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Returns data compressed with gzip.
+func gzipped(t *testing.T, data string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDecompressor(t *testing.T) {
+	proj := &Project{Decompress: map[string]Decompressor{".gz": GzipDecompressor, ".tar.gz": GzipDecompressor}}
+	for _, tc := range []struct {
+		filename, ext string
+	}{
+		{"img.tar.gz", ".tar.gz"},
+		{"log.gz", ".gz"},
+		{"a-1.0-1.x86_64.rpm", ""},
+		// A file named as the extension is kept.
+		{".gz", ""},
+	} {
+		if dec, ext := proj.decompressor(tc.filename); ext != tc.ext || (dec == nil) != (tc.ext == "") {
+			t.Errorf("%s: got extension %q", tc.filename, ext)
+		}
+	}
+}
+
+func TestDownloadPackageFilesDecompress(t *testing.T) {
+	const content = "decompressed content"
+	img := gzipped(t, content)
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga"] = `<binarylist>` +
+		`<binary filename="a-1.0-1.x86_64.rpm" size="5" mtime="100"/>` +
+		`<binary filename="img.x86_64-1.0.tar.gz" size="` + strconv.Itoa(len(img)) + `" mtime="100"/>` +
+		`<binary filename="bad.x86_64-1.0.tar.gz" size="4" mtime="100"/>` +
+		`</binarylist>`
+	routes["/build/proj/repo1/x86_64/pkga/img.x86_64-1.0.tar.gz"] = img
+	routes["/build/proj/repo1/x86_64/pkga/bad.x86_64-1.0.tar.gz"] = "junk"
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	proj := testProject(srv.URL)
+	proj.IncludeContainers = true
+	proj.Checksums = true
+	proj.ContinueOnDownloadError = true
+	proj.Decompress = map[string]Decompressor{".gz": GzipDecompressor}
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil || len(pkg.Files) != 3 {
+		t.Fatalf("got %+v, %v", pkg.Files, err)
+	}
+
+	// The file that is not valid gzip fails, the others are stored.
+	root := t.TempDir()
+	files, _, err := proj.DownloadPackageFiles(pkg, root)
+	if err == nil || !strings.Contains(err.Error(), "decompress") || len(files) != 2 {
+		t.Fatalf("got %v, %v", files, err)
+	}
+	pkgDir := filepath.Join(root, "proj/repo1/x86_64/pkga")
+	if data, err := ioutil.ReadFile(filepath.Join(pkgDir, "img.x86_64-1.0.tar")); err != nil || string(data) != content {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	for _, file := range []string{"img.x86_64-1.0.tar.gz", "bad.x86_64-1.0.tar", "bad.x86_64-1.0.tar.gz"} {
+		if _, err := os.Stat(filepath.Join(pkgDir, file)); !os.IsNotExist(err) {
+			t.Errorf("%s: got %v", file, err)
+		}
+	}
+	// The checksums are those of the decompressed files.
+	sums, err := readChecksums(FileStorage{}, filepath.Join(pkgDir, checksumsFileName))
+	if err != nil || sums["img.x86_64-1.0.tar"] != sha256Hex(content) {
+		t.Fatalf("got %v, %v", sums, err)
+	}
+
+	// The decompressed files are not downloaded again.
+	pkg.Files = []PkgBinary{pkg.Files[0], pkg.Files[2]}
+	if _, n, err := proj.DownloadPackageFiles(pkg, root); err != nil || n != 0 {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+	if bad, err := proj.VerifyLocal([]PackageInfo{pkg}, root); err != nil || len(bad) != 0 {
+		t.Fatalf("got %v, %v", bad, err)
+	}
+
+	// The files are kept compressed by default.
+	proj.Decompress = nil
+	if _, n, err := proj.DownloadPackageFiles(pkg, root); err != nil || n != int64(len(img)) {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(pkgDir, "img.x86_64-1.0.tar.gz")); err != nil || string(data) != img {
+		t.Fatalf("got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,86 @@
+package obsgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RepoDuplicatePolicy selects how DownloadPackageFiles handles a binary file
+// identical to one already downloaded for another repository of the project.
+type RepoDuplicatePolicy int
+
+const (
+	// RepoDuplicatesKeep stores a copy of the file in each repository.
+	RepoDuplicatesKeep RepoDuplicatePolicy = iota
+	// RepoDuplicatesLink replaces the file with a hard link to the identical
+	// file of another repository, with the same package, architecture, name
+	// and SHA-256 checksum, so that it is stored once. Only supported on the
+	// local filesystem with LayoutOBS.
+	RepoDuplicatesLink
+)
+
+// Replaces localFile, the binary file f of pkgInfo with the given checksum,
+// with a hard link to an identical copy downloaded for another repository
+// under root, if any. Errors are only logged, since the copy is still good.
+func (proj *Project) linkRepoDuplicate(root string, pkgInfo PackageInfo, f PkgBinary, localFile, sum string) {
+	entries, err := ioutil.ReadDir(filepath.Join(root, proj.Name))
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		repo := entry.Name()
+		if !entry.IsDir() || repo == pkgInfo.Repo {
+			continue
+		}
+
+		other := pkgInfo
+		other.Repo = repo
+		other.Path = path.Join(repo, pkgInfo.Arch, pkgInfo.Name)
+		candidate := proj.localPath(root, other, f)
+
+		info, err := os.Lstat(candidate)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if local, err := os.Stat(localFile); err != nil || local.Size() != info.Size() || os.SameFile(local, info) {
+			continue
+		}
+		if candidateSum, err := hashFile(FileStorage{}, candidate); err != nil || candidateSum != sum {
+			continue
+		}
+
+		// Link aside and rename, so that localFile is never missing.
+		tmp := localFile + ".link"
+		os.Remove(tmp)
+		err = os.Link(candidate, tmp)
+		if err == nil {
+			err = os.Rename(tmp, localFile)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			logrus.WithFields(logrus.Fields{
+				"filename": localFile,
+				"error":    err,
+			}).Warn("Failed to link OBS file duplicated in another repo")
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"filename": localFile,
+			"target":   candidate,
+		}).Debug("OBS file duplicated in another repo, linked")
+		return
+	}
+}
+
+// Reports whether the files duplicated across repositories are linked, which
+// is only possible with LayoutOBS on the local filesystem.
+func (proj *Project) linkRepoDuplicates() bool {
+	_, local := proj.storage().(FileStorage)
+	return proj.RepoDuplicates == RepoDuplicatesLink && proj.Layout == LayoutOBS && local
+}
@@ -0,0 +1,103 @@
+package obsgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepoDuplicates(t *testing.T) {
+	// Two repositories with the same binaries, but for the debuginfo one.
+	routes := threeRepoRoutes()
+	routes["/build/proj"] = dir("repo1", "repo2")
+	routes["/build/proj/repo2/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm"] = "EEE"
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		policy RepoDuplicatePolicy
+		linked bool
+	}{
+		{RepoDuplicatesKeep, false},
+		{RepoDuplicatesLink, true},
+	} {
+		proj := testProject(srv.URL)
+		proj.RepoDuplicates = tc.policy
+		// The repositories are downloaded one after the other.
+		proj.MirrorWorkers = 1
+		root := t.TempDir()
+		if _, err := proj.Mirror(root); err != nil {
+			t.Fatal(err)
+		}
+
+		stat := func(repo, file string) os.FileInfo {
+			info, err := os.Stat(filepath.Join(root, "proj", repo, "x86_64/pkga", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return info
+		}
+		// Reports whether file is stored once for both repositories.
+		same := func(file string) bool {
+			return os.SameFile(stat("repo1", file), stat("repo2", file))
+		}
+		if same("a-1.0-1.x86_64.rpm") != tc.linked {
+			t.Errorf("policy %v: identical file linked %v", tc.policy, !tc.linked)
+		}
+		if same("a-debuginfo-1.0-1.x86_64.rpm") {
+			t.Errorf("policy %v: different files linked", tc.policy)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(root, "proj/repo2/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm"))
+		if err != nil || string(data) != "EEE" {
+			t.Errorf("policy %v: got %q, %v", tc.policy, data, err)
+		}
+	}
+}
+
+func TestRepoDuplicatesRedownload(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		verifier RPMVerifier
+		want     string
+	}{
+		{"rebuilt", nil, "BBBBBB"},
+		// The rebuilt file is rejected, and the linked one kept.
+		{"rejected", testRPMVerifier, "AAAAA"},
+	} {
+		routes := threeRepoRoutes()
+		routes["/build/proj"] = dir("repo1", "repo2")
+		srv := mockServer(t, routes)
+		proj := testProject(srv.URL)
+		proj.RepoDuplicates = RepoDuplicatesLink
+		proj.MirrorWorkers = 1
+		root := t.TempDir()
+		if _, err := proj.Mirror(root); err != nil {
+			t.Fatal(err)
+		}
+		srv.Close()
+
+		// The file of repo2 is rebuilt, while the one of repo1 is not.
+		routes["/build/proj/repo2/x86_64/pkga"] = `<binarylist><binary filename="a-1.0-1.x86_64.rpm" size="6" mtime="300"/></binarylist>`
+		routes["/build/proj/repo2/x86_64/pkga/a-1.0-1.x86_64.rpm"] = "BBBBBB"
+		srv = mockServer(t, routes)
+		proj.BaseURL = srv.URL
+		proj.RPMVerifier = tc.verifier
+		pkg, err := proj.GetPackage("repo2", "x86_64", "pkga")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = proj.DownloadPackageFiles(pkg, root)
+		srv.Close()
+		if (err == nil) != (tc.verifier == nil) {
+			t.Fatalf("%s: got %v", tc.name, err)
+		}
+
+		for repo, want := range map[string]string{"repo1": "AAAAA", "repo2": tc.want} {
+			data, err := ioutil.ReadFile(filepath.Join(root, "proj", repo, "x86_64/pkga/a-1.0-1.x86_64.rpm"))
+			if err != nil || string(data) != want {
+				t.Errorf("%s: got %q, %v in %s", tc.name, data, err, repo)
+			}
+		}
+	}
+}
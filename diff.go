@@ -0,0 +1,107 @@
+package obsgo
+
+import (
+	"path"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// PackageListDiff reports the changes between two enumerations of a project.
+type PackageListDiff struct {
+	// Packages only present in the new list
+	Added []PackageInfo
+	// Packages only present in the old list
+	Removed []PackageInfo
+	// Packages present in both lists, as found in the new list, whose files
+	// were added, removed or modified
+	Updated []PackageInfo
+}
+
+// Compares two lists of packages, as returned by FindAllPackages, identifying
+// packages by repository, architecture and name, and their files by name and
+// modification time.
+func DiffPackageLists(old, new []PackageInfo) PackageListDiff {
+	var diff PackageListDiff
+
+	oldPkgs := make(map[string]PackageInfo, len(old))
+	for _, pkg := range old {
+		oldPkgs[packageKey(pkg)] = pkg
+	}
+
+	newKeys := make(map[string]bool, len(new))
+	for _, pkg := range new {
+		key := packageKey(pkg)
+		newKeys[key] = true
+
+		oldPkg, ok := oldPkgs[key]
+		if !ok {
+			diff.Added = append(diff.Added, pkg)
+		} else if !sameFiles(oldPkg.Files, pkg.Files) {
+			diff.Updated = append(diff.Updated, pkg)
+		}
+	}
+
+	for _, pkg := range old {
+		if !newKeys[packageKey(pkg)] {
+			diff.Removed = append(diff.Removed, pkg)
+		}
+	}
+
+	return diff
+}
+
+func packageKey(pkg PackageInfo) string {
+	return path.Join(pkg.Repo, pkg.Arch, pkg.Name)
+}
+
+// Reports whether a and b list the same files with the same mtimes.
+func sameFiles(a, b []PkgBinary) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	mtimes := make(map[string]string, len(a))
+	for _, f := range a {
+		mtimes[f.Filename] = f.Mtime
+	}
+	for _, f := range b {
+		if mtime, ok := mtimes[f.Filename]; !ok || mtime != f.Mtime {
+			return false
+		}
+	}
+	return true
+}
+
+// Compares the packages built for the architectures archA and archB of the
+// repository repo, as listed by ListPackages, returning the names of the
+// packages only present in archA and those only present in archB, sorted.
+func (proj *Project) ArchDelta(repo, archA, archB string) (onlyA, onlyB []string, err error) {
+	pkgsA, err := proj.ListPackages(repo, archA)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get list of pkgs for %s/%s", repo, archA)
+	}
+	pkgsB, err := proj.ListPackages(repo, archB)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get list of pkgs for %s/%s", repo, archB)
+	}
+
+	return missingFrom(pkgsA, pkgsB), missingFrom(pkgsB, pkgsA), nil
+}
+
+// Returns the sorted names of a not present in b.
+func missingFrom(a, b []string) []string {
+	names := make(map[string]bool, len(b))
+	for _, name := range b {
+		names[name] = true
+	}
+
+	var missing []string
+	for _, name := range a {
+		if !names[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
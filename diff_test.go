@@ -0,0 +1,93 @@
+package obsgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Returns a package of repo1 with files, given as name and mtime pairs.
+func diffPackage(arch, name string, files ...string) PackageInfo {
+	pkg := PackageInfo{Name: name, Repo: "repo1", Arch: arch}
+	for i := 0; i+1 < len(files); i += 2 {
+		pkg.Files = append(pkg.Files, PkgBinary{Filename: files[i], Mtime: files[i+1]})
+	}
+	return pkg
+}
+
+// Returns the repo/arch/name keys of pkgs.
+func packageKeys(pkgs []PackageInfo) []string {
+	var keys []string
+	for _, pkg := range pkgs {
+		keys = append(keys, packageKey(pkg))
+	}
+	return keys
+}
+
+func TestDiffPackageLists(t *testing.T) {
+	old := []PackageInfo{
+		diffPackage("x86_64", "same", "same.rpm", "1", "same-doc.rpm", "1"),
+		diffPackage("x86_64", "reordered", "a.rpm", "1", "b.rpm", "1"),
+		diffPackage("x86_64", "rebuilt", "rebuilt.rpm", "1"),
+		diffPackage("x86_64", "grown", "grown.rpm", "1"),
+		diffPackage("x86_64", "shrunk", "shrunk.rpm", "1", "shrunk-doc.rpm", "1"),
+		diffPackage("x86_64", "renamed", "renamed-1.rpm", "1"),
+		diffPackage("x86_64", "dropped", "dropped.rpm", "1"),
+		diffPackage("x86_64", "moved", "moved.rpm", "1"),
+	}
+	new := []PackageInfo{
+		diffPackage("x86_64", "same", "same.rpm", "1", "same-doc.rpm", "1"),
+		diffPackage("x86_64", "reordered", "b.rpm", "1", "a.rpm", "1"),
+		diffPackage("x86_64", "rebuilt", "rebuilt.rpm", "2"),
+		diffPackage("x86_64", "grown", "grown.rpm", "1", "grown-doc.rpm", "1"),
+		diffPackage("x86_64", "shrunk", "shrunk.rpm", "1"),
+		diffPackage("x86_64", "renamed", "renamed-2.rpm", "1"),
+		diffPackage("x86_64", "created", "created.rpm", "1"),
+		// Another arch is another package.
+		diffPackage("aarch64", "moved", "moved.rpm", "1"),
+	}
+
+	diff := DiffPackageLists(old, new)
+	for _, tc := range []struct {
+		name      string
+		got, want []string
+	}{
+		{"added", packageKeys(diff.Added), []string{"repo1/x86_64/created", "repo1/aarch64/moved"}},
+		{"removed", packageKeys(diff.Removed), []string{"repo1/x86_64/dropped", "repo1/x86_64/moved"}},
+		{"updated", packageKeys(diff.Updated), []string{"repo1/x86_64/rebuilt", "repo1/x86_64/grown", "repo1/x86_64/shrunk", "repo1/x86_64/renamed"}},
+	} {
+		if !reflect.DeepEqual(tc.got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+	// The updated packages are reported as found in the new list.
+	if len(diff.Updated) > 0 && diff.Updated[0].Files[0].Mtime != "2" {
+		t.Errorf("got updated %+v", diff.Updated[0])
+	}
+
+	if diff := DiffPackageLists(old, old); diff.Added != nil || diff.Removed != nil || diff.Updated != nil {
+		t.Errorf("got %+v for the same list", diff)
+	}
+	if diff := DiffPackageLists(nil, new); len(diff.Added) != len(new) || diff.Removed != nil {
+		t.Errorf("got %+v from an empty list", diff)
+	}
+}
+
+func TestArchDelta(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64"] = dir("pkga", "pkgb", "pkgc", "_repository")
+	routes["/build/proj/repo1/aarch64"] = dir("pkgd", "pkgb", "_repository")
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	onlyA, onlyB, err := proj.ArchDelta("repo1", "x86_64", "aarch64")
+	if err != nil || !reflect.DeepEqual(onlyA, []string{"pkga", "pkgc"}) || !reflect.DeepEqual(onlyB, []string{"pkgd"}) {
+		t.Fatalf("got %v, %v, %v", onlyA, onlyB, err)
+	}
+	if onlyA, onlyB, err := proj.ArchDelta("repo1", "x86_64", "x86_64"); err != nil || onlyA != nil || onlyB != nil {
+		t.Fatalf("got %v, %v, %v for the same arch", onlyA, onlyB, err)
+	}
+	if _, _, err := proj.ArchDelta("repo1", "x86_64", "s390x"); err == nil {
+		t.Fatal("expected an error for a missing arch")
+	}
+}
@@ -0,0 +1,115 @@
+package obsgo
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrEmptyProject is returned by FindAllPackages when Project.RequireNonEmpty
+// is set and no binary file is found in the project.
+var ErrEmptyProject = errors.New("no binaries found in OBS project")
+
+// ErrSyncLost is returned by ChangesSince when the passed token is too old to
+// track the changes that followed it.
+var ErrSyncLost = errors.New("OBS events since token are no longer available")
+
+// ErrUnauthorized matches, via errors.Is, the HTTPError returned when OBS
+// rejects the request credentials with a 401 or 403 status code.
+var ErrUnauthorized = errors.New("OBS authentication failed")
+
+// ErrUnreachable is returned by Ping when no response is received from the
+// OBS server.
+var ErrUnreachable = errors.New("OBS server unreachable")
+
+// ErrNotFound matches, via errors.Is, the HTTPError returned when the
+// requested project, repository or package does not exist.
+var ErrNotFound = errors.New("OBS resource not found")
+
+// ErrMaintenance is returned when OBS answers an API request with an HTML
+// page, as done while the service is under maintenance.
+var ErrMaintenance = errors.New("OBS returned an HTML page, it may be under maintenance")
+
+// ErrBudgetExceeded is returned by DownloadPackageFiles and Mirror when the
+// next file would exceed the Project.ByteBudget.
+var ErrBudgetExceeded = errors.New("OBS download byte budget exceeded")
+
+// ErrLowDiskSpace is returned by DownloadPackageFiles and Mirror when the free
+// disk space drops below the Project.MinFreeBytes.
+var ErrLowDiskSpace = errors.New("free disk space below the minimum")
+
+// ErrLocalFileTooLarge is returned by DownloadPackageFiles and Mirror when a
+// local file is larger than the OBS file and Project.StrictLocalSize is set.
+var ErrLocalFileTooLarge = errors.New("local file larger than the OBS file")
+
+// ErrClosed is returned by the requests of a Project after Close.
+var ErrClosed = errors.New("OBS project closed")
+
+// HTTPError is returned when an OBS API request gets an unexpected HTTP
+// response status code.
+type HTTPError struct {
+	// HTTP response status code
+	StatusCode int
+	// URL of the request
+	URL string
+	// Delay requested by the server with the Retry-After header, if any
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("obsRequest unexpected HTTP response status code: %d", e.StatusCode)
+}
+
+// Is makes errors.Is report authentication failures as ErrUnauthorized, and
+// missing resources as ErrNotFound.
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// BodyReadError is returned when reading the body of an OBS API response
+// fails after the request succeeded, e.g. because the connection dropped.
+type BodyReadError struct {
+	// Path of the requested resource
+	Path string
+	// The read error
+	Err error
+}
+
+func (e *BodyReadError) Error() string {
+	return fmt.Sprintf("failed to read OBS response body of %s: %v", e.Path, e.Err)
+}
+
+// Cause returns the read error, for errors.Cause.
+func (e *BodyReadError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the read error, for errors.Is and errors.As.
+func (e *BodyReadError) Unwrap() error {
+	return e.Err
+}
+
+func isNotFound(err error) bool {
+	httpErr, ok := errors.Cause(err).(*HTTPError)
+	return ok && httpErr.Is(ErrNotFound)
+}
+
+// MultiError groups the errors of operations that go on after a failure.
+type MultiError []error
+
+func (me MultiError) Error() string {
+	msgs := make([]string, 0, len(me))
+	for _, err := range me {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(me), strings.Join(msgs, "; "))
+}
@@ -0,0 +1,154 @@
+package obsgo
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Returns a server answering all the requests with the status code.
+func statusServer(t *testing.T, code int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestErrUnauthorized(t *testing.T) {
+	for _, tc := range []struct {
+		code         int
+		unauthorized bool
+	}{
+		{http.StatusUnauthorized, true},
+		{http.StatusForbidden, true},
+		{http.StatusNotFound, false},
+		{http.StatusInternalServerError, false},
+	} {
+		proj := testProject(statusServer(t, tc.code).URL)
+		_, err := proj.FindAllPackages()
+		if err == nil || errors.Is(err, ErrUnauthorized) != tc.unauthorized {
+			t.Errorf("status %d: got %v", tc.code, err)
+		}
+		// The HTTP error is still available.
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != tc.code {
+			t.Errorf("status %d: got %v", tc.code, err)
+		}
+	}
+}
+
+func TestErrNotFound(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64"] = dir("pkga", "gone", "pkgb")
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	hook := captureLogs(t)
+
+	_, err := proj.GetPackage("repo1", "x86_64", "gone")
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("got %v", err)
+	}
+
+	// A package removed while enumerating is skipped with a warning.
+	pkgs, err := proj.FindAllPackages()
+	if err != nil || len(pkgs) != 2 || pkgs[0].Name != "pkga" || pkgs[1].Name != "pkgb" {
+		t.Fatalf("got %+v, %v", pkgs, err)
+	}
+	if !logged(hook, "OBS package not found, skipping", logrus.Fields{"package": "gone"}) {
+		t.Error("missing package not logged")
+	}
+}
+
+func TestBodyReadError(t *testing.T) {
+	srv := droppingServer(t, basicRoutes(), map[string]int{"/build/proj/repo1/x86_64/pkga": 1})
+	proj := testProject(srv.URL)
+
+	// The connection closed halfway through the body is reported with the
+	// resource path.
+	_, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	var readErr *BodyReadError
+	if !errors.As(err, &readErr) || readErr.Path != "/build/proj/repo1/x86_64/pkga" || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v", err)
+	}
+
+	// Unlike an invalid body.
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga"] = "<binarylist"
+	srv = mockServer(t, routes)
+	defer srv.Close()
+	proj = testProject(srv.URL)
+	if _, err := proj.GetPackage("repo1", "x86_64", "pkga"); err == nil || errors.As(err, &readErr) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestBodyReadErrorAPIs(t *testing.T) {
+	routes := basicRoutes()
+	routes["/source/proj/pkga"] = revisionSourceList
+	routes["/source/proj/_meta"] = metaXML
+	routes["/lastevents"] = lastEventsXML
+	routes["/about"] = aboutXML
+	routes["/published/proj/repo1/repodata/repomd.xml"] = repomdXML
+	routes["/published/proj/repo1/repodata/5f3e1b2c-primary.xml.gz"] = strings.Repeat("x", 100)
+
+	for _, tc := range []struct {
+		path string
+		fn   func(proj *Project) error
+	}{
+		{"/source/proj/pkga", func(proj *Project) error { _, err := proj.SourceFiles("pkga"); return err }},
+		{"/source/proj/_meta", func(proj *Project) error { _, err := proj.Meta(); return err }},
+		{"/lastevents", func(proj *Project) error { _, _, err := proj.ChangesSince(""); return err }},
+		{"/about", func(proj *Project) error { _, err := proj.About(); return err }},
+		{"/published/proj/repo1/repodata/repomd.xml", func(proj *Project) error { _, err := proj.RepoMD("repo1", ""); return err }},
+		{"/published/proj/repo1/repodata/5f3e1b2c-primary.xml.gz", func(proj *Project) error { _, err := proj.Primary("repo1", ""); return err }},
+	} {
+		srv := droppingServer(t, routes, map[string]int{tc.path: 1})
+		err := tc.fn(testProject(srv.URL))
+		var readErr *BodyReadError
+		if !errors.As(err, &readErr) || readErr.Path != tc.path {
+			t.Errorf("%s: got %v", tc.path, err)
+		}
+	}
+
+	// The failed body read is retried.
+	srv := droppingServer(t, routes, map[string]int{"/source/proj/_meta": 1})
+	proj := testProject(srv.URL)
+	proj.MaxRetries = 1
+	if meta, err := proj.Meta(); err != nil || meta.Name != "proj" {
+		t.Fatalf("got %+v, %v", meta, err)
+	}
+}
+
+func TestErrMaintenance(t *testing.T) {
+	const page = "<!DOCTYPE html><html><body>Down for maintenance</body></html>"
+	for _, tc := range []struct {
+		contentType string
+		maintenance bool
+	}{
+		// Detected by net/http.
+		{"", true},
+		{"text/html; charset=utf-8", true},
+		// Not an HTML page, fails parsing.
+		{"application/xml", false},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.contentType != "" {
+				w.Header().Set("Content-Type", tc.contentType)
+			}
+			w.Write([]byte(page))
+		}))
+		defer srv.Close()
+
+		_, err := testProject(srv.URL).ListRepos()
+		if err == nil || errors.Is(err, ErrMaintenance) != tc.maintenance {
+			t.Errorf("content type %q: got %v", tc.contentType, err)
+		}
+	}
+}
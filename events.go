@@ -0,0 +1,68 @@
+package obsgo
+
+import (
+	"context"
+	"encoding/xml"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ChangeEvent is an OBS event reported by the lastevents API.
+type ChangeEvent struct {
+	// Type of the event: "project", "package" or "repository"
+	Type       string `xml:"type,attr"`
+	Project    string `xml:"project"`
+	Package    string `xml:"package"`
+	Repository string `xml:"repository"`
+	Arch       string `xml:"arch"`
+}
+
+type xmlEvents struct {
+	XMLName xml.Name      `xml:"events"`
+	Next    string        `xml:"next,attr"`
+	Sync    string        `xml:"sync,attr"`
+	Events  []ChangeEvent `xml:"event"`
+}
+
+// Returns the events affecting the project that happened since token, together
+// with a new token to pass to the following call. With an empty token no
+// events are returned, only the token to start tracking changes from.
+//
+// ErrSyncLost is returned when token is too old for OBS to know which events
+// followed it, in which case the project must be enumerated again.
+func (proj *Project) ChangesSince(token string) ([]ChangeEvent, string, error) {
+	logrus.WithFields(logrus.Fields{
+		"project": proj.Name,
+		"token":   token,
+	}).Debug("Retrieving OBS last events")
+
+	urlPath := "/lastevents"
+	if token != "" {
+		urlPath += "?" + url.Values{"start": {token}}.Encode()
+	}
+
+	xmlResp, err := proj.readURLPath(context.Background(), urlPath, listingHeader())
+	if err != nil {
+		return nil, token, errors.Wrapf(err, "failed to get last events")
+	}
+
+	var list xmlEvents
+	if err := xml.Unmarshal(xmlResp, &list); err != nil {
+		return nil, token, errors.Wrapf(err, "failed to parse last events")
+	}
+
+	if list.Sync == "lost" {
+		return nil, list.Next, ErrSyncLost
+	}
+
+	var events []ChangeEvent
+	for _, e := range list.Events {
+		if e.Project == proj.Name {
+			events = append(events, e)
+		}
+	}
+
+	return events, list.Next, nil
+}
@@ -0,0 +1,46 @@
+package obsgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+// lastevents responses, as returned by OBS
+const (
+	lastEventsStartXML = `<events next="1000" sync="ok"/>`
+	lastEventsXML      = `<events next="1003" sync="ok">
+  <event type="package"><project>proj</project><package>pkga</package></event>
+  <event type="package"><project>other</project><package>pkgx</package></event>
+  <event type="repository"><project>proj</project><repository>repo1</repository><arch>x86_64</arch></event>
+</events>`
+	lastEventsLostXML = `<events next="2000" sync="lost"/>`
+)
+
+func TestChangesSince(t *testing.T) {
+	srv := mockServer(t, map[string]string{
+		"/lastevents":            lastEventsStartXML,
+		"/lastevents?start=1000": lastEventsXML,
+		"/lastevents?start=10":   lastEventsLostXML,
+	})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	events, token, err := proj.ChangesSince("")
+	if err != nil || len(events) != 0 || token != "1000" {
+		t.Fatalf("got %v, %q, %v", events, token, err)
+	}
+
+	// Only the events of the project are returned.
+	events, token, err = proj.ChangesSince(token)
+	want := []ChangeEvent{
+		{Type: "package", Project: "proj", Package: "pkga"},
+		{Type: "repository", Project: "proj", Repository: "repo1", Arch: "x86_64"},
+	}
+	if err != nil || !reflect.DeepEqual(events, want) || token != "1003" {
+		t.Fatalf("got %+v, %q, %v", events, token, err)
+	}
+
+	if _, token, err = proj.ChangesSince("10"); err != ErrSyncLost || token != "2000" {
+		t.Fatalf("got %q, %v", token, err)
+	}
+}
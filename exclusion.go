@@ -0,0 +1,86 @@
+package obsgo
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Returns the set of the files listed in the ExclusionManifest, indexed by
+// exclusionKey. The manifest is read once and cached by the project.
+func (proj *Project) exclusions() (map[string]bool, error) {
+	if proj.ExclusionManifest == "" {
+		return nil, nil
+	}
+
+	proj.exclusionsMutex.Lock()
+	defer proj.exclusionsMutex.Unlock()
+
+	if proj.excluded != nil {
+		return proj.excluded, nil
+	}
+
+	file, err := os.Open(proj.ExclusionManifest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open exclusion manifest")
+	}
+	defer file.Close()
+
+	excluded := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("invalid line %d of exclusion manifest %s", n, proj.ExclusionManifest)
+		}
+		if isChecksum(fields[0]) {
+			return nil, errors.Errorf("checksum at line %d of exclusion manifest %s, only names and sizes are supported", n, proj.ExclusionManifest)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid size at line %d of exclusion manifest %s", n, proj.ExclusionManifest)
+		}
+		excluded[exclusionKey(path.Base(fields[0]), size)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "could not read exclusion manifest %s", proj.ExclusionManifest)
+	}
+
+	proj.excluded = excluded
+	return excluded, nil
+}
+
+// Reports whether s looks like a hex encoded SHA-256 checksum, as in the
+// lines of a SHA256SUMS file.
+func isChecksum(s string) bool {
+	if len(s) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func exclusionKey(filename string, size int64) string {
+	return filename + " " + strconv.FormatInt(size, 10)
+}
+
+// Reports whether the binary file f is listed in the excluded set. Only the
+// files with an exact size, unknown with the binaryversions view, can match.
+func isExcluded(excluded map[string]bool, f PkgBinary) bool {
+	if len(excluded) == 0 || f.Size == "" {
+		return false
+	}
+	size, err := f.SizeBytes()
+	return err == nil && excluded[exclusionKey(f.Filename, size)]
+}
@@ -0,0 +1,75 @@
+package obsgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Exclusion manifest listing the main file of pkga, and its debuginfo file
+// with another size
+const exclusionManifest = `# upstream mirror
+proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm 5
+
+a-debuginfo-1.0-1.x86_64.rpm 4
+`
+
+func TestExclusionManifest(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	manifest := filepath.Join(t.TempDir(), "manifest")
+	if err := ioutil.WriteFile(manifest, []byte(exclusionManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	proj := testProject(srv.URL)
+	proj.ExclusionManifest = manifest
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	files, n, err := proj.DownloadPackageFiles(pkg, root)
+	if err != nil || n != 3 || len(files) != 1 || filepath.Base(files[0]) != "a-debuginfo-1.0-1.x86_64.rpm" {
+		t.Fatalf("got %v, %d bytes, %v", files, n, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm")); !os.IsNotExist(err) {
+		t.Fatalf("got %v for the excluded file", err)
+	}
+}
+
+func TestExclusionManifestInvalid(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	dir := t.TempDir()
+
+	for _, tc := range []struct {
+		name, manifest string
+		valid          bool
+	}{
+		{"empty", "", true},
+		// The listed directories are ignored.
+		{"directory", "some/dir/a-1.0-1.x86_64.rpm 5\n", true},
+		{"fields", "a-1.0-1.x86_64.rpm\n", false},
+		{"size", "a-1.0-1.x86_64.rpm five\n", false},
+		{"checksum", sha256Hex("AAAAA") + "  a-1.0-1.x86_64.rpm\n", false},
+	} {
+		manifest := filepath.Join(dir, tc.name)
+		if err := ioutil.WriteFile(manifest, []byte(tc.manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+		proj := testProject(srv.URL)
+		proj.ExclusionManifest = manifest
+		if _, err := proj.exclusions(); (err == nil) != tc.valid {
+			t.Errorf("%s: got %v", tc.name, err)
+		}
+	}
+
+	proj := testProject(srv.URL)
+	proj.ExclusionManifest = filepath.Join(dir, "missing")
+	pkg := PackageInfo{Path: "repo1/x86_64/pkga", Files: []PkgBinary{{Filename: "a-1.0-1.x86_64.rpm", Size: "5"}}}
+	if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err == nil {
+		t.Fatal("expected an error for a missing manifest")
+	}
+}
@@ -0,0 +1,46 @@
+package obsgo
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Returns an error satisfying ErrLowDiskSpace when the free space of the
+// local filesystem where the files are downloaded under root is below
+// MinFreeBytes.
+func (proj *Project) checkFreeSpace(root string) error {
+	if proj.MinFreeBytes <= 0 {
+		return nil
+	}
+	if _, ok := proj.storage().(FileStorage); !ok {
+		return nil
+	}
+
+	// The root directory may not have been created yet.
+	dir := root
+	for {
+		if _, err := os.Stat(dir); err == nil || !os.IsNotExist(err) {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	freeSpace := proj.FreeSpace
+	if freeSpace == nil {
+		freeSpace = diskFreeSpace
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		return errors.Wrapf(err, "could not get free space of %s", dir)
+	}
+	if free < proj.MinFreeBytes {
+		return errors.Wrapf(ErrLowDiskSpace, "%d bytes free in %s, %d required", free, dir, proj.MinFreeBytes)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package obsgo
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// Returns the bytes available on the filesystem of path, which is not
+// supported on this platform: Project.FreeSpace must be set.
+func diskFreeSpace(path string) (int64, error) {
+	return 0, errors.Errorf("free disk space not supported on %s", runtime.GOOS)
+}
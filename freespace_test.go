@@ -0,0 +1,62 @@
+package obsgo
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestMinFreeBytes(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	root := t.TempDir()
+
+	// Each download uses 5 bytes of the free space.
+	free := int64(103)
+	proj := testProject(srv.URL)
+	proj.MinFreeBytes = 100
+	proj.MirrorWorkers = 1
+	proj.FreeSpace = func(path string) (int64, error) {
+		if path != root {
+			t.Errorf("got free space of %s", path)
+		}
+		f := free
+		free -= 5
+		return f, nil
+	}
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _, err := proj.DownloadPackageFiles(pkg, root)
+	if !errors.Is(err, ErrLowDiskSpace) || len(files) != 1 {
+		t.Fatalf("got %v, %v", files, err)
+	}
+
+	free = 50
+	if _, err := proj.Mirror(root); !errors.Is(err, ErrLowDiskSpace) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	root := t.TempDir()
+	proj := testProject("")
+	for _, tc := range []struct {
+		min  int64
+		path string
+		low  bool
+	}{
+		{0, root, false},
+		{1, root, false},
+		// The free space of the existing parent of a missing root.
+		{1, filepath.Join(root, "missing/dir"), false},
+		{1 << 62, root, true},
+		{1 << 62, filepath.Join(root, "missing/dir"), true},
+	} {
+		proj.MinFreeBytes = tc.min
+		if err := proj.checkFreeSpace(tc.path); (err != nil) != tc.low || (tc.low && !errors.Is(err, ErrLowDiskSpace)) {
+			t.Errorf("%d bytes in %s: got %v", tc.min, tc.path, err)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package obsgo
+
+import (
+	"syscall"
+)
+
+// Returns the bytes available to unprivileged users on the filesystem of path.
+func diskFreeSpace(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,103 @@
+package obsgo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Name of the JSON index written in each directory by WriteDirIndexes
+const dirIndexFileName = "index.json"
+
+// DirIndexEntry describes a file or a subdirectory in the JSON index written
+// by WriteDirIndexes.
+type DirIndexEntry struct {
+	Name  string `json:"name"`
+	Dir   bool   `json:"dir"`
+	Size  int64  `json:"size"`
+	Mtime int64  `json:"mtime"`
+}
+
+// DirIndex is the JSON index written by WriteDirIndexes in each directory.
+type DirIndex struct {
+	Entries []DirIndexEntry `json:"entries"`
+}
+
+// WriteDirIndexes walks the local tree under root, e.g. as downloaded by
+// DownloadPackageFiles, and writes in each directory an index.json file with
+// the DirIndex of its entries, sorted by name, for static file browsers.
+// Hidden files, such as the partial downloads, are not listed.
+func WriteDirIndexes(root string) error {
+	return filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrapf(err, "Failed to walk %s", dir)
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if dir != root && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return writeDirIndex(dir)
+	})
+}
+
+// Writes the index.json file of the local directory dir.
+func writeDirIndex(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read directory")
+	}
+
+	index := DirIndex{Entries: []DirIndexEntry{}}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == dirIndexFileName || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		// Symlinks, as those of LayoutObjects, are listed with the size and
+		// mtime of their target.
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				entry = target
+			}
+		}
+		index.Entries = append(index.Entries, DirIndexEntry{
+			Name:  name,
+			Dir:   entry.IsDir(),
+			Size:  entry.Size(),
+			Mtime: entry.ModTime().Unix(),
+		})
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode index of %s", dir)
+	}
+
+	// Written aside and renamed, so that the index is never seen partially
+	// written by the HTTP server.
+	tmp, err := ioutil.TempFile(dir, "."+dirIndexFileName)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create index file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "Failed to write index file %s", tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to write index file %s", tmp.Name())
+	}
+	// Readable by the HTTP server, as the downloaded files.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return errors.Wrapf(err, "Failed to write index file %s", tmp.Name())
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(dir, dirIndexFileName))
+}
@@ -0,0 +1,82 @@
+package obsgo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Returns the entries of the index.json file of the local directory dir.
+func readDirIndex(t *testing.T, dir string) []DirIndexEntry {
+	data, err := ioutil.ReadFile(filepath.Join(dir, dirIndexFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index DirIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	return index.Entries
+}
+
+func TestWriteDirIndexes(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	for _, layout := range []Layout{LayoutOBS, LayoutObjects} {
+		root := t.TempDir()
+		proj := testProject(srv.URL)
+		proj.Layout = layout
+		if _, err := proj.Mirror(root); err != nil {
+			t.Fatal(err)
+		}
+		pkgDir := filepath.Join(root, "proj/repo1/x86_64/pkga")
+		for _, name := range []string{"a-1.0-1.x86_64.rpm", "a-debuginfo-1.0-1.x86_64.rpm"} {
+			if err := os.Chtimes(filepath.Join(pkgDir, name), time.Unix(100, 0), time.Unix(100, 0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ioutil.WriteFile(filepath.Join(pkgDir, "a-2.0-1.x86_64.rpm.part"), []byte("A"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		hidden := filepath.Join(root, "proj/.hidden")
+		if err := os.Mkdir(hidden, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		// Written again over the existing indexes.
+		for i := 0; i < 2; i++ {
+			if err := WriteDirIndexes(root); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The symlinks of LayoutObjects are listed as the files they link to.
+		want := []DirIndexEntry{
+			{Name: "a-1.0-1.x86_64.rpm", Size: 5, Mtime: 100},
+			{Name: "a-debuginfo-1.0-1.x86_64.rpm", Size: 3, Mtime: 100},
+		}
+		if got := readDirIndex(t, pkgDir); !reflect.DeepEqual(got, want) {
+			t.Errorf("layout %v: got %+v", layout, got)
+		}
+		if got := readDirIndex(t, filepath.Join(root, "proj/repo1/x86_64")); len(got) != 2 || got[0].Name != "pkga" || !got[0].Dir || got[1].Name != "pkgb" {
+			t.Errorf("layout %v: got %+v", layout, got)
+		}
+		if _, err := os.Stat(filepath.Join(hidden, dirIndexFileName)); !os.IsNotExist(err) {
+			t.Errorf("layout %v: got %v", layout, err)
+		}
+	}
+
+	// An empty directory has an empty list of entries.
+	root := t.TempDir()
+	if err := WriteDirIndexes(root); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDirIndex(t, root); got == nil || len(got) != 0 {
+		t.Errorf("got %+v", got)
+	}
+}
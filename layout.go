@@ -0,0 +1,142 @@
+package obsgo
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Layout selects how downloaded files are arranged under the root directory.
+type Layout int
+
+const (
+	// LayoutOBS stores files as <project>/<repo>/<arch>/<package>/<file>,
+	// like the OBS build results tree.
+	LayoutOBS Layout = iota
+	// LayoutDebianPool stores .deb files in the pool of an apt archive, as
+	// <project>/pool/main/<prefix>/<package>/<file>, where prefix is the
+	// first letter of the package name, or its first four letters for
+	// packages starting with "lib". The dists/<suite>/main/binary-<arch>
+	// directories are created for the index files, with the suite of the
+	// repo returned by Project.Suite. Other files are stored as in
+	// LayoutOBS. OBS builds files with the same name but different content
+	// for each distribution repo, only one of which is kept in the shared
+	// pool: use LayoutDebianSuitePools to mirror several of them.
+	LayoutDebianPool
+	// LayoutDebianSuitePools is LayoutDebianPool with a pool per suite, as
+	// <project>/pool/<suite>/main/<prefix>/<package>/<file>, so that the
+	// files built with the same name for several distribution repos are
+	// all kept. The apt tools generating the indexes must then be run on
+	// the pool of each suite.
+	LayoutDebianSuitePools
+	// LayoutObjects stores each file once, named after its SHA-256
+	// checksum, as objects/<sha256[:2]>/<sha256> under the root directory,
+	// so that identical files of all the projects mirrored under the same
+	// root are shared. The LayoutOBS paths are symlinks to the objects.
+	// Only supported on the local filesystem.
+	LayoutObjects
+)
+
+// Reports whether the .deb files are stored in a Debian pool.
+func (proj *Project) debianPool() bool {
+	return proj.Layout == LayoutDebianPool || proj.Layout == LayoutDebianSuitePools
+}
+
+// Returns the path where the file f of package pkgInfo is stored under root.
+// The decompressed files are stored without their compression extension.
+func (proj *Project) localPath(root string, pkgInfo PackageInfo, f PkgBinary) string {
+	if proj.debianPool() && strings.HasSuffix(f.Filename, ".deb") {
+		pool := filepath.Join(root, proj.Name, "pool")
+		if proj.Layout == LayoutDebianSuitePools {
+			pool = filepath.Join(pool, proj.Suite(pkgInfo.Repo))
+		}
+		return filepath.Join(pool, "main", poolPrefix(pkgInfo.Name), pkgInfo.Name, f.Filename)
+	}
+	filename := f.Filename
+	if dec, ext := proj.decompressor(filename); dec != nil {
+		filename = strings.TrimSuffix(filename, ext)
+	}
+	return filepath.Join(root, proj.Name, path.Join(proj.localPkgPath(pkgInfo), filename))
+}
+
+// Moves the downloaded file tmpFile, with the given checksum, into the objects
+// store under root, unless it already holds the same content, and links it
+// from localFile.
+func storeObject(root, tmpFile, sum, localFile string) error {
+	object := filepath.Join(root, "objects", sum[:2], sum)
+	_, err := os.Stat(object)
+	switch {
+	case err == nil:
+		err = os.Remove(tmpFile)
+	case os.IsNotExist(err):
+		if err = os.MkdirAll(filepath.Dir(object), 0700); err == nil {
+			err = os.Rename(tmpFile, object)
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not store object %s", object)
+	}
+
+	if err := os.Remove(localFile); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "could not replace local file %s", localFile)
+	}
+	target, err := filepath.Rel(filepath.Dir(localFile), object)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, localFile)
+}
+
+// Returns the root directory of the files of the packages built for arch, as
+// chosen by ArchRoot when set, or root otherwise. On the local filesystem, the
+// chosen root must be an existing directory.
+func (proj *Project) archRoot(root, arch string) (string, error) {
+	if proj.ArchRoot == nil {
+		return root, nil
+	}
+
+	if proj.NormalizeArchs {
+		arch = CanonicalArch(arch)
+	}
+	archRoot := proj.ArchRoot(arch)
+	if archRoot == "" {
+		return "", errors.Errorf("no root directory for arch %s", arch)
+	}
+	if _, ok := proj.storage().(FileStorage); ok {
+		info, err := os.Stat(archRoot)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid root directory for arch %s", arch)
+		}
+		if !info.IsDir() {
+			return "", errors.Errorf("root %s for arch %s is not a directory", archRoot, arch)
+		}
+	}
+	return archRoot, nil
+}
+
+// Returns the directory of the Debian pool where files of the package name
+// are stored.
+func poolPrefix(name string) string {
+	if strings.HasPrefix(name, "lib") && len(name) > 3 {
+		return name[:4]
+	}
+	if name == "" {
+		return "_"
+	}
+	return name[:1]
+}
+
+// Creates the dists directory for the suite of the repo and the arch of
+// pkgInfo. Directories are only created on the local filesystem, in other
+// storages they are implied by the files paths.
+func (proj *Project) prepareDists(root string, pkgInfo PackageInfo) error {
+	if _, ok := proj.storage().(FileStorage); !ok {
+		return nil
+	}
+
+	arch := DebianArch(pkgInfo.Arch)
+	return os.MkdirAll(filepath.Join(root, proj.Name, "dists", proj.Suite(pkgInfo.Repo), "main", "binary-"+arch), 0700)
+}
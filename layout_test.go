@@ -0,0 +1,192 @@
+package obsgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLocalPathDebianPool(t *testing.T) {
+	for _, tc := range []struct {
+		layout          Layout
+		pkg, file, want string
+	}{
+		{LayoutDebianPool, "foo", "foo_1.0_amd64.deb", "/mirror/proj/pool/main/f/foo/foo_1.0_amd64.deb"},
+		{LayoutDebianPool, "libfoo", "libfoo1_1.0_amd64.deb", "/mirror/proj/pool/main/libf/libfoo/libfoo1_1.0_amd64.deb"},
+		{LayoutDebianPool, "lib", "lib_1.0_all.deb", "/mirror/proj/pool/main/l/lib/lib_1.0_all.deb"},
+		{LayoutDebianSuitePools, "foo", "foo_1.0_amd64.deb", "/mirror/proj/pool/bookworm/main/f/foo/foo_1.0_amd64.deb"},
+		// Only the .deb files go into the pool.
+		{LayoutDebianPool, "foo", "foo_1.0.dsc", "/mirror/proj/Debian_12/x86_64/foo/foo_1.0.dsc"},
+		{LayoutDebianSuitePools, "foo", "foo_1.0.dsc", "/mirror/proj/Debian_12/x86_64/foo/foo_1.0.dsc"},
+	} {
+		proj := &Project{Name: "proj", Layout: tc.layout}
+		pkgInfo := PackageInfo{Name: tc.pkg, Path: "Debian_12/x86_64/" + tc.pkg, Repo: "Debian_12", Arch: "x86_64"}
+		if got := proj.localPath("/mirror", pkgInfo, PkgBinary{Filename: tc.file}); got != tc.want {
+			t.Errorf("layout %v, %s: got %s, want %s", tc.layout, tc.file, got, tc.want)
+		}
+	}
+}
+
+func TestDownloadPackageFilesDebianPool(t *testing.T) {
+	// The same file name is built with a different content for each
+	// distribution.
+	srv := mockServer(t, map[string]string{
+		"/build/proj/Debian_11/x86_64/foo":                   `<binarylist><binary filename="foo_1.0_amd64.deb" size="2" mtime="1"/></binarylist>`,
+		"/build/proj/Debian_11/x86_64/foo/foo_1.0_amd64.deb": "11",
+		"/build/proj/Debian_12/x86_64/foo":                   `<binarylist><binary filename="foo_1.0_amd64.deb" size="2" mtime="1"/></binarylist>`,
+		"/build/proj/Debian_12/x86_64/foo/foo_1.0_amd64.deb": "12",
+	})
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		layout Layout
+		// Bytes downloaded for each repo
+		bytes []int64
+		// Contents of the pool files, by pool directory
+		pools map[string]string
+	}{
+		// The file of the first distribution is kept in the shared pool.
+		{LayoutDebianPool, []int64{2, 0}, map[string]string{"pool/main": "11"}},
+		{LayoutDebianSuitePools, []int64{2, 2}, map[string]string{"pool/bullseye/main": "11", "pool/bookworm/main": "12"}},
+	} {
+		proj := testProject(srv.URL)
+		proj.Layout = tc.layout
+		root := t.TempDir()
+		for i, repo := range []string{"Debian_11", "Debian_12"} {
+			pkg, err := proj.GetPackage(repo, "x86_64", "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, n, err := proj.DownloadPackageFiles(pkg, root); err != nil || n != tc.bytes[i] {
+				t.Fatalf("layout %v, %s: got %d bytes, %v", tc.layout, repo, n, err)
+			}
+		}
+
+		for pool, want := range tc.pools {
+			data, err := ioutil.ReadFile(filepath.Join(root, "proj", pool, "f/foo/foo_1.0_amd64.deb"))
+			if err != nil || string(data) != want {
+				t.Errorf("layout %v, %s: got %q, %v", tc.layout, pool, data, err)
+			}
+		}
+		for _, suite := range []string{"bullseye", "bookworm"} {
+			info, err := os.Stat(filepath.Join(root, "proj/dists", suite, "main/binary-amd64"))
+			if err != nil || !info.IsDir() {
+				t.Errorf("layout %v, %s: dists directory missing, %v", tc.layout, suite, err)
+			}
+		}
+	}
+}
+
+func TestArchRoot(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1"] = dir("x86_64", "aarch64")
+	routes["/build/proj/repo1/aarch64"] = dir("pkgc")
+	routes["/build/proj/repo1/aarch64/pkgc"] = testBinaryList("c-1.0-1.aarch64.rpm")
+	routes["/build/proj/repo1/aarch64/pkgc/c-1.0-1.aarch64.rpm"] = "C"
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	x86Root, armRoot := t.TempDir(), t.TempDir()
+	proj := testProject(srv.URL)
+	proj.ArchRoot = func(arch string) string {
+		if arch == "x86_64" {
+			return x86Root
+		}
+		return armRoot
+	}
+	if _, err := proj.Mirror(filepath.Join(t.TempDir(), "unused")); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{
+		filepath.Join(x86Root, "proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm"),
+		filepath.Join(armRoot, "proj/repo1/aarch64/pkgc/c-1.0-1.aarch64.rpm"),
+	} {
+		if _, err := os.Stat(file); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, file := range []string{
+		filepath.Join(armRoot, "proj/repo1/x86_64"),
+		filepath.Join(x86Root, "proj/repo1/aarch64"),
+	} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s: got %v", file, err)
+		}
+	}
+
+	// The chosen roots must be existing directories.
+	notDir := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, root := range []string{"", filepath.Join(t.TempDir(), "missing"), notDir} {
+		proj.ArchRoot = func(string) string { return root }
+		pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err == nil {
+			t.Errorf("root %q: expected an error", root)
+		}
+	}
+}
+
+func TestLayoutObjects(t *testing.T) {
+	// Two projects, whose debuginfo files have different contents.
+	routes := basicRoutes()
+	for p, body := range basicRoutes() {
+		routes[strings.Replace(p, "/build/proj", "/build/other", 1)] = body
+	}
+	routes["/build/other/repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm"] = "EEE"
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	root := t.TempDir()
+	for _, name := range []string{"proj", "other"} {
+		proj := testProject(srv.URL)
+		proj.Name = name
+		proj.Layout = LayoutObjects
+		if summary, err := proj.Mirror(root); err != nil || summary.Bytes != 8 {
+			t.Fatalf("%s: got %+v, %v", name, summary, err)
+		}
+	}
+
+	// The identical contents are stored once.
+	objects, err := filepath.Glob(filepath.Join(root, "objects/*/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(root, "objects", sha256Hex("")[:2], sha256Hex("")),
+		filepath.Join(root, "objects", sha256Hex("AAAAA")[:2], sha256Hex("AAAAA")),
+		filepath.Join(root, "objects", sha256Hex("DDD")[:2], sha256Hex("DDD")),
+		filepath.Join(root, "objects", sha256Hex("EEE")[:2], sha256Hex("EEE")),
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(objects, want) {
+		t.Fatalf("got objects %v", objects)
+	}
+
+	// The human-readable layout is a tree of symlinks.
+	for _, name := range []string{"proj", "other"} {
+		file := filepath.Join(root, name, "repo1/x86_64/pkga/a-1.0-1.x86_64.rpm")
+		info, err := os.Lstat(file)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("%s: got %v, %v", name, info, err)
+		}
+		if data, err := ioutil.ReadFile(file); err != nil || string(data) != "AAAAA" {
+			t.Fatalf("%s: got %q, %v", name, data, err)
+		}
+	}
+
+	// The stored files are not downloaded again.
+	proj := testProject(srv.URL)
+	proj.Layout = LayoutObjects
+	if summary, err := proj.Mirror(root); err != nil || summary.Bytes != 0 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+}
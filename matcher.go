@@ -0,0 +1,62 @@
+package obsgo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BinaryMatcher decides which of the binary files listed for a package are
+// returned by PackageBinaries.
+type BinaryMatcher interface {
+	// Match returns true when the binary file is selected.
+	Match(b PkgBinary) bool
+}
+
+// RegexpMatcher is a BinaryMatcher selecting the binary files whose name
+// matches Regexp.
+type RegexpMatcher struct {
+	Regexp *regexp.Regexp
+}
+
+// Match returns true when the binary filename matches the regular expression.
+func (m RegexpMatcher) Match(b PkgBinary) bool {
+	return m.Regexp.MatchString(b.Filename)
+}
+
+// Returns the BinaryMatcher of the project. When none is set, the default
+// matcher selects the rpm and deb packages built for arch, including its RPM
+// aliases such as i686 for i586, or noarch/all, and when IncludeContainers is
+// set, the container images built for arch. The arch is only canonicalized,
+// e.g. from "amd64", when NormalizeArchs is set.
+// When IncludeSignatures is set, their detached signatures are selected too.
+func (proj *Project) matcher(arch string) (BinaryMatcher, error) {
+	if proj.Matcher != nil {
+		return proj.Matcher, nil
+	}
+
+	rpmArch := arch
+	if proj.NormalizeArchs {
+		rpmArch = CanonicalArch(arch)
+	}
+	debArch, ok := debArchitectures[rpmArch]
+	if !ok {
+		return nil, errors.Errorf("Cannot find corresponding debian architecture to %s", arch)
+	}
+	rpmArchs := append([]string{"noarch", rpmArch}, rpmArchAliases[rpmArch]...)
+	debExtensionRE := fmt.Sprintf(`_(all|%s)\.deb`, debArch)
+	rpmExtensionRE := fmt.Sprintf(`\.(%s)\.rpm`, strings.Join(rpmArchs, "|"))
+	binaryPackageRE := fmt.Sprintf(`(%s|%s)`, rpmExtensionRE, debExtensionRE)
+	if proj.IncludeContainers {
+		containerRE := fmt.Sprintf(`\.%s-[^/]*\.tar(\.gz|\.xz)?`, regexp.QuoteMeta(arch))
+		binaryPackageRE = fmt.Sprintf(`(%s|%s|%s)`, rpmExtensionRE, debExtensionRE, containerRE)
+	}
+	if proj.IncludeSignatures {
+		binaryPackageRE += `(\.asc|\.sig)?`
+	}
+	binaryPackageRE += "$"
+
+	return RegexpMatcher{Regexp: regexp.MustCompile(binaryPackageRE)}, nil
+}
@@ -0,0 +1,189 @@
+package obsgo
+
+import (
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// Binary list of a multibuild kiwi container flavor, as published by OBS
+const containerBinaryList = `<binarylist>
+  <binary filename="_buildenv" size="7297" mtime="1620000000"/>
+  <binary filename="_channel" size="64" mtime="1620000000"/>
+  <binary filename="_log" size="102883" mtime="1620000000"/>
+  <binary filename="_statistics" size="1049" mtime="1620000000"/>
+  <binary filename="opensuse-tumbleweed-image.x86_64-1.0.0-Build3.1.docker.tar" size="40302592" mtime="1620000000"/>
+  <binary filename="opensuse-tumbleweed-image.x86_64-1.0.0-Build3.1.docker.tar.xz" size="24902592" mtime="1620000000"/>
+  <binary filename="opensuse-tumbleweed-image.x86_64-1.0.0-Build3.1.packages" size="8781" mtime="1620000000"/>
+  <binary filename="opensuse-tumbleweed-image.x86_64-1.0.0-Build3.1.verified" size="1234" mtime="1620000000"/>
+  <binary filename="opensuse-tumbleweed-image.aarch64-1.0.0-Build3.1.docker.tar" size="40302592" mtime="1620000000"/>
+  <binary filename="opensuse-tumbleweed-image.x86_64-1.0.0-Build3.1.docker.tar.sha256" size="140" mtime="1620000000"/>
+  <binary filename="bash-5.1-1.1.x86_64.rpm" size="1000" mtime="1620000000"/>
+</binarylist>`
+
+func TestPackageBinariesContainers(t *testing.T) {
+	srv := mockServer(t, map[string]string{
+		"/build/proj/containers":                                dir("x86_64"),
+		"/build/proj/containers/x86_64":                         dir("tumbleweed-image", "tumbleweed-image:docker"),
+		"/build/proj/containers/x86_64/tumbleweed-image":        "<binarylist/>",
+		"/build/proj/containers/x86_64/tumbleweed-image:docker": containerBinaryList,
+	})
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		containers bool
+		files      []string
+	}{
+		{false, []string{"bash-5.1-1.1.x86_64.rpm"}},
+		{true, []string{
+			"bash-5.1-1.1.x86_64.rpm",
+			"opensuse-tumbleweed-image.x86_64-1.0.0-Build3.1.docker.tar",
+			"opensuse-tumbleweed-image.x86_64-1.0.0-Build3.1.docker.tar.xz",
+		}},
+	} {
+		proj := testProject(srv.URL)
+		proj.IncludeContainers = tc.containers
+
+		pkgs, err := proj.ListPackages("containers", "x86_64")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The multibuild flavor is listed as a separate package.
+		if !reflect.DeepEqual(pkgs, []string{"tumbleweed-image", "tumbleweed-image:docker"}) {
+			t.Fatalf("unexpected packages %v", pkgs)
+		}
+
+		pkg := PackageInfo{Repo: "containers", Arch: "x86_64", Name: "tumbleweed-image:docker"}
+		if err := proj.PackageBinaries(&pkg); err != nil {
+			t.Fatal(err)
+		}
+		if got := fileNames(pkg.Files); !reflect.DeepEqual(got, tc.files) {
+			t.Errorf("IncludeContainers %v: got %v", tc.containers, got)
+		}
+	}
+}
+
+// An example BinaryMatcher, selecting the files of at least min bytes.
+type sizeMatcher struct {
+	min int
+}
+
+func (m sizeMatcher) Match(b PkgBinary) bool {
+	size, err := strconv.Atoi(b.Size)
+	return err == nil && size >= m.min
+}
+
+func TestMatcher(t *testing.T) {
+	srv := mockServer(t, map[string]string{
+		"/build/proj/repo1/x86_64/pkga": `<binarylist>
+  <binary filename="a-1.0-1.x86_64.rpm" size="5" mtime="100"/>
+  <binary filename="a-1.0-1.aarch64.rpm" size="5" mtime="100"/>
+  <binary filename="a-doc-1.0-1.noarch.rpm" size="1" mtime="100"/>
+  <binary filename="a_1.0_amd64.deb" size="3" mtime="100"/>
+  <binary filename="a-1.0-1.src.rpm" size="9" mtime="100"/>
+  <binary filename="_log" size="9" mtime="100"/>
+</binarylist>`,
+	})
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name    string
+		matcher BinaryMatcher
+		files   []string
+	}{
+		{"default", nil, []string{"a-1.0-1.x86_64.rpm", "a-doc-1.0-1.noarch.rpm", "a_1.0_amd64.deb"}},
+		{"regexp", RegexpMatcher{Regexp: regexp.MustCompile(`\.src\.rpm$`)}, []string{"a-1.0-1.src.rpm"}},
+		{"size", sizeMatcher{min: 5}, []string{"_log", "a-1.0-1.aarch64.rpm", "a-1.0-1.src.rpm", "a-1.0-1.x86_64.rpm"}},
+	} {
+		proj := testProject(srv.URL)
+		proj.Matcher = tc.matcher
+		pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+		if err := proj.PackageBinaries(&pkg); err != nil {
+			t.Fatal(err)
+		}
+		if got := fileNames(pkg.Files); !reflect.DeepEqual(got, tc.files) {
+			t.Errorf("%s: got %v", tc.name, got)
+		}
+	}
+}
+
+func TestMatcherArchs(t *testing.T) {
+	for _, tc := range []struct {
+		arch      string
+		normalize bool
+		file      string
+		match     bool
+		err       bool
+	}{
+		{"x86_64", false, "a-1.0-1.x86_64.rpm", true, false},
+		{"x86_64", false, "a_1.0_amd64.deb", true, false},
+		{"x86_64", false, "a-1.0-1.noarch.rpm", true, false},
+		{"x86_64", false, "a_1.0_all.deb", true, false},
+		{"x86_64", false, "a-1.0-1.i686.rpm", false, false},
+		// The RPM arch aliases of the repository arch.
+		{"i586", false, "a-1.0-1.i686.rpm", true, false},
+		{"i586", false, "a-1.0-1.i586.rpm", true, false},
+		{"i586", false, "a_1.0_i386.deb", true, false},
+		{"armv7l", false, "a-1.0-1.armv7hl.rpm", true, false},
+		{"armv7l", false, "a_1.0_armhf.deb", true, false},
+		{"aarch64", false, "a-1.0-1.armv7hl.rpm", false, false},
+		// Debian names of the repository arch are only known when
+		// normalizing.
+		{"amd64", false, "a_1.0_amd64.deb", false, true},
+		{"amd64", true, "a_1.0_amd64.deb", true, false},
+		{"amd64", true, "a-1.0-1.x86_64.rpm", true, false},
+		{"arm64", true, "a-1.0-1.aarch64.rpm", true, false},
+	} {
+		proj := &Project{NormalizeArchs: tc.normalize}
+		m, err := proj.matcher(tc.arch)
+		if (err != nil) != tc.err {
+			t.Errorf("%s, normalize %v: got %v", tc.arch, tc.normalize, err)
+			continue
+		}
+		if err == nil && m.Match(PkgBinary{Filename: tc.file}) != tc.match {
+			t.Errorf("%s, normalize %v: %s matched %v", tc.arch, tc.normalize, tc.file, !tc.match)
+		}
+	}
+}
+
+func TestIncludeSignatures(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga"] = testBinaryList(
+		"a-1.0-1.x86_64.rpm", "a-1.0-1.x86_64.rpm.asc", "a_1.0_amd64.deb.sig", "a.asc", "a-1.0-1.x86_64.rpm.asc.bak", "_log")
+	routes["/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm.asc"] = "S"
+	routes["/build/proj/repo1/x86_64/pkga/a_1.0_amd64.deb.sig"] = "T"
+	routes["/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm"] = "A"
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		signatures bool
+		files      []string
+	}{
+		{false, []string{"a-1.0-1.x86_64.rpm"}},
+		{true, []string{"a-1.0-1.x86_64.rpm", "a-1.0-1.x86_64.rpm.asc", "a_1.0_amd64.deb.sig"}},
+	} {
+		proj := testProject(srv.URL)
+		proj.IncludeSignatures = tc.signatures
+		pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fileNames(pkg.Files); !reflect.DeepEqual(got, tc.files) {
+			t.Fatalf("signatures %v: got %v", tc.signatures, got)
+		}
+
+		// The signatures are downloaded next to their binaries.
+		files, _, err := proj.DownloadPackageFiles(pkg, t.TempDir())
+		if err != nil || len(files) != len(tc.files) {
+			t.Fatalf("signatures %v: got %v, %v", tc.signatures, files, err)
+		}
+		for _, f := range files {
+			if filepath.Dir(f) != filepath.Dir(files[0]) {
+				t.Errorf("signatures %v: got %v", tc.signatures, files)
+			}
+		}
+	}
+}
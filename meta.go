@@ -0,0 +1,219 @@
+package obsgo
+
+import (
+	"context"
+	"encoding/xml"
+	"path"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ProjectMeta is the parsed content of the project _meta configuration.
+type ProjectMeta struct {
+	XMLName      xml.Name         `xml:"project"`
+	Name         string           `xml:"name,attr"`
+	Title        string           `xml:"title"`
+	Description  string           `xml:"description"`
+	Repositories []MetaRepository `xml:"repository"`
+}
+
+// MetaRepository is a repository configured in the project _meta.
+type MetaRepository struct {
+	// Name of the repository
+	Name string `xml:"name,attr"`
+	// Repositories this one builds against
+	Paths []MetaPath `xml:"path"`
+	// Architectures configured for the repository
+	Archs []string `xml:"arch"`
+}
+
+// MetaPath references a repository of a project.
+type MetaPath struct {
+	Project    string `xml:"project,attr"`
+	Repository string `xml:"repository,attr"`
+}
+
+// Returns the parsed project _meta configuration.
+func (proj *Project) Meta() (ProjectMeta, error) {
+	return proj.meta(context.Background())
+}
+
+func (proj *Project) meta(ctx context.Context) (ProjectMeta, error) {
+	var meta ProjectMeta
+
+	logrus.WithFields(logrus.Fields{
+		"project": proj.Name,
+	}).Debug("Retrieving OBS project _meta")
+
+	xmlResp, err := proj.readURLPath(ctx, path.Join("/source", proj.Name, "_meta"), listingHeader())
+	if err != nil {
+		return meta, errors.Wrapf(err, "failed to get _meta for project %s", proj.Name)
+	}
+
+	if err := xml.Unmarshal(xmlResp, &meta); err != nil {
+		return meta, errors.Wrapf(err, "failed to parse _meta for project %s", proj.Name)
+	}
+
+	return meta, nil
+}
+
+// metaOnce retrieves the project _meta at most once, so that it is shared by
+// all the repositories of a single enumeration.
+type metaOnce struct {
+	proj *Project
+	once sync.Once
+	meta ProjectMeta
+	err  error
+}
+
+func (proj *Project) metaOnce() *metaOnce {
+	return &metaOnce{proj: proj}
+}
+
+// Returns the project _meta, retrieving it on the first call only. A failure
+// is returned again to the following calls, rather than retried.
+func (m *metaOnce) get(ctx context.Context) (ProjectMeta, error) {
+	m.once.Do(func() {
+		m.meta, m.err = m.proj.meta(ctx)
+	})
+	return m.meta, m.err
+}
+
+// Returns the architectures configured for repo in the project _meta.
+func (m *metaOnce) archs(ctx context.Context, repo string) ([]string, error) {
+	meta, err := m.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range meta.Repositories {
+		if r.Name == repo {
+			return r.Archs, nil
+		}
+	}
+
+	return nil, errors.Errorf("repository %s not found in _meta of project %s", repo, m.proj.Name)
+}
+
+// Returns the repositories that look like aliases of another repository of the
+// same project, mapped to the repository they alias. The heuristic considers
+// an alias any repository whose only path is another repository of the
+// project itself, e.g. a "latest" repository building against "standard".
+// Since _meta has no explicit repository link, the heuristic also matches
+// repositories that build their own binaries against another repository of
+// the project, such as a kiwi "images" repository building against
+// "containers".
+func (meta ProjectMeta) AliasRepos() map[string]string {
+	names := make(map[string]bool, len(meta.Repositories))
+	for _, r := range meta.Repositories {
+		names[r.Name] = true
+	}
+
+	aliases := make(map[string]string)
+	for _, r := range meta.Repositories {
+		if len(r.Paths) != 1 {
+			continue
+		}
+		target := r.Paths[0]
+		if target.Project == meta.Name && target.Repository != r.Name && names[target.Repository] {
+			aliases[r.Name] = target.Repository
+		}
+	}
+	return aliases
+}
+
+// Returns repos without the alias repositories whose target is in repos too.
+// The repositories explicitly listed in Repos are never skipped.
+func (proj *Project) skipAliasRepos(ctx context.Context, repos []string, metas *metaOnce) []string {
+	meta, err := metas.get(ctx)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not get OBS _meta, not skipping alias repos")
+		return repos
+	}
+
+	listed := make(map[string]bool, len(repos))
+	for _, repo := range repos {
+		listed[repo] = true
+	}
+
+	requested := make(map[string]bool, len(proj.Repos))
+	for _, repo := range proj.Repos {
+		requested[repo] = true
+	}
+
+	aliases := meta.AliasRepos()
+	filtered := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		if target, ok := aliases[repo]; ok && listed[target] && !requested[repo] {
+			// Logged at info level, since the heuristic may be wrong.
+			logrus.WithFields(logrus.Fields{
+				"repo":   repo,
+				"target": target,
+			}).Info("Skipping OBS alias repo")
+			continue
+		}
+		filtered = append(filtered, repo)
+	}
+	return filtered
+}
+
+// Returns the architectures of each repository of the project, as configured
+// in the project _meta, with a single request. The Repos and ExcludeRepos
+// options are honored. When _meta is not available, the repositories and
+// their architectures are listed from the build results instead.
+func (proj *Project) ReposWithArchs() (map[string][]string, error) {
+	ctx := context.Background()
+
+	meta, err := proj.meta(ctx)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Could not get OBS _meta, listing repos and archs")
+		return proj.listReposWithArchs(ctx)
+	}
+
+	include := make(map[string]bool, len(proj.Repos))
+	for _, repo := range proj.Repos {
+		include[repo] = true
+	}
+
+	repos := make([]string, 0, len(meta.Repositories))
+	for _, r := range meta.Repositories {
+		if len(include) == 0 || include[r.Name] {
+			repos = append(repos, r.Name)
+		}
+	}
+	repos = proj.filterRepos(repos)
+
+	archs := make(map[string][]string, len(repos))
+	for _, repo := range repos {
+		archs[repo] = nil
+	}
+	for _, r := range meta.Repositories {
+		if _, ok := archs[r.Name]; ok {
+			archs[r.Name] = r.Archs
+		}
+	}
+	return archs, nil
+}
+
+// Returns the architectures of each repository of the project, as listed by
+// ListRepos and ListArchs.
+func (proj *Project) listReposWithArchs(ctx context.Context) (map[string][]string, error) {
+	repos, err := proj.listRepos(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get list of repos for project %s", proj.Name)
+	}
+
+	archs := make(map[string][]string, len(repos))
+	for _, repo := range repos {
+		if archs[repo], err = proj.listEntries(ctx, repo); err != nil {
+			return nil, errors.Wrapf(err, "failed to get list of archs for repo %s", repo)
+		}
+	}
+	return archs, nil
+}
@@ -0,0 +1,214 @@
+package obsgo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Project _meta configuration, as returned by OBS
+const metaXML = `<project name="proj">
+  <title>Test project</title>
+  <description>Packages for testing</description>
+  <repository name="repo1">
+    <path project="openSUSE:Factory" repository="snapshot"/>
+    <arch>x86_64</arch>
+    <arch>aarch64</arch>
+  </repository>
+  <repository name="repo2">
+    <arch>x86_64</arch>
+  </repository>
+</project>`
+
+func TestMeta(t *testing.T) {
+	srv := mockServer(t, map[string]string{"/source/proj/_meta": metaXML})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	meta, err := proj.Meta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ProjectMeta{
+		Name:        "proj",
+		Title:       "Test project",
+		Description: "Packages for testing",
+		Repositories: []MetaRepository{
+			{
+				Name:  "repo1",
+				Paths: []MetaPath{{Project: "openSUSE:Factory", Repository: "snapshot"}},
+				Archs: []string{"x86_64", "aarch64"},
+			},
+			{Name: "repo2", Archs: []string{"x86_64"}},
+		},
+	}
+	meta.XMLName = want.XMLName
+	if !reflect.DeepEqual(meta, want) {
+		t.Fatalf("got %+v", meta)
+	}
+}
+
+func TestListArchsFromMeta(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1"] = dir("x86_64", "_repository")
+	routes["/source/proj/_meta"] = metaXML
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	proj := testProject(srv.URL)
+	proj.ArchsFromMeta = true
+	// The pseudo-directories of the listing are not archs, even when listed.
+	proj.IncludePseudoDirs = true
+	archs, err := proj.ListArchs("repo1")
+	if err != nil || !reflect.DeepEqual(archs, []string{"x86_64", "aarch64"}) {
+		t.Fatalf("got %v, %v", archs, err)
+	}
+
+	// Without _meta, the directory listing is used.
+	delete(routes, "/source/proj/_meta")
+	noMeta := mockServer(t, routes)
+	defer noMeta.Close()
+	proj = testProject(noMeta.URL)
+	proj.ArchsFromMeta = true
+	archs, err = proj.ListArchs("repo1")
+	if err != nil || !reflect.DeepEqual(archs, []string{"x86_64"}) {
+		t.Fatalf("got %v, %v", archs, err)
+	}
+}
+
+// _meta of a project with the "latest" alias of repo1
+const aliasMetaXML = `<project name="proj">
+  <repository name="latest">
+    <path project="proj" repository="repo1"/>
+    <arch>x86_64</arch>
+  </repository>
+  <repository name="repo1">
+    <path project="openSUSE:Factory" repository="snapshot"/>
+    <arch>x86_64</arch>
+  </repository>
+  <repository name="images">
+    <path project="proj" repository="repo1"/>
+    <path project="openSUSE:Factory" repository="snapshot"/>
+    <arch>x86_64</arch>
+  </repository>
+</project>`
+
+func TestAliasRepos(t *testing.T) {
+	srv := mockServer(t, map[string]string{"/source/proj/_meta": aliasMetaXML})
+	defer srv.Close()
+
+	meta, err := testProject(srv.URL).Meta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A repository with other paths besides the project one is not an alias.
+	if aliases := meta.AliasRepos(); !reflect.DeepEqual(aliases, map[string]string{"latest": "repo1"}) {
+		t.Fatalf("got %v", aliases)
+	}
+}
+
+func TestSkipAliasRepos(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj"] = dir("repo1", "latest")
+	routes["/build/proj/latest"] = dir("x86_64")
+	routes["/build/proj/latest/x86_64"] = dir("pkga")
+	routes["/build/proj/latest/x86_64/pkga"] = routes["/build/proj/repo1/x86_64/pkga"]
+	routes["/source/proj/_meta"] = aliasMetaXML
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	hook := captureLogs(t)
+
+	for _, tc := range []struct {
+		skip  bool
+		repos []string
+		want  int
+	}{
+		{false, nil, 3},
+		{true, nil, 2},
+		// The repositories explicitly requested are never skipped.
+		{true, []string{"repo1", "latest"}, 3},
+	} {
+		proj := testProject(srv.URL)
+		proj.SkipAliasRepos = tc.skip
+		proj.Repos = tc.repos
+		pkgs, err := proj.FindAllPackages()
+		if err != nil || len(pkgs) != tc.want {
+			t.Errorf("SkipAliasRepos %v, Repos %v: got %d packages, %v", tc.skip, tc.repos, len(pkgs), err)
+		}
+	}
+
+	skipped := 0
+	for _, e := range hook.AllEntries() {
+		if e.Message == "Skipping OBS alias repo" {
+			skipped++
+			if e.Level != logrus.InfoLevel || e.Data["repo"] != "latest" || e.Data["target"] != "repo1" {
+				t.Errorf("unexpected log entry %v %v", e.Level, e.Data)
+			}
+		}
+	}
+	if skipped != 1 {
+		t.Errorf("alias repo skipped %d times", skipped)
+	}
+}
+
+func TestPackageNamesSkipAliasRepos(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj"] = dir("repo1", "latest")
+	routes["/build/proj/latest/x86_64"] = dir("pkgc")
+	routes["/source/proj/_meta"] = aliasMetaXML
+	srv, rec := recordingServer(t, routes)
+	defer srv.Close()
+
+	proj := testProject(srv.URL)
+	proj.SkipAliasRepos = true
+	proj.ArchsFromMeta = true
+	names, err := proj.PackageNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"pkga", "pkgb"}) {
+		t.Fatalf("got %v, %v", names, err)
+	}
+	// The _meta is retrieved once, for both the aliases and the archs.
+	metas := 0
+	for _, p := range rec.paths() {
+		if p == "/source/proj/_meta" {
+			metas++
+		}
+	}
+	if metas != 1 {
+		t.Fatalf("_meta retrieved %d times: %v", metas, rec.paths())
+	}
+}
+
+func TestReposWithArchs(t *testing.T) {
+	routes := basicRoutes()
+	routes["/source/proj/_meta"] = metaXML
+	srv, rec := recordingServer(t, routes)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		exclude []string
+		want    map[string][]string
+	}{
+		{nil, map[string][]string{"repo1": {"x86_64", "aarch64"}, "repo2": {"x86_64"}}},
+		{[]string{"repo2"}, map[string][]string{"repo1": {"x86_64", "aarch64"}}},
+	} {
+		proj := testProject(srv.URL)
+		proj.ExcludeRepos = tc.exclude
+		got, err := proj.ReposWithArchs()
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("exclude %v: got %v, %v", tc.exclude, got, err)
+		}
+	}
+	// One request each.
+	if got := rec.paths(); !reflect.DeepEqual(got, []string{"/source/proj/_meta", "/source/proj/_meta"}) {
+		t.Errorf("got requests %v", got)
+	}
+
+	// Without _meta, the repositories and archs are listed.
+	srv = mockServer(t, basicRoutes())
+	defer srv.Close()
+	got, err := testProject(srv.URL).ReposWithArchs()
+	if err != nil || !reflect.DeepEqual(got, map[string][]string{"repo1": {"x86_64"}}) {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,31 @@
+package obsgo
+
+import "time"
+
+// Metrics receives the measurements of the project requests, e.g. to export
+// them as Prometheus metrics. Its methods may be called concurrently.
+type Metrics interface {
+	// ObserveRequest is called when the response headers of the request
+	// for the API route resource are received, or the request fails, in
+	// which case status is zero.
+	ObserveRequest(resource string, status int, dur time.Duration)
+	// ObserveDownload is called when the download of a binary file ends,
+	// with the bytes downloaded and the time it took.
+	ObserveDownload(bytes int64, dur time.Duration)
+}
+
+// NopMetrics is the default Metrics, discarding all the measurements.
+type NopMetrics struct{}
+
+// ObserveRequest does nothing.
+func (NopMetrics) ObserveRequest(resource string, status int, dur time.Duration) {}
+
+// ObserveDownload does nothing.
+func (NopMetrics) ObserveDownload(bytes int64, dur time.Duration) {}
+
+func (proj *Project) metrics() Metrics {
+	if proj.Metrics == nil {
+		return NopMetrics{}
+	}
+	return proj.Metrics
+}
@@ -0,0 +1,77 @@
+package obsgo
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A Metrics recording the observations.
+type recordingMetrics struct {
+	mutex     sync.Mutex
+	requests  []string
+	statuses  map[string]int
+	downloads []int64
+	negative  bool
+}
+
+func (m *recordingMetrics) ObserveRequest(resource string, status int, dur time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests = append(m.requests, resource)
+	m.statuses[resource] = status
+	m.negative = m.negative || dur < 0
+}
+
+func (m *recordingMetrics) ObserveDownload(bytes int64, dur time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.downloads = append(m.downloads, bytes)
+	m.negative = m.negative || dur < 0
+}
+
+func TestMetrics(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	metrics := &recordingMetrics{statuses: make(map[string]int)}
+	proj := testProject(srv.URL)
+	proj.Metrics = metrics
+
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proj.GetPackage("repo1", "x86_64", "missing"); err == nil {
+		t.Fatal("expected an error")
+	}
+	// A request failing without a response.
+	srv.Close()
+	if _, err := proj.ListRepos(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	want := map[string]int{
+		"/build/proj":                                                0,
+		"/build/proj/repo1/x86_64/missing":                           404,
+		"/build/proj/repo1/x86_64/pkga":                              200,
+		"/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm":           200,
+		"/build/proj/repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm": 200,
+	}
+	if len(metrics.requests) != len(want) || !reflect.DeepEqual(metrics.statuses, want) {
+		t.Errorf("got requests %v, statuses %v", metrics.requests, metrics.statuses)
+	}
+	sort.Slice(metrics.downloads, func(i, j int) bool { return metrics.downloads[i] < metrics.downloads[j] })
+	if !reflect.DeepEqual(metrics.downloads, []int64{3, 5}) {
+		t.Errorf("got downloads %v", metrics.downloads)
+	}
+	if metrics.negative {
+		t.Error("got a negative duration")
+	}
+}
@@ -0,0 +1,402 @@
+package obsgo
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Default number of packages downloaded at once by Mirror
+const defaultMirrorWorkers = 4
+
+// Name of the file under root where Mirror saves its progress, when
+// ResumableMirror is set
+const mirrorStateFileName = ".obsgo-mirror.json"
+
+// Summary reports what a Mirror run did.
+type Summary struct {
+	// Number of repositories and of repository architectures with packages
+	Repos int
+	Archs int
+	// Number of packages enumerated
+	Packages int
+	// Number of package files considered, that is Downloaded + Skipped +
+	// Failed
+	Files int
+	// Number of files downloaded, of those not downloaded because already
+	// present locally, in the reference directory or in the exclusion
+	// manifest, or not modified since the last run, and of the failed ones
+	Downloaded int
+	Skipped    int
+	Failed     int
+	// Number of bytes downloaded
+	Bytes int64
+	// Duration of the run
+	Duration time.Duration
+	// Download failures of the packages
+	Errors []error
+}
+
+// Counts of the files handled by downloadPackageFiles
+type fileCounts struct {
+	downloaded int
+	skipped    int
+	failed     int
+}
+
+// String returns a human-readable one-line summary.
+func (s Summary) String() string {
+	return fmt.Sprintf("%d packages in %d repos and %d archs: %d files downloaded, %d skipped, %d failed, %s in %s, %d errors",
+		s.Packages, s.Repos, s.Archs, s.Downloaded, s.Skipped, s.Failed,
+		formatBytes(s.Bytes), s.Duration.Round(time.Millisecond), len(s.Errors))
+}
+
+// Formats n bytes with a binary unit, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Mirrors all the packages files published on the OBS project under root. The
+// packages are downloaded by MirrorWorkers concurrent workers while the
+// project is still being enumerated, as done by FindAllPackages. The progress
+// bars are only printed with a single worker, to not interleave them. The
+// first failure stops the mirror, unless ContinueOnDownloadError is set, in
+// which case the download failures are returned together as a MultiError.
+// When the ByteBudget of the run, not shared with the concurrent Mirror calls,
+// is exceeded, or the disk space is below MinFreeBytes, the mirror stops with
+// ErrBudgetExceeded or ErrLowDiskSpace.
+//
+// When IncrementalStateFile is set, the packages whose binary files are all
+// older than the last successful run are not downloaded.
+//
+// When ResumableMirror is set, a run interrupted e.g. by a restart is resumed
+// by the next one, that only enumerates the packages after the last one
+// completely mirrored. The summary then only covers the resumed run.
+func (proj *Project) Mirror(root string) (Summary, error) {
+	workers := proj.MirrorWorkers
+	if workers <= 0 {
+		workers = defaultMirrorWorkers
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if workers > 1 {
+		ctx = context.WithValue(ctx, noProgressKey{}, true)
+	}
+
+	// The budget of the run, not shared with concurrent runs.
+	budget := &byteBudget{}
+
+	var lastRun time.Time
+	runStart := time.Now()
+	if proj.IncrementalStateFile != "" {
+		var err error
+		if lastRun, err = readLastRun(proj.IncrementalStateFile); err != nil {
+			return Summary{}, err
+		}
+	}
+
+	statePath := filepath.Join(root, mirrorStateFileName)
+	var from *Checkpoint
+	if proj.ResumableMirror {
+		var err error
+		if from, err = proj.loadMirrorState(root, statePath); err != nil {
+			return Summary{}, err
+		}
+	}
+
+	var (
+		summary Summary
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+		errs    MultiError
+		pkgs    = make(chan *mirrorItem, workers)
+		// Enumerated packages, not yet saved to the state file
+		queue []*mirrorItem
+		// Set when ErrBudgetExceeded or ErrLowDiskSpace stop the mirror
+		stopErr error
+		// Repositories and architectures enumerated
+		repos = make(map[string]bool)
+		archs = make(map[string]bool)
+	)
+
+	// Marks item as mirrored, and saves to the state file the last package
+	// mirrored together with all the packages enumerated before it. Must be
+	// called with mutex held.
+	complete := func(item *mirrorItem) {
+		item.done = true
+		n := 0
+		for n < len(queue) && queue[n].done {
+			n++
+		}
+		if n == 0 {
+			return
+		}
+
+		last := queue[n-1].pkg
+		queue = queue[n:]
+		if err := SaveCheckpoint(statePath, Checkpoint{Repo: last.Repo, Arch: last.Arch, Package: last.Name}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"file":  statePath,
+				"error": err,
+			}).Warn("Failed to save mirror state")
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			proj.staggerStart(ctx, i)
+			for item := range pkgs {
+				pkg := item.pkg
+				var counts fileCounts
+				_, n, err := proj.downloadPackageFiles(ctx, pkg, root, proj.ResumableMirror, &counts, budget)
+
+				mutex.Lock()
+				summary.Files += counts.downloaded + counts.skipped + counts.failed
+				summary.Downloaded += counts.downloaded
+				summary.Skipped += counts.skipped
+				summary.Failed += counts.failed
+				summary.Bytes += n
+				if cause := errors.Cause(err); cause == ErrBudgetExceeded || cause == ErrLowDiskSpace {
+					if stopErr == nil {
+						stopErr = err
+					}
+					cancel()
+				} else if err != nil && ctx.Err() == nil {
+					errs = append(errs, errors.Wrapf(err, "package %s", binaryPath(pkg)))
+					if !proj.ContinueOnDownloadError {
+						cancel()
+					}
+				}
+				if err == nil && proj.ResumableMirror {
+					complete(item)
+				}
+				mutex.Unlock()
+			}
+		}(i)
+	}
+
+	err := proj.findAllPackagesFrom(ctx, from, func(pkg PackageInfo) error {
+		item := &mirrorItem{pkg: pkg}
+
+		mutex.Lock()
+		summary.Packages++
+		repos[pkg.Repo] = true
+		archs[pkg.Repo+"/"+pkg.Arch] = true
+		if proj.ResumableMirror {
+			queue = append(queue, item)
+		}
+		mutex.Unlock()
+
+		if !lastRun.IsZero() && !modifiedSince(pkg, lastRun) {
+			logrus.WithFields(logrus.Fields{
+				"path": binaryPath(pkg),
+			}).Debug("OBS package not modified since last run, skipping")
+			mutex.Lock()
+			summary.Files += len(pkg.Files)
+			summary.Skipped += len(pkg.Files)
+			if proj.ResumableMirror {
+				complete(item)
+			}
+			mutex.Unlock()
+			return nil
+		}
+
+		select {
+		case pkgs <- item:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(pkgs)
+	wg.Wait()
+
+	// A resumed run with no package left after the saved position, e.g.
+	// because the following repos have been removed, is complete, and its
+	// state file is dropped. The files of the packages before it were
+	// enumerated by the interrupted run, so it is not an empty project.
+	if from != nil {
+		if cause := errors.Cause(err); cause == errCheckpointPastEnd || cause == ErrEmptyProject {
+			logrus.WithFields(logrus.Fields{
+				"project": proj.Name,
+				"repo":    from.Repo,
+				"arch":    from.Arch,
+				"package": from.Package,
+			}).Info("No OBS package left after the mirror state position")
+			err = nil
+		}
+	}
+
+	summary.Repos = len(repos)
+	summary.Archs = len(archs)
+	summary.Duration = time.Since(runStart)
+	summary.Errors = errs
+
+	logrus.WithFields(logrus.Fields{
+		"project": proj.Name,
+		"summary": summary,
+	}).Debug("OBS project mirrored")
+
+	switch {
+	case stopErr != nil:
+		// The failures, if any, have been logged.
+		return summary, stopErr
+	case len(errs) > 0 && !proj.ContinueOnDownloadError:
+		// The enumeration error is just the cancellation.
+		return summary, errs[0]
+	case err != nil:
+		return summary, err
+	case len(errs) > 0:
+		return summary, errs
+	}
+
+	if proj.IncrementalStateFile != "" {
+		if err := writeLastRun(proj.IncrementalStateFile, runStart); err != nil {
+			return summary, err
+		}
+	}
+	if proj.ResumableMirror {
+		if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+			return summary, errors.Wrapf(err, "Failed to remove mirror state file")
+		}
+	}
+	return summary, nil
+}
+
+// A package enumerated by Mirror
+type mirrorItem struct {
+	pkg  PackageInfo
+	done bool
+}
+
+// Returns the position saved by an interrupted Mirror run to the state file
+// at statePath, or nil if there is none.
+func (proj *Project) loadMirrorState(root, statePath string) (*Checkpoint, error) {
+	if _, ok := proj.storage().(FileStorage); !ok {
+		return nil, errors.New("ResumableMirror requires the local FileStorage")
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, errors.Wrapf(err, "Failed to create mirror root directory")
+	}
+
+	cp, err := LoadCheckpoint(statePath)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"project": proj.Name,
+		"repo":    cp.Repo,
+		"arch":    cp.Arch,
+		"package": cp.Package,
+	}).Info("Resuming interrupted OBS project mirror")
+	return &cp, nil
+}
+
+// Opens the file dlFile, where the binary file f is downloaded, to append the
+// remaining bytes to it, returning the number of bytes already there. These
+// are also written to h, when not nil. The bytes are only kept when dlFile
+// was last written after f was built, so that they are part of the same file.
+func openPartial(dlFile string, f PkgBinary, h hash.Hash) (io.WriteCloser, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dlFile), 0700); err != nil {
+		return nil, 0, err
+	}
+	file, err := os.OpenFile(dlFile, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	offset := info.Size()
+	size, sizeErr := f.SizeBytes()
+	mtime, mtimeErr := f.MtimeUnix()
+	// The exact size is unknown with the binaryversions view.
+	if f.Size == "" || sizeErr != nil || mtimeErr != nil || offset >= size ||
+		!info.ModTime().After(time.Unix(mtime, 0)) {
+		offset = 0
+	}
+
+	if offset > 0 && h != nil {
+		if _, err := io.CopyN(h, file, offset); err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	return file, offset, nil
+}
+
+// Reports whether any binary file of pkg was modified after t, or has an
+// unknown modification time.
+func modifiedSince(pkg PackageInfo, t time.Time) bool {
+	for _, f := range pkg.Files {
+		mtime, err := f.MtimeUnix()
+		if err != nil || !time.Unix(mtime, 0).Before(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the time of the last successful run saved to the file at path, or
+// the zero time if the file does not exist.
+func readLastRun(path string) (time.Time, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "Failed to read state file")
+	}
+
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "Failed to parse state file %s", path)
+	}
+	return t, nil
+}
+
+// Saves t as the time of the last successful run to the file at path.
+func writeLastRun(path string, t time.Time) error {
+	if err := ioutil.WriteFile(path, []byte(t.UTC().Format(time.RFC3339)+"\n"), 0600); err != nil {
+		return errors.Wrapf(err, "Failed to write state file")
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package obsgo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+func TestMirror(t *testing.T) {
+	// The listing of the last repository is only answered once a file has
+	// been downloaded, which requires files to be downloaded while the
+	// project is enumerated.
+	downloading := make(chan struct{})
+	var once sync.Once
+	mock := mockHandler(threeRepoRoutes())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".rpm") {
+			once.Do(func() { close(downloading) })
+		}
+		if r.URL.Path == "/build/proj/repo3" {
+			select {
+			case <-downloading:
+			case <-time.After(5 * time.Second):
+				t.Error("enumeration not pipelined with the downloads")
+			}
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	proj := testProject(srv.URL)
+	proj.MirrorWorkers = 2
+	root := t.TempDir()
+	summary, err := proj.Mirror(root)
+	if err != nil || summary.Packages != 6 || summary.Files != 9 || summary.Bytes != 24 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+	for _, repo := range []string{"repo1", "repo2", "repo3"} {
+		data, err := ioutil.ReadFile(filepath.Join(root, "proj", repo, "x86_64/pkga/a-1.0-1.x86_64.rpm"))
+		if err != nil || string(data) != "AAAAA" {
+			t.Errorf("%s: got %q, %v", repo, data, err)
+		}
+	}
+}
+
+func TestMirrorError(t *testing.T) {
+	routes := basicRoutes()
+	delete(routes, "/build/proj/repo1/x86_64/pkgb/b-1.0-1.noarch.rpm")
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	proj := testProject(srv.URL)
+	if _, err := proj.Mirror(t.TempDir()); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestMirrorIncremental(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkgb"] = `<binarylist><binary filename="b-1.0-1.noarch.rpm" size="2" mtime="200"/></binarylist>`
+	routes["/build/proj/repo1/x86_64/pkgb/b-1.0-1.noarch.rpm"] = "BB"
+	srv, rec := recordingServer(t, routes)
+	defer srv.Close()
+
+	// pkga was last built before the last run, pkgb after.
+	state := filepath.Join(t.TempDir(), ".lastrun")
+	if err := writeLastRun(state, time.Unix(150, 0)); err != nil {
+		t.Fatal(err)
+	}
+	proj := testProject(srv.URL)
+	proj.IncrementalStateFile = state
+
+	start := time.Now().Truncate(time.Second)
+	summary, err := proj.Mirror(t.TempDir())
+	if err != nil || summary.Files != 3 || summary.Downloaded != 1 || summary.Skipped != 2 || summary.Bytes != 2 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+	var downloads []string
+	for _, p := range rec.paths() {
+		if strings.HasSuffix(p, ".rpm") {
+			downloads = append(downloads, p)
+		}
+	}
+	if len(downloads) != 1 || downloads[0] != "/build/proj/repo1/x86_64/pkgb/b-1.0-1.noarch.rpm" {
+		t.Fatalf("got downloads %v", downloads)
+	}
+
+	// The time of the run is saved, so nothing is downloaded by the next one.
+	last, err := readLastRun(state)
+	if err != nil || last.Before(start) || last.After(time.Now()) {
+		t.Fatalf("got last run %v, %v", last, err)
+	}
+	summary, err = proj.Mirror(t.TempDir())
+	if err != nil || summary.Downloaded != 0 || summary.Skipped != 3 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+
+	// Without a state file, everything is downloaded.
+	proj.IncrementalStateFile = filepath.Join(t.TempDir(), ".lastrun")
+	summary, err = proj.Mirror(t.TempDir())
+	if err != nil || summary.Downloaded != 3 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+	if _, err := os.Stat(proj.IncrementalStateFile); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumableMirror(t *testing.T) {
+	routes := map[string]string{
+		"/build/proj":                                      dir("repo1"),
+		"/build/proj/repo1":                                dir("x86_64"),
+		"/build/proj/repo1/x86_64":                         dir("pkga", "pkgb"),
+		"/build/proj/repo1/x86_64/pkga":                    `<binarylist><binary filename="a-1.0-1.x86_64.rpm" size="5" mtime="100"/></binarylist>`,
+		"/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm": "AAAAA",
+		"/build/proj/repo1/x86_64/pkgb":                    `<binarylist><binary filename="b-1.0-1.x86_64.rpm" size="10" mtime="100"/></binarylist>`,
+		"/build/proj/repo1/x86_64/pkgb/b-1.0-1.x86_64.rpm": "0123456789",
+	}
+	const killed = "/build/proj/repo1/x86_64/pkgb/b-1.0-1.x86_64.rpm"
+	var mutex sync.Mutex
+	kill := true
+	var paths, ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		paths = append(paths, r.URL.Path)
+		if rng := r.Header.Get("Range"); rng != "" {
+			ranges = append(ranges, rng)
+		}
+		k := kill
+		mutex.Unlock()
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if k && r.URL.Path == killed {
+			// The process is killed in the middle of the download.
+			w.Header().Set("Content-Length", "10")
+			w.Write([]byte(body[:4]))
+			w.(http.Flusher).Flush()
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		http.ServeContent(w, r, "", time.Unix(100, 0), strings.NewReader(body))
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	proj := testProject(srv.URL)
+	proj.ResumableMirror = true
+	proj.MirrorWorkers = 1
+	if _, err := proj.Mirror(root); err == nil {
+		t.Fatal("expected an error")
+	}
+	statePath := filepath.Join(root, mirrorStateFileName)
+	if cp, err := LoadCheckpoint(statePath); err != nil || cp.Package != "pkga" {
+		t.Fatalf("got %+v, %v", cp, err)
+	}
+	part := filepath.Join(root, "proj/repo1/x86_64/pkgb/b-1.0-1.x86_64.rpm.part")
+	if data, err := ioutil.ReadFile(part); err != nil || string(data) != "0123" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+
+	// The restarted run skips the completed package, and resumes the
+	// interrupted file.
+	mutex.Lock()
+	kill = false
+	paths, ranges = nil, nil
+	mutex.Unlock()
+	var progress []DownloadProgress
+	proj.OnProgress = func(p DownloadProgress) { progress = append(progress, p) }
+	summary, err := proj.Mirror(root)
+	if err != nil || summary.Packages != 1 || summary.Bytes != 6 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+	// The progress includes the bytes downloaded by the interrupted run.
+	if n := len(progress); n == 0 || progress[n-1].Written != 10 || progress[n-1].Total != 10 {
+		t.Fatalf("got progress %+v", progress)
+	}
+	for _, p := range paths {
+		if strings.Contains(p, "pkga") {
+			t.Errorf("got request for %s", p)
+		}
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=4-" {
+		t.Fatalf("got ranges %q", ranges)
+	}
+
+	for file, want := range map[string]string{
+		"proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm": "AAAAA",
+		"proj/repo1/x86_64/pkgb/b-1.0-1.x86_64.rpm": "0123456789",
+	} {
+		if data, err := ioutil.ReadFile(filepath.Join(root, file)); err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v", file, data, err)
+		}
+	}
+	for _, file := range []string{part, statePath} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s: got %v", file, err)
+		}
+	}
+}
+
+func TestMirrorProgressBars(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	for _, workers := range []int{1, 2} {
+		var mutex sync.Mutex
+		var bars []*pb.ProgressBar
+		proj := testProject(srv.URL)
+		proj.MirrorWorkers = workers
+		proj.ProgressFormat = func(bar *pb.ProgressBar) {
+			bar.Output = ioutil.Discard
+			mutex.Lock()
+			bars = append(bars, bar)
+			mutex.Unlock()
+		}
+		if _, err := proj.Mirror(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+
+		// The enumeration and the download bars are only printed when
+		// a single worker downloads the packages.
+		if len(bars) != 3 {
+			t.Fatalf("%d workers: got %d bars", workers, len(bars))
+		}
+		for _, bar := range bars {
+			if bar.NotPrint != (workers > 1) {
+				t.Errorf("%d workers: got bar printed %v", workers, !bar.NotPrint)
+			}
+		}
+	}
+}
+
+func TestResumableMirrorStalePosition(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	for _, cp := range []Checkpoint{
+		// Interrupted after mirroring the last package.
+		{Repo: "repo1", Arch: "x86_64", Package: "pkgb"},
+		// The repo of the position and the following ones were removed.
+		{Repo: "repo2", Arch: "x86_64", Package: "pkga"},
+	} {
+		root := t.TempDir()
+		statePath := filepath.Join(root, mirrorStateFileName)
+		if err := SaveCheckpoint(statePath, cp); err != nil {
+			t.Fatal(err)
+		}
+
+		proj := testProject(srv.URL)
+		proj.ResumableMirror = true
+		proj.RequireNonEmpty = true
+		summary, err := proj.Mirror(root)
+		if err != nil || summary.Packages != 0 {
+			t.Fatalf("%+v: got %+v, %v", cp, summary, err)
+		}
+		if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+			t.Fatalf("%+v: state file left, %v", cp, err)
+		}
+	}
+}
+
+func TestMirrorSummary(t *testing.T) {
+	routes := basicRoutes()
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.MirrorWorkers = 1
+
+	root := t.TempDir()
+	summary, err := proj.Mirror(root)
+	want := Summary{Repos: 1, Archs: 1, Packages: 2, Files: 3, Downloaded: 3, Bytes: 8, Duration: summary.Duration}
+	if err != nil || !reflect.DeepEqual(summary, want) || summary.Duration <= 0 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+	summary, err = proj.Mirror(root)
+	want = Summary{Repos: 1, Archs: 1, Packages: 2, Files: 3, Skipped: 3, Duration: summary.Duration}
+	if err != nil || !reflect.DeepEqual(summary, want) {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+
+	// The failed files are counted, with the error of their package.
+	delete(routes, "/build/proj/repo1/x86_64/pkgb/b-1.0-1.noarch.rpm")
+	srv = mockServer(t, routes)
+	defer srv.Close()
+	proj = testProject(srv.URL)
+	proj.MirrorWorkers = 1
+	proj.ContinueOnDownloadError = true
+	summary, err = proj.Mirror(t.TempDir())
+	if err == nil || summary.Files != 3 || summary.Downloaded != 2 || summary.Failed != 1 || len(summary.Errors) != 1 {
+		t.Fatalf("got %+v, %v", summary, err)
+	}
+}
+
+func TestSummaryString(t *testing.T) {
+	summary := Summary{Repos: 1, Archs: 2, Packages: 3, Files: 6, Downloaded: 4, Skipped: 1, Failed: 1, Bytes: 1536, Duration: 1500 * time.Millisecond, Errors: []error{ErrNotFound}}
+	want := "3 packages in 1 repos and 2 archs: 4 files downloaded, 1 skipped, 1 failed, 1.5 KiB in 1.5s, 1 errors"
+	if got := summary.String(); got != want {
+		t.Fatalf("got %q", got)
+	}
+
+	for _, tc := range []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{3 << 20, "3.0 MiB"},
+		{5 << 40, "5.0 TiB"},
+	} {
+		if got := formatBytes(tc.n); got != tc.want {
+			t.Errorf("%d: got %s, want %s", tc.n, got, tc.want)
+		}
+	}
+}
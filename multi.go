@@ -0,0 +1,76 @@
+package obsgo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Default number of projects enumerated at once by MultiProject
+const defaultMultiConcurrency = 4
+
+// Context key disabling the progress bars, whose output would be interleaved
+// when several projects are enumerated, or several packages downloaded, at
+// once.
+type noProgressKey struct{}
+
+// MultiProject groups several OBS projects, e.g. a project family, that are
+// enumerated together.
+type MultiProject struct {
+	// Projects to enumerate
+	Projects []*Project
+	// Maximum number of projects enumerated at once. When zero or less, up to
+	// 4 projects are enumerated at once.
+	MultiConcurrency int
+}
+
+// Returns all the packages files published on each project, in the order of
+// Projects, so that projects with the same name on different OBS instances
+// are kept apart. Enumeration goes on when a project fails, and the failures
+// are returned together as a MultiError. The progress bars are only shown
+// when the projects are enumerated one at a time.
+func (mp *MultiProject) FindAllPackages() ([][]PackageInfo, error) {
+	concurrency := mp.MultiConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultMultiConcurrency
+	}
+
+	ctx := context.Background()
+	if concurrency > 1 && len(mp.Projects) > 1 {
+		ctx = context.WithValue(ctx, noProgressKey{}, true)
+	}
+
+	var (
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+		errs    MultiError
+		results = make([][]PackageInfo, len(mp.Projects))
+		sem     = make(chan struct{}, concurrency)
+	)
+
+	for i, proj := range mp.Projects {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, proj *Project) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			pkgList, err := proj.findAllPackagesList(ctx)
+			results[i] = pkgList
+			if err != nil {
+				mutex.Lock()
+				errs = append(errs, errors.Wrapf(err, "project %s", proj.Name))
+				mutex.Unlock()
+			}
+		}(i, proj)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
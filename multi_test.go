@@ -0,0 +1,105 @@
+package obsgo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+func TestMultiProjectConcurrency(t *testing.T) {
+	routes := make(map[string]string)
+	var names []string
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("proj%d", i)
+		routes["/build/"+name] = dir("repo1")
+		routes["/build/"+name+"/repo1"] = dir("x86_64")
+		routes["/build/"+name+"/repo1/x86_64"] = dir("pkga")
+		routes["/build/"+name+"/repo1/x86_64/pkga"] = testBinaryList("a-1.0-1.x86_64.rpm")
+		names = append(names, name)
+	}
+	mock := mockHandler(routes)
+
+	// Tracks the requests in flight, all the projects enumerating sequentially.
+	var mutex sync.Mutex
+	var inFlight, maxInFlight int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mock.ServeHTTP(w, r)
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+	}))
+	defer srv.Close()
+
+	// A project failing doesn't stop the others.
+	var projects []*Project
+	for _, name := range append(names, "missing") {
+		proj := testProject(srv.URL)
+		proj.Name = name
+		projects = append(projects, proj)
+	}
+
+	mp := &MultiProject{Projects: projects, MultiConcurrency: 2}
+	results, err := mp.FindAllPackages()
+	if errs, ok := err.(MultiError); !ok || len(errs) != 1 {
+		t.Fatalf("got %v", err)
+	}
+	for i, proj := range projects[:6] {
+		if pkgs := results[i]; len(pkgs) != 1 || len(pkgs[0].Files) != 1 {
+			t.Errorf("%s: got %+v", proj.Name, pkgs)
+		}
+	}
+	if maxInFlight > 2 {
+		t.Errorf("%d projects enumerated at once", maxInFlight)
+	}
+}
+
+func TestMultiProjectSameName(t *testing.T) {
+	one := mockServer(t, basicRoutes())
+	defer one.Close()
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64"] = dir("pkga")
+	other := mockServer(t, routes)
+	defer other.Close()
+
+	for _, concurrency := range []int{1, 2} {
+		var mutex sync.Mutex
+		var bars []*pb.ProgressBar
+		var projects []*Project
+		for _, url := range []string{one.URL, other.URL} {
+			proj := testProject(url)
+			proj.ProgressFormat = func(bar *pb.ProgressBar) {
+				bar.Output = ioutil.Discard
+				mutex.Lock()
+				bars = append(bars, bar)
+				mutex.Unlock()
+			}
+			projects = append(projects, proj)
+		}
+
+		// The projects named alike on two OBS instances are kept apart.
+		mp := &MultiProject{Projects: projects, MultiConcurrency: concurrency}
+		results, err := mp.FindAllPackages()
+		if err != nil || len(results) != 2 || len(results[0]) != 2 || len(results[1]) != 1 {
+			t.Fatalf("concurrency %d: got %+v, %v", concurrency, results, err)
+		}
+		// The bars are only printed when enumerating one project at a time.
+		for _, bar := range bars {
+			if bar.NotPrint != (concurrency > 1) {
+				t.Errorf("concurrency %d: got bar printed %v", concurrency, !bar.NotPrint)
+			}
+		}
+	}
+}
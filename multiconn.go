@@ -0,0 +1,147 @@
+package obsgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Minimum size of the files downloaded with multiple connections
+	multiConnMinSize = 64 << 20
+	// Default number of connections used for a multi-connection download
+	defaultDownloadConnections = 4
+)
+
+// offsetWriter writes sequentially to an io.WriterAt from a given offset.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (ow *offsetWriter) Write(p []byte) (int, error) {
+	n, err := ow.w.WriteAt(p, ow.off)
+	ow.off += int64(n)
+	return n, err
+}
+
+// Reports whether a binary of the given size, to be written to dest, is
+// downloaded with multiple connections.
+func (proj *Project) useMultiConn(size int64, dest io.Writer) bool {
+	if !proj.MultiConnDownload || size < multiConnMinSize {
+		return false
+	}
+	_, ok := dest.(io.WriterAt)
+	return ok
+}
+
+// Downloads the binary at path, of the given size, splitting it in byte ranges
+// fetched concurrently and written at their offset in dest. When the server
+// does not support ranges, the whole file is downloaded with the first
+// request. The ranges are requested from directURL when not empty, as done by
+// doBinaryRequest.
+func (proj *Project) downloadRanges(ctx context.Context, path, directURL string, size int64, dest io.WriterAt) (int64, error) {
+	chunks := int64(proj.DownloadConnections)
+	if chunks <= 0 {
+		chunks = defaultDownloadConnections
+	}
+	chunkSize := (size + chunks - 1) / chunks
+
+	var written int64
+	start := time.Now()
+	defer func() {
+		proj.metrics().ObserveDownload(atomic.LoadInt64(&written), time.Since(start))
+	}()
+
+	resp, err := proj.doBinaryRequest(ctx, path, directURL, byteRange(0, chunkSize))
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		logrus.WithFields(logrus.Fields{
+			"path": path,
+		}).Debug("OBS server does not support ranges, downloading with a single connection")
+		n, err := io.Copy(&offsetWriter{w: dest}, resp.Body)
+		written = n
+		return n, err
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, chunks)
+	)
+
+	downloadChunk := func(i int, start, length int64, body io.ReadCloser) {
+		defer wg.Done()
+		if body == nil {
+			proj.staggerStart(ctx, i)
+		}
+		err := proj.retry(ctx, proj.DownloadMaxRetries, func() error {
+			if body == nil {
+				resp, err := proj.doBinaryRequest(ctx, path, directURL, byteRange(start, length))
+				if err != nil {
+					return err
+				}
+				if resp.StatusCode != http.StatusPartialContent {
+					resp.Body.Close()
+					return noRetry{errors.Errorf("unexpected status code %d for range request", resp.StatusCode)}
+				}
+				body = resp.Body
+			}
+			defer func() {
+				body.Close()
+				body = nil
+			}()
+
+			// Chunks are written at their offset, so that a failed
+			// attempt is just overwritten by the next one.
+			n, err := io.Copy(&offsetWriter{w: dest, off: start}, io.LimitReader(body, length))
+			if err == nil && n != length {
+				err = io.ErrUnexpectedEOF
+			}
+			if err == nil {
+				atomic.AddInt64(&written, n)
+			}
+			return err
+		})
+		if err != nil {
+			errs <- errors.Wrapf(err, "could not download range %d-%d", start, start+length-1)
+		}
+	}
+
+	for i, start := 0, int64(0); start < size; i, start = i+1, start+chunkSize {
+		length := chunkSize
+		if start+length > size {
+			length = size - start
+		}
+
+		var body io.ReadCloser
+		if start == 0 {
+			body = resp.Body
+		}
+
+		wg.Add(1)
+		go downloadChunk(i, start, length, body)
+	}
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return written, err
+	}
+	return written, nil
+}
+
+// Returns the value of a Range header for length bytes from start.
+func byteRange(start, length int64) string {
+	return fmt.Sprintf("bytes=%d-%d", start, start+length-1)
+}
@@ -0,0 +1,166 @@
+package obsgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Returns a server serving data at any path, with range support if ranges is
+// set, and a function returning the Range headers of the requests received.
+// If reset is set, the connection is reset halfway through the body of the
+// first response.
+func rangeServer(t *testing.T, data []byte, ranges, reset bool) (*httptest.Server, func() []string) {
+	var mutex sync.Mutex
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		received = append(received, r.Header.Get("Range"))
+		first := len(received) == 1
+		mutex.Unlock()
+
+		switch {
+		case reset && first:
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Write(data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// Gives the client time to read the data sent, which is
+			// discarded once the reset is received.
+			time.Sleep(100 * time.Millisecond)
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+		case ranges:
+			http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+		default:
+			w.Write(data)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), received...)
+	}
+}
+
+func TestDownloadRanges(t *testing.T) {
+	// Not a multiple of the number of connections, so that the last range
+	// is shorter.
+	data := make([]byte, 1<<20+7)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, tc := range []struct {
+		ranges   bool
+		requests int
+	}{
+		{true, 3},
+		{false, 1},
+	} {
+		srv, received := rangeServer(t, data, tc.ranges, false)
+		proj := testProject(srv.URL)
+		proj.DownloadConnections = 3
+
+		dest, err := os.Create(filepath.Join(t.TempDir(), "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := proj.downloadRanges(context.Background(), "file", "", int64(len(data)), dest)
+		dest.Close()
+		if err != nil || n != int64(len(data)) {
+			t.Fatalf("ranges %v: got %d bytes, %v", tc.ranges, n, err)
+		}
+
+		got, err := ioutil.ReadFile(dest.Name())
+		if err != nil || sha256.Sum256(got) != sha256.Sum256(data) {
+			t.Fatalf("ranges %v: reassembled file differs, %d bytes, %v", tc.ranges, len(got), err)
+		}
+		if r := received(); len(r) != tc.requests {
+			t.Fatalf("ranges %v: got requests for ranges %q", tc.ranges, r)
+		}
+	}
+}
+
+func TestDownloadPackageFilesMultiConn(t *testing.T) {
+	data := make([]byte, multiConnMinSize+12345)
+	rand.New(rand.NewSource(1)).Read(data)
+	srv, received := rangeServer(t, data, true, false)
+	proj := testProject(srv.URL)
+	proj.MultiConnDownload = true
+
+	pkg := PackageInfo{Path: "repo1/x86_64/pkga", Files: []PkgBinary{{Filename: "big.rpm", Size: strconv.Itoa(len(data))}}}
+	files, n, err := proj.DownloadPackageFiles(pkg, t.TempDir())
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+	got, err := ioutil.ReadFile(files[0])
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("reassembled file differs, %d bytes, %v", len(got), err)
+	}
+	if r := received(); len(r) != defaultDownloadConnections {
+		t.Fatalf("got requests for ranges %q", r)
+	}
+
+	// Small files are downloaded with a single request.
+	srv, received = rangeServer(t, []byte("AAAAA"), true, false)
+	proj.BaseURL = srv.URL
+	pkg.Files[0].Size = "5"
+	if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if r := received(); len(r) != 1 || r[0] != "" {
+		t.Fatalf("got requests for ranges %q", r)
+	}
+}
+
+func TestDownloadPackageFilesMultiConnFailure(t *testing.T) {
+	data := make([]byte, multiConnMinSize+12345)
+	rand.New(rand.NewSource(1)).Read(data)
+	// The first request of the last range fails.
+	var mutex sync.Mutex
+	failed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		fail := !failed && r.Header.Get("Range") != "" && !strings.HasPrefix(r.Header.Get("Range"), "bytes=0-")
+		failed = failed || fail
+		mutex.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.MultiConnDownload = true
+
+	pkg := PackageInfo{Path: "repo1/x86_64/pkga", Files: []PkgBinary{{Filename: "big.rpm", Size: strconv.Itoa(len(data))}}}
+	root := t.TempDir()
+	if _, _, err := proj.DownloadPackageFiles(pkg, root); err == nil {
+		t.Fatal("expected an error")
+	}
+	// The failed download is done again by the next run.
+	files, n, err := proj.DownloadPackageFiles(pkg, root)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+	if got, err := ioutil.ReadFile(files[0]); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("reassembled file differs, %d bytes, %v", len(got), err)
+	}
+}
@@ -0,0 +1,237 @@
+package obsgo
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NEVRA is the name, epoch, version, release and architecture of an RPM
+// package.
+type NEVRA struct {
+	Name    string
+	Epoch   string
+	Version string
+	Release string
+	Arch    string
+}
+
+// ParseRPMFilename parses an RPM filename of the form
+// name-version-release.arch.rpm. The epoch is not part of RPM filenames, so
+// it is always empty.
+func ParseRPMFilename(filename string) (NEVRA, error) {
+	s := strings.TrimSuffix(filename, ".rpm")
+	if s == filename {
+		return NEVRA{}, errors.Errorf("not an RPM filename: %s", filename)
+	}
+
+	var n NEVRA
+	i := strings.LastIndexByte(s, '.')
+	if i < 0 {
+		return NEVRA{}, errors.Errorf("missing architecture in RPM filename: %s", filename)
+	}
+	s, n.Arch = s[:i], s[i+1:]
+
+	i = strings.LastIndexByte(s, '-')
+	if i < 0 {
+		return NEVRA{}, errors.Errorf("missing release in RPM filename: %s", filename)
+	}
+	s, n.Release = s[:i], s[i+1:]
+
+	i = strings.LastIndexByte(s, '-')
+	if i <= 0 {
+		return NEVRA{}, errors.Errorf("missing version in RPM filename: %s", filename)
+	}
+	n.Name, n.Version = s[:i], s[i+1:]
+
+	return n, nil
+}
+
+// CompareRPMVersions compares two version or release strings as rpm does,
+// returning -1, 0 or 1 when a is older, equal or newer than b.
+func CompareRPMVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	isAlpha := func(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+	isSeparator := func(c byte) bool { return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^' }
+	segment := func(s string, class func(byte) bool) (string, string) {
+		i := 0
+		for i < len(s) && class(s[i]) {
+			i++
+		}
+		return s[:i], s[i:]
+	}
+
+	for {
+		for len(a) > 0 && isSeparator(a[0]) {
+			a = a[1:]
+		}
+		for len(b) > 0 && isSeparator(b[0]) {
+			b = b[1:]
+		}
+
+		// A tilde sorts before anything, even the end of the version.
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		// A caret sorts after the end of the version, but before anything
+		// else.
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if a == "" || b == "" {
+			break
+		}
+
+		class := isAlpha
+		numeric := isDigit(a[0])
+		if numeric {
+			class = isDigit
+		}
+		var segA, segB string
+		segA, a = segment(a, class)
+		segB, b = segment(b, class)
+
+		// Numeric segments are newer than alphabetic ones.
+		if segB == "" {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+
+		if numeric {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if len(segA) != len(segB) {
+				if len(segA) > len(segB) {
+					return 1
+				}
+				return -1
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// Compares the epoch, version and release of a and b as rpm does. An empty
+// release in b, as in a version constraint, matches any release of a.
+func compareEVR(a, b NEVRA) int {
+	epoch := func(e string) int {
+		n, _ := strconv.Atoi(e)
+		return n
+	}
+	if ea, eb := epoch(a.Epoch), epoch(b.Epoch); ea != eb {
+		if ea > eb {
+			return 1
+		}
+		return -1
+	}
+	if c := CompareRPMVersions(a.Version, b.Version); c != 0 || b.Release == "" {
+		return c
+	}
+	return CompareRPMVersions(a.Release, b.Release)
+}
+
+// versionConstraint is a parsed Project.VersionConstraint.
+type versionConstraint struct {
+	name string
+	op   string
+	evr  NEVRA
+}
+
+// Parses a version constraint of the form "[name] op [epoch:]version[-release]".
+func parseVersionConstraint(s string) (*versionConstraint, error) {
+	fields := strings.Fields(s)
+	var c versionConstraint
+	switch len(fields) {
+	case 2:
+	case 3:
+		c.name, fields = fields[0], fields[1:]
+	default:
+		return nil, errors.Errorf("invalid version constraint %q", s)
+	}
+
+	switch fields[0] {
+	case "<", "<=", "=", ">=", ">":
+		c.op = fields[0]
+	default:
+		return nil, errors.Errorf("invalid operator in version constraint %q", s)
+	}
+
+	evr := fields[1]
+	if i := strings.IndexByte(evr, ':'); i >= 0 {
+		c.evr.Epoch, evr = evr[:i], evr[i+1:]
+		if _, err := strconv.Atoi(c.evr.Epoch); err != nil {
+			return nil, errors.Errorf("invalid epoch in version constraint %q", s)
+		}
+	}
+	if i := strings.IndexByte(evr, '-'); i >= 0 {
+		evr, c.evr.Release = evr[:i], evr[i+1:]
+	}
+	if evr == "" {
+		return nil, errors.Errorf("missing version in version constraint %q", s)
+	}
+	c.evr.Version = evr
+
+	return &c, nil
+}
+
+// Reports whether the RPM n satisfies the constraint. RPMs of other
+// packages than the constraint one always do.
+func (c *versionConstraint) match(n NEVRA) bool {
+	if c.name != "" && c.name != n.Name {
+		return true
+	}
+
+	cmp := compareEVR(n, c.evr)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "=":
+		return cmp == 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp > 0
+	}
+}
@@ -0,0 +1,117 @@
+package obsgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRPMFilename(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		want     NEVRA
+		err      bool
+	}{
+		{"kernel-default-6.1.2-3.4.x86_64.rpm", NEVRA{Name: "kernel-default", Version: "6.1.2", Release: "3.4", Arch: "x86_64"}, false},
+		{"bash-5.1-1.1.noarch.rpm", NEVRA{Name: "bash", Version: "5.1", Release: "1.1", Arch: "noarch"}, false},
+		{"foo.rpm", NEVRA{}, true},
+		{"foo-1.x86_64.rpm", NEVRA{}, true},
+		{"foo_1.0_amd64.deb", NEVRA{}, true},
+	} {
+		got, err := ParseRPMFilename(tc.filename)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("%s: got %+v, %v", tc.filename, got, err)
+		}
+	}
+}
+
+func TestCompareRPMVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"6.0", "5.19", 1},
+		{"2.0.1", "2.0", 1},
+		{"001", "1", 0},
+		{"1_0", "1.0", 0},
+		{"1.0a", "1.0", 1},
+		// Numeric segments are newer than alphabetic ones.
+		{"1.a", "1.1", -1},
+		// A tilde sorts before anything, a caret after the end only.
+		{"1.0~rc1", "1.0", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+	} {
+		if got := CompareRPMVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("%s, %s: got %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := CompareRPMVersions(tc.b, tc.a); got != -tc.want {
+			t.Errorf("%s, %s: got %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestParseVersionConstraint(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want *versionConstraint
+	}{
+		{"kernel >= 6.0", &versionConstraint{name: "kernel", op: ">=", evr: NEVRA{Version: "6.0"}}},
+		{"< 1:2.0-3", &versionConstraint{op: "<", evr: NEVRA{Epoch: "1", Version: "2.0", Release: "3"}}},
+		{"kernel ~ 6", nil},
+		{"kernel >=", nil},
+		{"kernel >= x:1", nil},
+		{"kernel = -1", nil},
+		{"a b = 1", nil},
+	} {
+		got, err := parseVersionConstraint(tc.s)
+		if (err != nil) != (tc.want == nil) || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %+v, %v", tc.s, got, err)
+		}
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga"] = testBinaryList(
+		"kernel-5.19-1.x86_64.rpm",
+		"kernel-6.0-1.x86_64.rpm",
+		"kernel-6.0-2.x86_64.rpm",
+		"kernel-6.2-1.x86_64.rpm",
+		"other-1.0-1.x86_64.rpm",
+	)
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		constraint string
+		files      []string
+	}{
+		{"", []string{"kernel-5.19-1.x86_64.rpm", "kernel-6.0-1.x86_64.rpm", "kernel-6.0-2.x86_64.rpm", "kernel-6.2-1.x86_64.rpm", "other-1.0-1.x86_64.rpm"}},
+		// The binaries of other packages are kept.
+		{"kernel >= 6.0", []string{"kernel-6.0-1.x86_64.rpm", "kernel-6.0-2.x86_64.rpm", "kernel-6.2-1.x86_64.rpm", "other-1.0-1.x86_64.rpm"}},
+		{"kernel < 6.0", []string{"kernel-5.19-1.x86_64.rpm", "other-1.0-1.x86_64.rpm"}},
+		{"kernel = 6.0", []string{"kernel-6.0-1.x86_64.rpm", "kernel-6.0-2.x86_64.rpm", "other-1.0-1.x86_64.rpm"}},
+		{"kernel = 6.0-2", []string{"kernel-6.0-2.x86_64.rpm", "other-1.0-1.x86_64.rpm"}},
+		// Without a name, the constraint applies to all the binaries.
+		{"< 6", []string{"kernel-5.19-1.x86_64.rpm", "other-1.0-1.x86_64.rpm"}},
+	} {
+		proj := testProject(srv.URL)
+		proj.VersionConstraint = tc.constraint
+		pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+		if err := proj.PackageBinaries(&pkg); err != nil {
+			t.Fatal(err)
+		}
+		if got := fileNames(pkg.Files); !reflect.DeepEqual(got, tc.files) {
+			t.Errorf("%q: got %v", tc.constraint, got)
+		}
+	}
+
+	proj := testProject(srv.URL)
+	proj.VersionConstraint = "kernel ~ 6"
+	if err := proj.PackageBinaries(&PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}); err == nil {
+		t.Fatal("expected an error for an invalid constraint")
+	}
+}
@@ -9,19 +9,44 @@
 package obsgo
 
 import (
-	"fmt"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
-	"regexp"
-	"strconv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	pb "gopkg.in/cheggaaa/pb.v1"
 )
 
-// Project represents an OBS project
+// DuplicatePolicy selects how binary files with duplicate names are handled.
+type DuplicatePolicy int
+
+const (
+	// DuplicatesAllow keeps all the files, as listed by OBS.
+	DuplicatesAllow DuplicatePolicy = iota
+	// DuplicatesError makes PackageBinaries fail.
+	DuplicatesError
+	// DuplicatesRemove keeps only the first file with a given name.
+	DuplicatesRemove
+)
+
+// Project represents an OBS project.
+//
+// The methods of a Project are safe for concurrent use by multiple goroutines,
+// provided that its fields are not modified after the first method call.
+// Methods taking a *PackageInfo argument modify it, so the same PackageInfo
+// must not be passed to concurrent calls.
 type Project struct {
 	// Name of the project
 	Name string
@@ -29,6 +54,258 @@ type Project struct {
 	User string
 	// Password needed to access the project with APIs
 	Password string
+	// URL of the OBS API server, e.g. "https://api.opensuse.org". Both the
+	// https and the plain http schemes are supported. When empty, the
+	// openSUSE public instance is used.
+	BaseURL string
+	// HTTP client used for the API requests. When nil, a client shared by
+	// all projects, reusing connections and supporting HTTP/2, is used.
+	Client *http.Client
+	// HTTP client used only to download binary files, e.g. with a longer
+	// timeout than listing requests. When nil, Client is used.
+	DownloadClient *http.Client
+	// Additional headers set on every API request. The basic authentication
+	// credentials are only omitted if an Authorization header is set here.
+	// They are not sent to the third-party hosts of the direct download
+	// links.
+	Headers http.Header
+	// When set, a line with the method, URL, response status code and
+	// number of bytes received is written for every API request, e.g. to
+	// keep an audit trail of a mirror. The status code is 0 when no response
+	// was received.
+	RequestLog io.Writer
+	// Optional Metrics receiving the measurements of the requests and
+	// downloads of the project.
+	Metrics Metrics
+	// Layout of the files downloaded by DownloadPackageFiles. The default
+	// LayoutOBS mirrors the OBS repo/arch/package tree.
+	Layout Layout
+	// Distribution suite names of the OBS repositories, e.g. "bookworm" for
+	// "Debian_12", naming the dists directories and the suite pools of the
+	// Debian layouts. They take precedence over the default names of the
+	// common repositories, see Suite. No Release or repomd metadata is
+	// generated: the apt and createrepo tools run on the mirror can get the
+	// suite names from Suite.
+	RepoToSuite map[string]string
+	// Storage where downloaded files are written. When nil, files are
+	// written on the local filesystem.
+	Storage Storage
+	// When greater than zero, binary files smaller than MinBinarySize bytes,
+	// such as zero-size phantom entries, are skipped by PackageBinaries. Set
+	// it to 1 to skip only empty files.
+	MinBinarySize int64
+	// When true, FindAllPackages returns ErrEmptyProject if no binary files
+	// are found, e.g. because of a misspelled project name.
+	RequireNonEmpty bool
+	// Glob patterns, as accepted by path.Match, selecting the binary files
+	// returned by PackageBinaries. When Include is not empty a file must
+	// match one of its patterns, and files matching any Exclude pattern are
+	// always discarded.
+	Include []string
+	Exclude []string
+	// Version constraint on the RPM files returned by PackageBinaries, such
+	// as "kernel >= 6.0" or "< 2:1.4-3", compared as rpm does. The supported
+	// operators are <, <=, =, >= and >. When a package name is given, only
+	// the RPMs of that package are filtered. Other files are not affected.
+	VersionConstraint string
+	// How PackageBinaries handles binary files listed more than once with
+	// the same name. By default they are all returned.
+	DuplicateFiles DuplicatePolicy
+	// How DownloadPackageFiles handles a binary file identical to one
+	// already downloaded for another repository. By default each repository
+	// has its own copy.
+	RepoDuplicates RepoDuplicatePolicy
+	// When true, PackageBinaries also returns container images built for the
+	// package architecture, i.e. ".tar", ".tar.gz" and ".tar.xz" archives
+	// named "<image>.<arch>-<version>...", like the docker and OCI images
+	// published by OBS kiwi builds. Multibuild image flavors are listed as
+	// separate "<package>:<flavor>" packages.
+	IncludeContainers bool
+	// When true, PackageBinaries also returns the detached signatures of the
+	// selected binaries, i.e. the ".asc" and ".sig" files named after them,
+	// so that they are downloaded next to the binaries.
+	IncludeSignatures bool
+	// Selects the binary files returned by PackageBinaries. When nil, the
+	// rpm and deb packages built for the package architecture are selected,
+	// plus container images when IncludeContainers is set.
+	Matcher BinaryMatcher
+	// Path prefix of the build results API routes. When empty, "/build" is
+	// used.
+	PathPrefix string
+	// When true, the project is accessed anonymously through the "/public"
+	// API routes, e.g. "/public/build/...", and User and Password are not
+	// sent.
+	Public bool
+	// Optional callback periodically invoked while downloading a file, to
+	// report the bytes transferred, the speed and the estimated time left.
+	OnProgress func(DownloadProgress)
+	// When true, ListArchs returns the architectures configured in the
+	// project _meta, rather than the build result directories, which may
+	// include pseudo-directories such as "_repository". The directory listing
+	// is still used when _meta can not be retrieved.
+	ArchsFromMeta bool
+	// When true, ListRepos, ListArchs and ListPackages also return the OBS
+	// internal entries whose names start with "_" or ":", such as
+	// "_repository" or ":full", which are skipped by default.
+	IncludePseudoDirs bool
+	// Number of times a failed API request is retried, with an exponential
+	// backoff delay, or the delay requested by a Retry-After header. Client
+	// errors (HTTP 4xx status codes) are not retried, except for 408 Request
+	// Timeout and 429 Too Many Requests.
+	MaxRetries int
+	// Number of times a failed file download is retried. It is separate from
+	// MaxRetries, so that large transfers can be retried more aggressively
+	// than listing requests. A download failing after part of the file has
+	// been written, e.g. on a connection reset, is resumed from the bytes
+	// already written with a Range request. It is not retried when the
+	// server does not honor the Range.
+	DownloadMaxRetries int
+	// Delay before the first retry of a failed request, doubled at every
+	// following attempt. When zero, 1 second is used.
+	RetryDelay time.Duration
+	// Maximum delay between two retries of the exponential backoff. When
+	// zero, the delay is capped to 1 minute.
+	MaxRetryDelay time.Duration
+	// Maximum delay honored when the server asks to retry later with a
+	// Retry-After header, instead of the exponential backoff delay. When
+	// zero, the delay is capped to 2 minutes.
+	MaxRetryAfter time.Duration
+	// When true, DownloadPackageFiles computes the SHA-256 checksum of each
+	// file while downloading it, and lists the checksums of the package files
+	// in a SHA256SUMS file in the package directory.
+	Checksums bool
+	// When true, with Checksums set, DownloadPackageFiles hashes again the
+	// files already downloaded and downloads them again when they do not
+	// match the SHA256SUMS file. By default the recorded checksums are
+	// trusted, and only the files missing from SHA256SUMS are hashed.
+	ForceVerify bool
+	// When true, DownloadPackageFiles goes on downloading the other files of
+	// the package after a file fails to download, and returns the failures
+	// together as a MultiError along with the downloaded files.
+	ContinueOnDownloadError bool
+	// When true, DownloadPackageFiles fails with ErrLocalFileTooLarge when a
+	// local file is larger than the OBS file, leaving it untouched. By
+	// default a warning is logged and the file is downloaded again.
+	StrictLocalSize bool
+	// When not nil, DownloadPackageFiles verifies with it the signature
+	// embedded in each downloaded RPM file, and fails with ErrBadSignature
+	// when it does not verify.
+	RPMVerifier RPMVerifier
+	// When true, files of at least 64 MiB are downloaded with
+	// DownloadConnections concurrent range requests, if the server supports
+	// ranges and the Storage returns writers implementing io.WriterAt, as
+	// the local filesystem does. It is not used together with Checksums, and
+	// OnProgress is not called for these downloads.
+	MultiConnDownload bool
+	// Number of connections used by a multi-connection download. When zero,
+	// 4 connections are used.
+	DownloadConnections int
+	// Size in bytes of the buffer used to copy each downloaded binary to its
+	// destination. When zero, a 256 KiB buffer is used.
+	CopyBufferSize int
+	// When true, the archives written by ArchiveArch are gzip compressed.
+	GzipArchives bool
+	// Optional function customizing the format of the progress bars, e.g.
+	// to set units or show the speed. It is called on every new progress bar
+	// before it is started.
+	ProgressFormat func(bar *pb.ProgressBar)
+	// When not empty, the names of the only repositories returned by
+	// ListRepos, and so enumerated, without listing the project repositories.
+	Repos []string
+	// Names of the repositories skipped by ListRepos, and so by the whole
+	// project enumeration.
+	ExcludeRepos []string
+	// When true, FindAllPackages skips the repositories that are aliases of
+	// another repository of the project, as detected by
+	// ProjectMeta.AliasRepos, to avoid enumerating the same binaries twice.
+	// An alias is still enumerated when its target repository is not listed,
+	// or when it is explicitly listed in Repos. The skipped repositories are
+	// logged, since the heuristic also matches some ordinary repositories.
+	SkipAliasRepos bool
+	// When not empty, FindAllPackages periodically saves a Checkpoint of the
+	// enumeration to this file, and when it fails, so that it can be resumed
+	// with ResumeFindAllPackages. The file is removed on success.
+	CheckpointFile string
+	// Number of packages enumerated between two checkpoints. When zero, a
+	// checkpoint is saved every 100 packages.
+	CheckpointInterval int
+	// Number of packages downloaded at once by Mirror. When zero, 4 packages
+	// are downloaded at once.
+	MirrorWorkers int
+	// Delay between the start of the concurrent workers of Mirror and of
+	// multi-connection downloads, plus a random jitter of up to half of it,
+	// so that their requests ramp up instead of bursting. When zero, 50ms are
+	// used, when negative workers start at once.
+	WorkerStagger time.Duration
+	// When not empty, the local file where Mirror saves the start time of
+	// its last successful run. The packages whose binary files are all older
+	// than that are skipped by the following runs.
+	IncrementalStateFile string
+	// When true, Mirror saves its progress to a state file under root, so
+	// that the next Mirror run resumes an interrupted one: the enumeration
+	// continues after the last package completely mirrored, and the files
+	// partially downloaded are completed. Requires the FileStorage.
+	ResumableMirror bool
+	// When greater than zero, the maximum number of bytes downloaded in a
+	// run, e.g. for metered connections. Each Mirror call is a run, with its
+	// own budget, and the DownloadPackageFiles calls are summed until
+	// ResetBudget is called.
+	// Files are never partially downloaded: DownloadPackageFiles stops with
+	// ErrBudgetExceeded before the first file that would exceed the budget,
+	// so that the next run downloads the remaining files.
+	ByteBudget int64
+	// When greater than zero, DownloadPackageFiles checks before each file
+	// that the local filesystem where it is downloaded has at least
+	// MinFreeBytes bytes free, and stops with ErrLowDiskSpace otherwise.
+	MinFreeBytes int64
+	// Optional function returning the bytes free on the filesystem of path,
+	// used for MinFreeBytes. By default they are returned by statfs.
+	FreeSpace func(path string) (int64, error)
+	// Optional function returning the root directory where the files of the
+	// packages built for arch are downloaded, in place of the root passed to
+	// DownloadPackageFiles, e.g. to spread a mirror across several volumes.
+	ArchRoot func(arch string) string
+	// When greater than zero, DownloadPackageFiles only downloads the first
+	// MaxFilesPerPackage files of each package, e.g. for a quick test of a
+	// mirror setup.
+	MaxFilesPerPackage int
+	// When true, the package binaries are listed with the binaryversions
+	// view, that also reports the MD5 checksum of the RPM headers. That view
+	// has no modification times, and sizes are rounded up to KiB.
+	BinaryVersions bool
+	// When true, the architectures are named after their canonical RPM name
+	// in the local layout and in the ArchRoot calls, e.g. "x86_64" also for
+	// an "amd64" OBS architecture.
+	NormalizeArchs bool
+	// Optional local directory with a previous mirror, in the same layout.
+	// The files it already holds, with the same name and size, are not
+	// downloaded by DownloadPackageFiles: they are hard-linked from there on
+	// the local filesystem, or just skipped when that is not possible.
+	ReferenceDir string
+	// Decompressors of the binary files DownloadPackageFiles stores
+	// decompressed, by file extension, e.g. {".gz": GzipDecompressor}. The
+	// local files are named without the extension. By default the files are
+	// stored as downloaded. Requires the FileStorage.
+	Decompress map[string]Decompressor
+	// Optional local manifest of the files available elsewhere, e.g. from an
+	// upstream mirror, that DownloadPackageFiles skips. Each line has the
+	// name of a file and its size in bytes, separated by spaces. The name
+	// may have a directory, which is ignored: files are skipped when both
+	// their name and exact size match. Empty lines and lines starting with #
+	// are ignored. Checksum lists, such as SHA256SUMS, are not accepted,
+	// since OBS does not list the checksums of the binaries to match.
+	ExclusionManifest string
+
+	// Set by Close
+	closed int32
+	// Bytes of the ByteBudget used by the DownloadPackageFiles calls
+	budget byteBudget
+	// Cached content of the ExclusionManifest
+	excluded        map[string]bool
+	exclusionsMutex sync.Mutex
+	// Cached result of About
+	about      *ServerInfo
+	aboutMutex sync.Mutex
 }
 
 // PackageInfo groups information related to an OBS package.
@@ -43,181 +320,1152 @@ type PackageInfo struct {
 	Arch string
 	// The list of binary files built for the package
 	Files []PkgBinary
+	// Number of binary files listed for the package by OBS, including those
+	// not selected in Files
+	ListedFiles int
+}
+
+// Returns the PackageInfo of the package name built for the given repo and
+// arch, including its binary files. An error matching ErrNotFound is returned
+// when the package does not exist.
+func (proj *Project) GetPackage(repo, arch, name string) (PackageInfo, error) {
+	pkg := PackageInfo{
+		Name: name,
+		Repo: repo,
+		Arch: arch,
+	}
+
+	err := proj.PackageBinaries(&pkg)
+	return pkg, err
+}
+
+// Returns the PackageInfo, including the binary files, of every package built
+// for the given repo and arch.
+func (proj *Project) RepoArchBinaries(repo, arch string) ([]PackageInfo, error) {
+	pkgs, err := proj.ListPackages(repo, arch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get list of pkgs for repo %s arch %s", repo, arch)
+	}
+
+	pkgList := make([]PackageInfo, 0, len(pkgs))
+	for _, name := range pkgs {
+		pkg, err := proj.GetPackage(repo, arch, name)
+		if isNotFound(err) {
+			logrus.WithFields(logrus.Fields{
+				"repo":    repo,
+				"arch":    arch,
+				"package": name,
+			}).Warn("OBS package not found, skipping")
+			continue
+		}
+		if err != nil {
+			return pkgList, err
+		}
+		pkgList = append(pkgList, pkg)
+	}
+
+	return pkgList, nil
 }
 
 // Given a PackageInfo instance, returns all binary Package files published
-// on the OBS project, whose names match the binaryPackageRE regular expression.
+// on the OBS project that are selected by the project BinaryMatcher, by
+// default the rpm and deb packages built for the package architecture.
 func (proj *Project) PackageBinaries(pkg *PackageInfo) error {
-	debArchitectures := map[string]string{
-		"x86_64":  "amd64",
-		"aarch64": "arm64",
-		"ppc64le": "ppc64el",
-		"s390x":   "s390x",
+	return proj.packageBinaries(context.Background(), pkg)
+}
+
+func (proj *Project) packageBinaries(ctx context.Context, pkg *PackageInfo) error {
+	matcher, err := proj.matcher(pkg.Arch)
+	if err != nil {
+		return err
 	}
-	debArch, ok := debArchitectures[pkg.Arch]
-	if !ok {
-		return errors.Errorf("Cannot find corresponding debian architecture to %s", pkg.Arch)
+
+	var constraint *versionConstraint
+	if proj.VersionConstraint != "" {
+		if constraint, err = parseVersionConstraint(proj.VersionConstraint); err != nil {
+			return err
+		}
 	}
-	debExtensionRE := fmt.Sprintf(`_(all|%s)\.deb`, debArch)
-	rpmExtensionRE := fmt.Sprintf(`\.(noarch|%s)\.rpm`, pkg.Arch)
-	binaryPackageRE := fmt.Sprintf(`(%s|%s)$`, rpmExtensionRE, debExtensionRE)
 
 	pkg.Path = path.Join(pkg.Repo, pkg.Arch, pkg.Name)
 	logrus.WithFields(logrus.Fields{
 		"path": pkg.Path,
 	}).Debug("Retrieving OBS package binaries")
-	allBins, err := proj.listBinaries(pkg.Path)
+	allBins, err := proj.listBinaries(ctx, pkg.Path)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to get get list of OBS binaries")
 	}
 
-	re := regexp.MustCompile(binaryPackageRE)
+	pkg.ListedFiles = len(allBins)
+	seen := make(map[string]bool, len(allBins))
 
 	for _, b := range allBins {
 		logrus.WithFields(logrus.Fields{
 			"file": b,
 		}).Debug("OBS processing package file")
-		if re.Match([]byte(b.Filename)) {
-			pkg.Files = append(pkg.Files, b)
+		if !matcher.Match(b) {
+			continue
+		}
+
+		selected, err := proj.globSelected(b.Filename)
+		if err != nil {
+			return err
+		}
+		if !selected {
+			logrus.WithFields(logrus.Fields{
+				"file": b.Filename,
+			}).Debug("OBS package file filtered out by glob patterns")
+			continue
 		}
+
+		if proj.MinBinarySize > 0 {
+			size, err := b.SizeBytes()
+			if err != nil {
+				return err
+			}
+			if size < proj.MinBinarySize {
+				logrus.WithFields(logrus.Fields{
+					"file": b.Filename,
+					"size": size,
+				}).Info("Skipping OBS package file smaller than minimum size")
+				continue
+			}
+		}
+
+		if constraint != nil && !versionSelected(constraint, b.Filename) {
+			logrus.WithFields(logrus.Fields{
+				"file": b.Filename,
+			}).Debug("OBS package file filtered out by version constraint")
+			continue
+		}
+
+		if seen[b.Filename] {
+			switch proj.DuplicateFiles {
+			case DuplicatesError:
+				return errors.Errorf("duplicate file %s in package %s", b.Filename, pkg.Path)
+			case DuplicatesRemove:
+				logrus.WithFields(logrus.Fields{
+					"file": b.Filename,
+				}).Warn("Skipping duplicate OBS package file")
+				continue
+			}
+		}
+		seen[b.Filename] = true
+
+		pkg.Files = append(pkg.Files, b)
 	}
+	// Stable, to keep the listing order of the duplicate files.
+	sort.SliceStable(pkg.Files, func(i, j int) bool {
+		return pkg.Files[i].Filename < pkg.Files[j].Filename
+	})
+
+	logrus.WithFields(logrus.Fields{
+		"path":    pkg.Path,
+		"listed":  pkg.ListedFiles,
+		"matched": len(pkg.Files),
+	}).Debug("OBS package files selected")
 
 	return nil
 }
 
-// Returns all the packages files published on the OBS project.
+// Reports whether filename satisfies the version constraint. Files which are
+// not RPMs, or whose name cannot be parsed, are selected. Detached signatures
+// are selected with their RPM.
+func versionSelected(constraint *versionConstraint, filename string) bool {
+	filename = strings.TrimSuffix(strings.TrimSuffix(filename, ".asc"), ".sig")
+	if !isRPM(filename) {
+		return true
+	}
+
+	nevra, err := ParseRPMFilename(filename)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"file":  filename,
+			"error": err,
+		}).Warn("Cannot parse OBS RPM filename for version constraint")
+		return true
+	}
+	return constraint.match(nevra)
+}
+
+// Reports whether filename is selected by the Include and Exclude patterns.
+func (proj *Project) globSelected(filename string) (bool, error) {
+	for _, pattern := range proj.Exclude {
+		match, err := path.Match(pattern, filename)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid exclude pattern %s", pattern)
+		}
+		if match {
+			return false, nil
+		}
+	}
+
+	if len(proj.Include) == 0 {
+		return true, nil
+	}
+
+	for _, pattern := range proj.Include {
+		match, err := path.Match(pattern, filename)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid include pattern %s", pattern)
+		}
+		if match {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Returns all the packages files published on the OBS project. The packages
+// are in a deterministic order, independent of the OBS responses: sorted by
+// repository, then architecture, then package name, with the files of each
+// package sorted by name. Names are compared byte-wise, so case-sensitively.
 func (proj *Project) FindAllPackages() ([]PackageInfo, error) {
+	return proj.findAllPackagesList(context.Background())
+}
+
+// Returns all the packages files like FindAllPackages, with the progress bar
+// disabled when ctx has the noProgressKey.
+func (proj *Project) findAllPackagesList(ctx context.Context) ([]PackageInfo, error) {
+	if proj.CheckpointFile != "" {
+		return proj.findAllPackagesCheckpoint(ctx, proj.CheckpointFile, nil)
+	}
+
+	var pkgList []PackageInfo
+
+	err := proj.findAllPackages(ctx, func(pkg PackageInfo) error {
+		pkgList = append(pkgList, pkg)
+		return nil
+	})
+
+	return pkgList, err
+}
+
+// Finds all the packages files published on the OBS project like
+// FindAllPackages, but calls fn with each package as soon as its files have
+// been enumerated. Enumeration stops at the first error returned by fn, and
+// that error is returned.
+func (proj *Project) FindAllPackagesStream(fn func(PackageInfo) error) error {
+	return proj.findAllPackages(context.Background(), fn)
+}
+
+// Returns all the packages files published on the OBS project like
+// FindAllPackages, stopping when ctx is done. In that case the packages
+// enumerated so far are returned together with the context error.
+func (proj *Project) FindAllPackagesContext(ctx context.Context) ([]PackageInfo, error) {
 	var pkgList []PackageInfo
 
+	err := proj.findAllPackages(ctx, func(pkg PackageInfo) error {
+		pkgList = append(pkgList, pkg)
+		return nil
+	})
+
+	return pkgList, err
+}
+
+// Returns all the binary files published on the OBS project, as enumerated by
+// FindAllPackages, each with its Repo, Arch and Package set.
+func (proj *Project) AllBinaries() ([]PkgBinary, error) {
+	var binaries []PkgBinary
+
+	err := proj.FindAllPackagesStream(func(pkg PackageInfo) error {
+		for _, f := range pkg.Files {
+			f.Repo, f.Arch = pkg.Repo, pkg.Arch
+			if f.Package == "" {
+				f.Package = pkg.Name
+			}
+			binaries = append(binaries, f)
+		}
+		return nil
+	})
+
+	return binaries, err
+}
+
+// Returns the newest modification time of the binary files published on the
+// OBS project, or the zero time if there are none. The whole project is
+// enumerated, as OBS has no cheaper route for it: neither the project _meta
+// nor the repository binary lists (_repository) report the files mtime.
+func (proj *Project) LastModified() (time.Time, error) {
+	return proj.LastModifiedContext(context.Background())
+}
+
+// Returns the newest modification time of the binary files published on the
+// OBS project like LastModified, stopping when ctx is done.
+func (proj *Project) LastModifiedContext(ctx context.Context) (time.Time, error) {
+	var newest int64
+
+	err := proj.findAllPackages(ctx, func(pkg PackageInfo) error {
+		for _, f := range pkg.Files {
+			mtime, err := f.MtimeUnix()
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"file":  f.Filename,
+					"error": err,
+				}).Warn("Ignoring OBS file without a valid mtime")
+				continue
+			}
+			if mtime > newest {
+				newest = mtime
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if newest == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(newest, 0), nil
+}
+
+func (proj *Project) findAllPackages(ctx context.Context, fn func(PackageInfo) error) error {
+	return proj.findAllPackagesFrom(ctx, nil, fn)
+}
+
+// Enumerates the project packages like findAllPackages. When from is not nil,
+// the packages up to the checkpoint position are skipped, since they have
+// already been enumerated.
+func (proj *Project) findAllPackagesFrom(ctx context.Context, from *Checkpoint, fn func(PackageInfo) error) error {
 	logrus.WithFields(logrus.Fields{
 		"project": proj.Name,
 	}).Debug("Finding all OBS packages and files")
 
-	progressBar := pb.New(0)
-	progressBar.SetMaxWidth(100)
+	progressBar := proj.newProgressBar(ctx, 0, pb.U_NO)
 	progressBar.Start()
 	defer progressBar.Finish()
 
-	repos, err := proj.ListRepos()
+	repos, err := proj.listRepos(ctx)
 	if err != nil {
-		return pkgList, errors.Wrapf(err, "failed to get list of repos for project %s\n", proj.Name)
+		return contextError(ctx, errors.Wrapf(err, "failed to get list of repos for project %s\n", proj.Name))
 	}
 
+	metas := proj.metaOnce()
+	if proj.SkipAliasRepos {
+		repos = proj.skipAliasRepos(ctx, repos, metas)
+	}
+	sort.Strings(repos)
+
+	total := 0
+	nFiles := 0
+	skipping := false
+	if from != nil {
+		for _, pkg := range from.Packages {
+			nFiles += len(pkg.Files)
+		}
+		skipping = from.Package != ""
+	}
+
+	// The repos, archs and packages are sorted, so the enumeration also
+	// continues from the next entry when the checkpoint one has been
+	// removed.
 	for _, repo := range repos {
-		archs, err := proj.ListArchs(repo)
+		if skipping && repo < from.Repo {
+			continue
+		}
+		if skipping && repo != from.Repo {
+			skipping = false
+		}
+
+		archs, err := proj.listArchs(ctx, repo, metas)
 		if err != nil {
-			return pkgList, errors.Wrapf(err, "failed to get list of archs for project %s\n", proj.Name)
+			return contextError(ctx, errors.Wrapf(err, "failed to get list of archs for project %s\n", proj.Name))
 		}
 
+		if len(archs) == 0 {
+			logrus.WithFields(logrus.Fields{
+				"repo": repo,
+			}).Debug("No architectures found in OBS repo")
+			continue
+		}
+		sort.Strings(archs)
+
 		for _, arch := range archs {
-			pkgs, err := proj.ListPackages(repo, arch)
+			if skipping && arch < from.Arch {
+				continue
+			}
+			if skipping && arch != from.Arch {
+				skipping = false
+			}
+
+			pkgs, err := proj.listPackages(ctx, repo, arch)
 			if err != nil {
-				return pkgList, errors.Wrapf(err, "failed to get list of pkgs for project %s\n", proj.Name)
+				return contextError(ctx, errors.Wrapf(err, "failed to get list of pkgs for project %s\n", proj.Name))
+			}
+
+			if len(pkgs) == 0 {
+				logrus.WithFields(logrus.Fields{
+					"repo": repo,
+					"arch": arch,
+				}).Debug("No packages found in OBS repo arch")
+				// The checkpoint arch may have been emptied since.
+				skipping = false
+				continue
 			}
 
+			total += len(pkgs)
+			progressBar.SetTotal(total)
+			sort.Strings(pkgs)
+
 			for _, pkg := range pkgs {
-				if progressBar.Get() == 0 {
-					progressBar.SetTotal(len(repos) * len(pkgs) * len(archs))
+				if ctx.Err() != nil {
+					return ctx.Err()
 				}
 
 				progressBar.Increment()
 
+				if skipping && pkg <= from.Package {
+					continue
+				}
+				skipping = false
+
 				newPkg := PackageInfo{
 					Name: pkg,
 					Repo: repo,
 					Arch: arch,
 				}
 
-				err := proj.PackageBinaries(&newPkg)
+				err := proj.packageBinaries(ctx, &newPkg)
+				if isNotFound(err) {
+					logrus.WithFields(logrus.Fields{
+						"repo":    repo,
+						"arch":    arch,
+						"package": pkg,
+					}).Warn("OBS package not found, skipping")
+					continue
+				}
 				if err != nil {
-					return pkgList, err
+					return contextError(ctx, err)
 				}
 
-				pkgList = append(pkgList, newPkg)
+				nFiles += len(newPkg.Files)
+				if err := fn(newPkg); err != nil {
+					return err
+				}
 			}
+			skipping = false
 		}
 	}
 
-	return pkgList, nil
+	if skipping {
+		return errors.Wrapf(errCheckpointPastEnd, "Checkpoint position %s/%s not found in project %s", from.Repo, from.Arch, proj.Name)
+	}
+
+	if proj.RequireNonEmpty && nFiles == 0 {
+		return ErrEmptyProject
+	}
+
+	return nil
 }
 
-// Downloads all the files specified in the passed pkgInfo argument, and returns
-// a slice with a list of the locally downloaded files.
-func (proj *Project) DownloadPackageFiles(pkgInfo PackageInfo, root string) ([]string, error) {
+// Downloads all the files specified in the passed pkgInfo argument into the
+// project Storage, and returns a slice with a list of the downloaded files,
+// together with the number of bytes transferred. Files already downloaded are
+// not counted in the transferred bytes.
+func (proj *Project) DownloadPackageFiles(pkgInfo PackageInfo, root string) ([]string, int64, error) {
+	return proj.DownloadPackageFilesContext(context.Background(), pkgInfo, root)
+}
+
+// Downloads all the files specified in the passed pkgInfo argument like
+// DownloadPackageFiles, stopping when ctx is done, e.g. to bound a whole mirror
+// job with a deadline shared with FindAllPackagesContext. In that case the
+// files completely downloaded so far are returned together with the context
+// error.
+func (proj *Project) DownloadPackageFilesContext(ctx context.Context, pkgInfo PackageInfo, root string) ([]string, int64, error) {
+	return proj.downloadPackageFiles(ctx, pkgInfo, root, false, &fileCounts{}, &proj.budget)
+}
+
+// Downloads the package files like DownloadPackageFilesContext. When resume
+// is set, files are downloaded sequentially to a ".part" file, renamed once
+// complete, so that a ".part" file left by an interrupted download is
+// completed rather than downloaded again. This requires the FileStorage. The
+// files downloaded, skipped and failed are added to counts, and the bytes
+// downloaded to the budget of the run.
+func (proj *Project) downloadPackageFiles(ctx context.Context, pkgInfo PackageInfo, root string, resume bool, counts *fileCounts, budget *byteBudget) ([]string, int64, error) {
 	logrus.WithFields(logrus.Fields{
 		"project": proj.Name,
 		"repo":    pkgInfo.Repo,
 	}).Debug("Downloading OBS package files")
 
-	progressBar := pb.New(len(pkgInfo.Files))
-	progressBar.SetMaxWidth(100)
+	root, err := proj.archRoot(root, pkgInfo.Arch)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if proj.MaxFilesPerPackage > 0 && len(pkgInfo.Files) > proj.MaxFilesPerPackage {
+		pkgInfo.Files = pkgInfo.Files[:proj.MaxFilesPerPackage]
+	}
+
+	// The progress is tracked in bytes, so that a single big file weighs
+	// more than many small ones.
+	var totalSize int64
+	for _, f := range pkgInfo.Files {
+		if size, err := f.SizeBytes(); err == nil {
+			totalSize += size
+		}
+	}
+	progressBar := proj.newProgressBar(ctx, totalSize, pb.U_BYTES)
 	progressBar.Start()
 	defer progressBar.Finish()
 
+	store := proj.storage()
+	var total int64
+	var errs MultiError
+
+	var sums map[string]string
+	sumsFile := filepath.Join(root, proj.Name, proj.localPkgPath(pkgInfo), checksumsFileName)
+	if proj.Checksums {
+		var err error
+		if sums, err = readChecksums(store, sumsFile); err != nil {
+			return nil, total, err
+		}
+	}
+
+	if proj.debianPool() {
+		if err := proj.prepareDists(root, pkgInfo); err != nil {
+			return nil, total, err
+		}
+	}
+	if _, ok := store.(FileStorage); proj.Layout == LayoutObjects && !ok {
+		return nil, total, errors.New("LayoutObjects requires the local FileStorage")
+	}
+	if _, ok := store.(FileStorage); len(proj.Decompress) > 0 && !ok {
+		return nil, total, errors.New("Decompress requires the local FileStorage")
+	}
+
+	excluded, err := proj.exclusions()
+	if err != nil {
+		return nil, total, err
+	}
+
 	filePaths := make([]string, 0, len(pkgInfo.Files))
 	for _, f := range pkgInfo.Files {
-		remotePath := path.Join(pkgInfo.Path, f.Filename)
-		localFile := filepath.Join(root, proj.Name, remotePath)
-		filePaths = append(filePaths, localFile)
+		if ctx.Err() != nil {
+			return filePaths, total, ctx.Err()
+		}
 
-		info, err := os.Stat(localFile)
-		if !(err == nil || os.IsNotExist(err)) {
-			return filePaths, err
+		if isExcluded(excluded, f) {
+			logrus.WithFields(logrus.Fields{
+				"filename": f.Filename,
+			}).Debug("OBS file listed in the exclusion manifest, skipping")
+			if size, err := f.SizeBytes(); err == nil {
+				progressBar.Add64(size)
+			}
+			counts.skipped++
+			continue
 		}
 
-		fsize, err := strconv.Atoi(f.Size)
+		remotePath := path.Join(binaryPath(pkgInfo), f.Filename)
+		localFile := proj.localPath(root, pkgInfo, f)
+		filePaths = append(filePaths, localFile)
+		// Name of the local file, in the checksums file
+		name := filepath.Base(localFile)
+
+		downloaded, err := proj.isDownloaded(store, localFile, f)
 		if err != nil {
-			return filePaths, errors.Wrapf(err, "could not parse file size %s", localFile)
+			return filePaths, total, err
+		}
+		size, _ := f.SizeBytes()
+
+		// The checksums recorded by a previous run are trusted, unless a full
+		// verification is forced.
+		if downloaded && proj.Checksums && (sums[name] == "" || proj.ForceVerify) {
+			sum, err := hashFile(store, localFile)
+			if err != nil {
+				return filePaths, total, errors.Wrapf(err, "could not compute checksum of %s", localFile)
+			}
+			if recorded := sums[name]; recorded != "" && recorded != sum {
+				logrus.WithFields(logrus.Fields{
+					"filename": localFile,
+				}).Warn("Local OBS file checksum mismatch, downloading it again")
+				downloaded = false
+			}
+			sums[name] = sum
+		}
+
+		if !downloaded {
+			if err := proj.checkLocalSize(store, localFile, f); err != nil {
+				counts.failed++
+				return filePaths[:len(filePaths)-1], total, err
+			}
 		}
 
-		if info != nil && info.Size() == int64(fsize) {
+		if downloaded {
 			logrus.WithFields(logrus.Fields{
 				"filename": f.Filename,
 			}).Debug("OBS file already downloaded")
-			progressBar.Increment()
+			progressBar.Add64(size)
+			counts.skipped++
+			continue
+		}
+
+		if proj.ReferenceDir != "" {
+			found, linked, err := proj.linkReference(store, pkgInfo, f, localFile)
+			if err != nil {
+				return filePaths, total, err
+			}
+			if found && !linked {
+				// The file is only in the reference directory.
+				filePaths = filePaths[:len(filePaths)-1]
+			}
+			if linked && proj.Checksums {
+				if sums[name], err = hashFile(store, localFile); err != nil {
+					return filePaths, total, errors.Wrapf(err, "could not compute checksum of %s", localFile)
+				}
+			}
+			if found {
+				progressBar.Add64(size)
+				counts.skipped++
+				continue
+			}
+		}
+
+		if err := proj.checkFreeSpace(root); err != nil {
+			return filePaths[:len(filePaths)-1], total, err
+		}
+
+		if !proj.reserveBudget(budget, size) {
+			logrus.WithFields(logrus.Fields{
+				"filename": f.Filename,
+				"size":     size,
+			}).Info("OBS download byte budget exceeded, stopping")
+			return filePaths[:len(filePaths)-1], total, errors.Wrapf(ErrBudgetExceeded, "%s", remotePath)
+		}
+
+		// With LayoutObjects, the file is moved to the objects store once
+		// its checksum is known. Decompressed files are renamed once
+		// complete, since their size cannot be checked. Local files are
+		// renamed too, replacing rather than rewriting a file hard linked
+		// from the ReferenceDir or from another repo, and never leaving a
+		// file of the expected size with the holes of failed ranges.
+		_, local := store.(FileStorage)
+		dec, _ := proj.decompressor(f.Filename)
+		dlFile := localFile
+		if proj.Layout == LayoutObjects || resume || dec != nil || local {
+			dlFile = localFile + ".part"
+		}
+
+		var h hash.Hash
+		if proj.Checksums || proj.Layout == LayoutObjects || proj.linkRepoDuplicates() {
+			h = sha256.New()
+		}
+
+		// Decompressed downloads cannot be resumed.
+		var destFile io.WriteCloser
+		var offset int64
+		if resume && dec == nil {
+			destFile, offset, err = openPartial(dlFile, f, h)
+		} else {
+			destFile, err = store.Create(dlFile)
+		}
+		if err != nil {
+			return filePaths, total, errors.Wrapf(err, "could not create local file %s", dlFile)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"filename": f.Filename,
+			"offset":   offset,
+		}).Debug("Downloading OBS file")
+
+		var written int64
+		// Ranges need the exact size, unknown with the binaryversions view,
+		// and leave holes in interrupted downloads, that cannot be resumed.
+		multiConn := h == nil && !resume && f.Size != "" && dec == nil && proj.useMultiConn(size, destFile)
+		if multiConn {
+			written, err = proj.downloadRanges(ctx, remotePath, f.DownloadURL, size, destFile.(io.WriterAt))
+			progressBar.Add64(written)
+		} else if dec != nil {
+			// The checksum is the one of the decompressed local file.
+			var out io.Writer = destFile
+			if h != nil {
+				out = io.MultiWriter(destFile, h)
+			}
+			dw := newDecompressWriter(out, dec)
+			dest := io.MultiWriter(proj.progressWriter(dw, f, 0), progressBar)
+			written, err = proj.downloadBinary(ctx, remotePath, f.DownloadURL, dest, nil)
+			if closeErr := dw.Close(); err == nil && closeErr != nil {
+				err = errors.Wrapf(closeErr, "could not decompress %s", f.Filename)
+			}
+		} else {
+			progressBar.Add64(offset)
+			dest := io.MultiWriter(proj.progressWriter(destFile, f, offset), progressBar)
+			written, err = proj.downloadBinaryFrom(ctx, remotePath, f.DownloadURL, dest, h, offset)
+		}
+		total += written
+		// Only the bytes actually downloaded count.
+		proj.releaseBudget(budget, size-written)
+		if closeErr := destFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil && proj.RPMVerifier != nil && isRPM(f.Filename) {
+			if err = proj.verifyLocalRPM(store, dlFile); err != nil {
+				// Truncate the file, so that it is downloaded again.
+				if w, createErr := store.Create(dlFile); createErr == nil {
+					w.Close()
+				}
+			}
+		} else if err != nil && multiConn && !local {
+			// The failed ranges left holes in the file, written to its full
+			// size, that must not be taken as complete by the next run.
+			if w, createErr := store.Create(dlFile); createErr == nil {
+				w.Close()
+			}
+		}
+		if err == nil && proj.Layout == LayoutObjects {
+			err = storeObject(root, dlFile, hex.EncodeToString(h.Sum(nil)), localFile)
+		} else if err == nil && dlFile != localFile {
+			err = os.Rename(dlFile, localFile)
+		}
+		// Only the partial downloads to resume are kept.
+		if err != nil && local && !resume {
+			os.Remove(dlFile)
+		}
+		if err != nil && ctx.Err() != nil {
+			return filePaths[:len(filePaths)-1], total, ctx.Err()
+		}
+		if err != nil && proj.ContinueOnDownloadError {
+			logrus.WithFields(logrus.Fields{
+				"filename": f.Filename,
+				"error":    err,
+			}).Warn("Failed to download OBS file, continuing")
+			errs = append(errs, errors.Wrapf(err, "could not download binary at %s", remotePath))
+			filePaths = filePaths[:len(filePaths)-1]
+			delete(sums, name)
+			counts.failed++
+			continue
+		}
+		if err != nil {
+			counts.failed++
+			return filePaths, total, errors.Wrapf(err, "could not download binary at %s", remotePath)
+		}
+		counts.downloaded++
+
+		if proj.Checksums {
+			sums[name] = hex.EncodeToString(h.Sum(nil))
+		}
+		if proj.linkRepoDuplicates() {
+			proj.linkRepoDuplicate(root, pkgInfo, f, localFile, hex.EncodeToString(h.Sum(nil)))
+		}
+	}
+
+	if proj.Checksums {
+		names := make([]string, 0, len(pkgInfo.Files))
+		for _, f := range pkgInfo.Files {
+			names = append(names, filepath.Base(proj.localPath(root, pkgInfo, f)))
+		}
+		if err := writeChecksums(store, sumsFile, sums, names); err != nil {
+			return filePaths, total, err
+		}
+	}
+
+	if len(errs) > 0 {
+		return filePaths, total, errs
+	}
+	return filePaths, total, nil
+}
+
+// Returns the OBS path of the binaries of the package, that is its Path, or
+// <repo>/<arch>/<name> when Path is not set.
+func binaryPath(pkgInfo PackageInfo) string {
+	if pkgInfo.Path == "" {
+		return path.Join(pkgInfo.Repo, pkgInfo.Arch, pkgInfo.Name)
+	}
+	return pkgInfo.Path
+}
+
+// Returns the metadata of the binary file filename of the package, such as its
+// size and mtime, without downloading it. They are listed with the
+// binaryversions view when BinaryVersions is set. The returned error matches
+// ErrNotFound, via errors.Is, when the package has no such file.
+func (proj *Project) BinaryInfo(pkgInfo PackageInfo, filename string) (PkgBinary, error) {
+	pkgPath := binaryPath(pkgInfo)
+	bins, err := proj.listBinaries(context.Background(), pkgPath)
+	if err != nil {
+		return PkgBinary{}, errors.Wrapf(err, "Failed to get list of OBS binaries")
+	}
+	for _, b := range bins {
+		if b.Filename == filename {
+			return b, nil
+		}
+	}
+	return PkgBinary{}, errors.Wrapf(ErrNotFound, "no binary %s in package %s", filename, pkgPath)
+}
+
+// Returns the URL the binary file filename of the package is downloaded from,
+// without making any request: its DownloadURL, when listed in pkgInfo.Files,
+// or else its API URL.
+func (proj *Project) BinaryURL(pkgInfo PackageInfo, filename string) string {
+	for _, f := range pkgInfo.Files {
+		if f.Filename == filename && f.DownloadURL != "" {
+			return f.DownloadURL
+		}
+	}
+
+	return proj.requestURL(proj.buildPath(path.Join(binaryPath(pkgInfo), filename), nil))
+}
+
+// Streams the binary file named filename, which must be one of the files in
+// the passed pkgInfo argument, to the writer w, without storing it locally.
+func (proj *Project) DownloadBinaryTo(ctx context.Context, pkgInfo PackageInfo, filename string, w io.Writer) error {
+	for _, f := range pkgInfo.Files {
+		if f.Filename != filename {
 			continue
 		}
 
-		err = os.MkdirAll(filepath.Dir(localFile), 0700)
+		remotePath := path.Join(binaryPath(pkgInfo), f.Filename)
+		logrus.WithFields(logrus.Fields{
+			"filename": f.Filename,
+		}).Debug("Streaming OBS file")
+
+		_, err := proj.downloadBinary(ctx, remotePath, f.DownloadURL, proj.progressWriter(w, f, 0), nil)
+		if err != nil {
+			return errors.Wrapf(err, "could not download binary at %s", remotePath)
+		}
+		return nil
+	}
+
+	return errors.Errorf("file %s not found in package %s", filename, pkgInfo.Name)
+}
+
+// Downloads all the binaries of package pkg, built for the given repo and arch,
+// with a single request returning them as a cpio archive. The binaries are
+// extracted into the project Storage under root/<project>/<repo>/<arch>/<pkg>,
+// as with the default LayoutOBS of DownloadPackageFiles, and a slice with the
+// list of extracted files is returned. Layout, ArchRoot, NormalizeArchs and
+// Decompress are not applied.
+func (proj *Project) DownloadCPIO(repo, arch, pkg string, root string) ([]string, error) {
+	pkgPath := path.Join(repo, arch, pkg)
+	logrus.WithFields(logrus.Fields{
+		"project": proj.Name,
+		"path":    pkgPath,
+	}).Debug("Downloading OBS package files as cpio")
+
+	resp, err := proj.obsRequestQuery(context.Background(), pkgPath, url.Values{"view": {"cpio"}})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not download cpio archive of %s", pkgPath)
+	}
+	defer resp.Close()
+
+	store := proj.storage()
+	_, local := store.(FileStorage)
+	var filePaths []string
+	archive := newCpioReader(resp)
+	for {
+		hdr, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return filePaths, errors.Wrapf(err, "could not extract cpio archive of %s", pkgPath)
+		}
+
+		if !hdr.isRegular() {
+			continue
+		}
+
+		// Binaries are stored without directory, do not trust the archive
+		// to escape the package path.
+		name := path.Base(hdr.Name)
+		if hdr.Name == "" || name == "." || name == ".." || name == "/" {
+			return filePaths, errors.Errorf("invalid cpio entry name %q in %s", hdr.Name, pkgPath)
+		}
+		localFile := filepath.Join(root, proj.Name, pkgPath, name)
+
+		// Local files are renamed once complete, never leaving a truncated
+		// file in place of a previous download.
+		dlFile := localFile
+		if local {
+			dlFile = localFile + ".part"
+		}
+		destFile, err := store.Create(dlFile)
+		if err != nil {
+			return filePaths, errors.Wrapf(err, "could not create local file %s", dlFile)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"filename": hdr.Name,
+		}).Debug("Extracting OBS file")
+
+		_, err = io.Copy(destFile, archive)
+		if closeErr := destFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil && dlFile != localFile {
+			err = os.Rename(dlFile, localFile)
+		}
 		if err != nil {
-			return filePaths, errors.Wrapf(err, "could not mkdir path %s", remotePath)
+			if local {
+				os.Remove(dlFile)
+			}
+			return filePaths, errors.Wrapf(err, "could not extract %s", hdr.Name)
+		}
+
+		filePaths = append(filePaths, localFile)
+	}
+
+	return filePaths, nil
+}
+
+// Returns the list of source files, such as .spec, .changes and .dsc, of the
+// package pkg.
+func (proj *Project) SourceFiles(pkg string) ([]PkgBinary, error) {
+	logrus.WithFields(logrus.Fields{
+		"project": proj.Name,
+		"package": pkg,
+	}).Debug("Retrieving OBS package source files")
+
+	files, err := proj.listSourceFiles(context.Background(), pkg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get list of source files for package %s", pkg)
+	}
+	return files, nil
+}
+
+// Returns the attributes of the source listing of the package pkg, such as
+// its revision and srcmd5, to check whether its sources changed without
+// downloading them.
+func (proj *Project) SourceInfo(pkg string) (DirInfo, error) {
+	list, err := proj.readSourceList(context.Background(), pkg)
+	if err != nil {
+		return DirInfo{}, errors.Wrapf(err, "failed to get source info for package %s", pkg)
+	}
+	return list.DirInfo, nil
+}
+
+// Downloads the source files of the package pkg, as returned by SourceFiles,
+// into the project Storage under root/<project>/_source/<pkg>, and returns a
+// slice with a list of the downloaded files.
+func (proj *Project) DownloadSourceFiles(pkg string, files []PkgBinary, root string) ([]string, error) {
+	store := proj.storage()
+	filePaths := make([]string, 0, len(files))
+	for _, f := range files {
+		// The names come from the server, do not let them escape the
+		// package directory.
+		if path.Base(f.Filename) != f.Filename || f.Filename == ".." || f.Filename == "." {
+			return filePaths, errors.Errorf("invalid source file name %q in package %s", f.Filename, pkg)
 		}
+		localFile := filepath.Join(root, proj.Name, "_source", pkg, f.Filename)
 
-		destFile, err := os.Create(localFile)
+		destFile, err := store.Create(localFile)
 		if err != nil {
 			return filePaths, errors.Wrapf(err, "could not create local file %s", localFile)
 		}
 
 		logrus.WithFields(logrus.Fields{
 			"filename": f.Filename,
-		}).Debug("Downloading OBS file")
+		}).Debug("Downloading OBS source file")
 
-		err = proj.downloadBinary(remotePath, destFile)
+		resp, err := proj.sourceRequest(context.Background(), path.Join(pkg, f.Filename))
+		if err == nil {
+			_, err = io.Copy(destFile, resp)
+			resp.Close()
+		}
+		if closeErr := destFile.Close(); err == nil {
+			err = closeErr
+		}
 		if err != nil {
-			return filePaths, errors.Wrapf(err, "could not download binary at %s", remotePath)
+			return filePaths, errors.Wrapf(err, "could not download source file %s", f.Filename)
 		}
 
-		progressBar.Increment()
+		filePaths = append(filePaths, localFile)
 	}
 
 	return filePaths, nil
 }
 
+// Returns a progress bar counting up to total in the given units, customized
+// by the ProgressFormat hook, if any, which may change them. The bar is not
+// printed when ctx has the noProgressKey.
+func (proj *Project) newProgressBar(ctx context.Context, total int64, units pb.Units) *pb.ProgressBar {
+	progressBar := pb.New64(total)
+	progressBar.SetUnits(units)
+	progressBar.SetMaxWidth(100)
+	if proj.ProgressFormat != nil {
+		proj.ProgressFormat(progressBar)
+	}
+	if ctx.Value(noProgressKey{}) != nil {
+		progressBar.NotPrint = true
+	}
+	return progressBar
+}
+
+// Returns the sorted list of the distinct names of the packages built in any
+// repository and architecture of the project, without listing their files. The
+// repositories are filtered as done by FindAllPackages.
+func (proj *Project) PackageNames() ([]string, error) {
+	ctx := context.Background()
+	repos, err := proj.listRepos(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get list of repos for project %s", proj.Name)
+	}
+
+	metas := proj.metaOnce()
+	if proj.SkipAliasRepos {
+		repos = proj.skipAliasRepos(ctx, repos, metas)
+	}
+
+	names := make(map[string]bool)
+	for _, repo := range repos {
+		archs, err := proj.listArchs(ctx, repo, metas)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get list of archs for project %s", proj.Name)
+		}
+
+		for _, arch := range archs {
+			pkgs, err := proj.listPackages(ctx, repo, arch)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get list of pkgs for project %s", proj.Name)
+			}
+			for _, pkg := range pkgs {
+				names[pkg] = true
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	return sorted, nil
+}
+
+// Performs an authenticated GET request for resource, a path relative to the
+// project under the build results routes, optionally followed by a query
+// string, e.g. "openSUSE_Tumbleweed/x86_64/_jobstatus". It returns the response
+// body together with the response itself, for endpoints not wrapped by this
+// package. The caller must close the returned body.
+func (proj *Project) Get(resource string) (io.ReadCloser, *http.Response, error) {
+	ctx := context.Background()
+	urlPath := proj.buildPath(resource, nil)
+	if i := strings.Index(resource, "?"); i >= 0 {
+		urlPath = proj.buildPath(resource[:i], nil) + resource[i:]
+	}
+
+	var resp *http.Response
+	err := proj.retry(ctx, proj.MaxRetries, func() error {
+		var err error
+		resp, err = proj.doRangeRequest(ctx, proj.httpClient(), urlPath, "")
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp.Body, resp, nil
+}
+
 // Returns a string slice with a list of repositories available in the project
 // proj.
 func (proj *Project) ListRepos() ([]string, error) {
-	return proj.listDirectories("")
+	return proj.listRepos(context.Background())
+}
+
+func (proj *Project) listRepos(ctx context.Context) ([]string, error) {
+	if len(proj.Repos) > 0 {
+		repos := make([]string, len(proj.Repos))
+		copy(repos, proj.Repos)
+		return proj.filterRepos(repos), nil
+	}
+
+	repos, err := proj.listEntries(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return proj.filterRepos(repos), nil
+}
+
+// Returns repos without the repositories listed in ExcludeRepos.
+func (proj *Project) filterRepos(repos []string) []string {
+	if len(proj.ExcludeRepos) == 0 {
+		return repos
+	}
+
+	excluded := make(map[string]bool, len(proj.ExcludeRepos))
+	for _, repo := range proj.ExcludeRepos {
+		excluded[repo] = true
+	}
+
+	filtered := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		if excluded[repo] {
+			logrus.WithFields(logrus.Fields{
+				"repo": repo,
+			}).Debug("Skipping excluded OBS repo")
+			continue
+		}
+		filtered = append(filtered, repo)
+	}
+	return filtered
 }
 
 // Returns a string slice with a list of target architectures available in the
 // repository repo inside project proj.
 func (proj *Project) ListArchs(repo string) ([]string, error) {
-	return proj.listDirectories(repo)
+	return proj.listArchs(context.Background(), repo, proj.metaOnce())
+}
+
+// Lists the architectures of repo like ListArchs, taking them from the _meta
+// retrieved by metas when ArchsFromMeta is set.
+func (proj *Project) listArchs(ctx context.Context, repo string, metas *metaOnce) ([]string, error) {
+	if proj.ArchsFromMeta {
+		archs, err := metas.archs(ctx, repo)
+		if err == nil {
+			return archs, nil
+		}
+		logrus.WithFields(logrus.Fields{
+			"repo":  repo,
+			"error": err,
+		}).Warn("Could not get archs from OBS _meta, using directory listing")
+	}
+
+	return proj.listEntries(ctx, repo)
 }
 
 // Returns a string slice with a list of packages for the given architecture arch,
 // repository repo inside the project proj.
 func (proj *Project) ListPackages(repo, arch string) ([]string, error) {
+	return proj.listPackages(context.Background(), repo, arch)
+}
+
+func (proj *Project) listPackages(ctx context.Context, repo, arch string) ([]string, error) {
 	url := path.Join(repo, arch)
-	return proj.listDirectories(url)
+	return proj.listEntries(ctx, url)
+}
+
+// Returns the attributes of the OBS build results listing at dirPath,
+// relative to the project, e.g. "repo/arch/package". They are empty when the
+// listing has none.
+func (proj *Project) DirectoryInfo(dirPath string) (DirInfo, error) {
+	list, err := proj.readDirList(context.Background(), dirPath)
+	if err != nil {
+		return DirInfo{}, errors.Wrapf(err, "failed to get directory info of %s", dirPath)
+	}
+	return list.DirInfo, nil
+}
+
+// Returns the directory entries at path, without the OBS pseudo-directories
+// unless IncludePseudoDirs is set.
+func (proj *Project) listEntries(ctx context.Context, path string) ([]string, error) {
+	dirs, err := proj.listDirectories(ctx, path)
+	if err != nil || proj.IncludePseudoDirs {
+		return dirs, err
+	}
+
+	entries := dirs[:0]
+	for _, d := range dirs {
+		if strings.HasPrefix(d, "_") || strings.HasPrefix(d, ":") {
+			logrus.WithFields(logrus.Fields{
+				"path":  path,
+				"entry": d,
+			}).Debug("Skipping OBS pseudo-directory")
+			continue
+		}
+		entries = append(entries, d)
+	}
+	return entries, nil
 }
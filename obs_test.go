@@ -0,0 +1,1240 @@
+package obsgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// Returns a server answering the requests like mockHandler.
+func mockServer(t *testing.T, routes map[string]string) *httptest.Server {
+	return httptest.NewServer(mockHandler(routes))
+}
+
+// Returns a handler answering the requests for the paths in routes, optionally
+// with their query, with the corresponding body, and 404 for the others.
+func mockHandler(routes map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "" {
+			if body, ok := routes[r.URL.Path+"?"+r.URL.RawQuery]; ok {
+				w.Write([]byte(body))
+				return
+			}
+		}
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	})
+}
+
+// Returns a directory listing with the given entries.
+func dir(names ...string) string {
+	s := "<directory>"
+	for _, name := range names {
+		s += `<entry name="` + name + `"/>`
+	}
+	return s + "</directory>"
+}
+
+// Returns a binary list with the given files, all of 1 byte.
+func testBinaryList(names ...string) string {
+	s := "<binarylist>"
+	for _, name := range names {
+		s += `<binary filename="` + name + `" size="1" mtime="100"/>`
+	}
+	return s + "</binarylist>"
+}
+
+// Returns the names of files.
+func fileNames(files []PkgBinary) []string {
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Filename)
+	}
+	return names
+}
+
+// Returns the routes of project "proj", with the pkga and pkgb packages built
+// for repo1/x86_64, and the empty repo _empty.
+func basicRoutes() map[string]string {
+	return map[string]string{
+		"/build/proj":                                                dir("repo1", "_empty"),
+		"/build/proj/repo1":                                          dir("x86_64"),
+		"/build/proj/_empty":                                         "<directory/>",
+		"/build/proj/repo1/x86_64":                                   dir("pkga", "pkgb"),
+		"/build/proj/repo1/x86_64/pkga":                              `<binarylist><binary filename="a-1.0-1.x86_64.rpm" size="5" mtime="100"/><binary filename="a-debuginfo-1.0-1.x86_64.rpm" size="3" mtime="100"/><binary filename="_log" size="2" mtime="1"/></binarylist>`,
+		"/build/proj/repo1/x86_64/pkgb":                              `<binarylist><binary filename="b-1.0-1.noarch.rpm" size="0" mtime="200"/></binarylist>`,
+		"/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm":           "AAAAA",
+		"/build/proj/repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm": "DDD",
+		"/build/proj/repo1/x86_64/pkgb/b-1.0-1.noarch.rpm":           "",
+	}
+}
+
+// Returns a hook recording the log entries of all levels until the end of
+// the test.
+func captureLogs(t *testing.T) *test.Hook {
+	logger := logrus.StandardLogger()
+	level := logger.GetLevel()
+	logger.SetLevel(logrus.DebugLevel)
+	hook := test.NewGlobal()
+	t.Cleanup(func() {
+		logger.ReplaceHooks(make(logrus.LevelHooks))
+		logger.SetLevel(level)
+	})
+	return hook
+}
+
+// Reports whether a message was logged with the given fields, among others.
+func logged(hook *test.Hook, message string, fields logrus.Fields) bool {
+	for _, e := range hook.AllEntries() {
+		if e.Message != message {
+			continue
+		}
+		match := true
+		for k, v := range fields {
+			if e.Data[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the project "proj" of the server at url, without progress bars.
+func testProject(url string) *Project {
+	return &Project{
+		Name:           "proj",
+		BaseURL:        url,
+		ProgressFormat: func(bar *pb.ProgressBar) { bar.NotPrint = true },
+		RetryDelay:     time.Millisecond,
+	}
+}
+
+func TestFindAndDownloadPackageFiles(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL + "/")
+
+	pkgs, err := proj.FindAllPackages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || len(pkgs[0].Files) != 2 || len(pkgs[1].Files) != 1 {
+		t.Fatalf("unexpected packages %+v", pkgs)
+	}
+
+	root := t.TempDir()
+	files, n, err := proj.DownloadPackageFiles(pkgs[0], root)
+	if err != nil || len(files) != 2 || n != 8 {
+		t.Fatalf("got %v, %d bytes, %v", files, n, err)
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil || string(data) != "AAAAA" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+}
+
+func TestFindAllPackagesStream(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	var names []string
+	err := proj.FindAllPackagesStream(func(pkg PackageInfo) error {
+		if pkg.Repo != "repo1" || pkg.Arch != "x86_64" || len(pkg.Files) == 0 {
+			t.Errorf("unexpected package %+v", pkg)
+		}
+		names = append(names, pkg.Name)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"pkga", "pkgb"}) {
+		t.Fatalf("got %v, %v", names, err)
+	}
+
+	// An error returned by the callback stops the enumeration.
+	stop := errors.New("stop")
+	names = nil
+	err = proj.FindAllPackagesStream(func(pkg PackageInfo) error {
+		names = append(names, pkg.Name)
+		return stop
+	})
+	if err != stop || !reflect.DeepEqual(names, []string{"pkga"}) {
+		t.Fatalf("got %v, %v", names, err)
+	}
+}
+
+func TestFindAllPackagesContextPartial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock := mockHandler(basicRoutes())
+	// The enumeration is canceled while listing the second package.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/build/proj/repo1/x86_64/pkgb" {
+			cancel()
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	pkgs, err := proj.FindAllPackagesContext(ctx)
+	if err != context.Canceled || len(pkgs) != 1 || pkgs[0].Name != "pkga" || len(pkgs[0].Files) != 2 {
+		t.Fatalf("got %+v, %v", pkgs, err)
+	}
+
+	if pkgs, err := proj.FindAllPackagesContext(ctx); err != context.Canceled || len(pkgs) != 0 {
+		t.Fatalf("got %+v, %v", pkgs, err)
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64"] = dir("pkga", "pkgb", "pkgc")
+	routes["/build/proj/repo1/x86_64/pkgc"] = `<binarylist>
+  <binary filename="c-1.0-1.x86_64.rpm" size="1" mtime="150"/>
+  <binary filename="c-doc-1.0-1.noarch.rpm" size="1" mtime="invalid"/>
+</binarylist>`
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	// The newest of all packages, the invalid mtime ignored.
+	if mtime, err := proj.LastModified(); err != nil || !mtime.Equal(time.Unix(200, 0)) {
+		t.Fatalf("got %v, %v", mtime, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if mtime, err := proj.LastModifiedContext(ctx); err != context.Canceled || !mtime.IsZero() {
+		t.Fatalf("got %v, %v", mtime, err)
+	}
+
+	empty := mockServer(t, map[string]string{"/build/proj": dir("repo1"), "/build/proj/repo1": dir()})
+	defer empty.Close()
+	if mtime, err := testProject(empty.URL).LastModified(); err != nil || !mtime.IsZero() {
+		t.Fatalf("got %v, %v", mtime, err)
+	}
+}
+
+func TestDownloadPackageFilesContextDeadline(t *testing.T) {
+	var names []string
+	routes := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("f%d-1.0-1.x86_64.rpm", i)
+		names = append(names, name)
+		routes["/build/proj/repo1/x86_64/pkga/"+name] = "F"
+	}
+	routes["/build/proj/repo1/x86_64/pkga"] = testBinaryList(names...)
+	mock := mockHandler(routes)
+	// Each file takes 100ms to download.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".rpm") {
+			time.Sleep(100 * time.Millisecond)
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const timeout = 250 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	files, n, err := proj.DownloadPackageFilesContext(ctx, pkg, t.TempDir())
+	elapsed := time.Since(start)
+
+	// The files completely downloaded before the deadline are returned.
+	if err != context.DeadlineExceeded || len(files) == 0 || len(files) >= len(names) || n != int64(len(files)) {
+		t.Fatalf("got %d files, %d bytes, %v", len(files), n, err)
+	}
+	for _, file := range files {
+		if data, err := ioutil.ReadFile(file); err != nil || string(data) != "F" {
+			t.Errorf("%s: got %q, %v", file, data, err)
+		}
+	}
+	if elapsed > timeout+200*time.Millisecond {
+		t.Errorf("aborted after %v", elapsed)
+	}
+}
+
+func TestDownloadPackageFilesBytes(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+	if err := proj.PackageBinaries(&pkg); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	files, n, err := proj.DownloadPackageFiles(pkg, root)
+	if err != nil || n != 8 {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+
+	// Only the missing file is transferred again, the one already downloaded
+	// is skipped and doesn't count.
+	if err := os.Remove(files[1]); err != nil {
+		t.Fatal(err)
+	}
+	files, n, err = proj.DownloadPackageFiles(pkg, root)
+	if err != nil || len(files) != 2 || n != 3 {
+		t.Fatalf("got %v, %d bytes, %v", files, n, err)
+	}
+
+	if _, n, err = proj.DownloadPackageFiles(pkg, root); err != nil || n != 0 {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, as by progress bars.
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestProgressFormat(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	var out syncBuffer
+	var bars int
+	proj := testProject(srv.URL)
+	proj.ProgressFormat = func(bar *pb.ProgressBar) {
+		bars++
+		bar.Output = &out
+		bar.ShowSpeed = true
+		bar.ShowTimeLeft = false
+		bar.Prefix("obs ")
+		bar.Format("[=>-]")
+	}
+
+	pkgs, err := proj.FindAllPackages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := proj.DownloadPackageFiles(pkgs[0], t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if bars != 2 {
+		t.Fatalf("format applied to %d bars", bars)
+	}
+	if !strings.Contains(out.String(), "obs ") {
+		t.Fatalf("custom format not applied to %q", out.String())
+	}
+}
+
+func TestRepoArchBinaries(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64"] = dir("pkga", "gone", "pkgb")
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	pkgs, err := proj.RepoArchBinaries("repo1", "x86_64")
+	if err != nil || len(pkgs) != 2 {
+		t.Fatalf("got %+v, %v", pkgs, err)
+	}
+	for i, want := range []struct {
+		name  string
+		files []string
+	}{
+		{"pkga", []string{"a-1.0-1.x86_64.rpm", "a-debuginfo-1.0-1.x86_64.rpm"}},
+		{"pkgb", []string{"b-1.0-1.noarch.rpm"}},
+	} {
+		pkg := pkgs[i]
+		if pkg.Name != want.name || pkg.Repo != "repo1" || pkg.Arch != "x86_64" || !reflect.DeepEqual(fileNames(pkg.Files), want.files) {
+			t.Errorf("got %+v", pkg)
+		}
+	}
+
+	if _, err := proj.RepoArchBinaries("repo1", "aarch64"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestPackageNames(t *testing.T) {
+	srv, rec := recordingServer(t, map[string]string{
+		"/build/proj":               dir("repo1", "repo2"),
+		"/build/proj/repo1":         dir("x86_64", "aarch64"),
+		"/build/proj/repo2":         dir("x86_64"),
+		"/build/proj/repo1/x86_64":  dir("zsh", "bash"),
+		"/build/proj/repo1/aarch64": dir("bash", "vim"),
+		"/build/proj/repo2/x86_64":  dir("vim", "bash", "zsh"),
+	})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	names, err := proj.PackageNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"bash", "vim", "zsh"}) {
+		t.Fatalf("got %v, %v", names, err)
+	}
+	// The binaries of the packages are not listed.
+	if n := len(rec.paths()); n != 6 {
+		t.Fatalf("%d requests: %v", n, rec.paths())
+	}
+}
+
+func TestGet(t *testing.T) {
+	srv := mockServer(t, map[string]string{
+		"/build/proj/repo1/x86_64/_jobstatus":            `<jobstatus code="finished"/>`,
+		"/build/proj/repo1/x86_64/pkga?view=cpioheaders": "headers",
+	})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	for resource, want := range map[string]string{
+		"repo1/x86_64/_jobstatus":            `<jobstatus code="finished"/>`,
+		"repo1/x86_64/pkga?view=cpioheaders": "headers",
+	} {
+		body, resp, err := proj.Get(resource)
+		if err != nil {
+			t.Fatalf("%s: %v", resource, err)
+		}
+		data, err := ioutil.ReadAll(body)
+		body.Close()
+		if err != nil || string(data) != want || resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: got %q, status %d, %v", resource, data, resp.StatusCode, err)
+		}
+	}
+
+	if _, _, err := proj.Get("repo1/x86_64/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestDownloadBinaryTo(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+	if err := proj.PackageBinaries(&pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := proj.DownloadBinaryTo(context.Background(), pkg, "a-debuginfo-1.0-1.x86_64.rpm", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "DDD" {
+		t.Fatalf("got %q", buf.String())
+	}
+
+	if err := proj.DownloadBinaryTo(context.Background(), pkg, "missing.rpm", &buf); err == nil {
+		t.Fatal("expected an error for a file not in the package")
+	}
+
+	// A hand-built package without a Path is streamed from <repo>/<arch>/<name>.
+	buf.Reset()
+	pkg = PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga",
+		Files: []PkgBinary{{Filename: "a-debuginfo-1.0-1.x86_64.rpm", Size: "3"}}}
+	if err := proj.DownloadBinaryTo(context.Background(), pkg, "a-debuginfo-1.0-1.x86_64.rpm", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "DDD" {
+		t.Fatalf("got %q", buf.String())
+	}
+
+	// And downloaded to <repo>/<arch>/<name> too.
+	root := t.TempDir()
+	files, _, err := proj.DownloadPackageFiles(pkg, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(root, "proj/repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm")
+	if data, err := ioutil.ReadFile(want); err != nil || string(data) != "DDD" || len(files) != 1 || files[0] != want {
+		t.Fatalf("got %v, %q, %v", files, data, err)
+	}
+}
+
+func TestPackageBinariesMinBinarySize(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga"] = `<binarylist>` +
+		`<binary filename="a-1.0-1.x86_64.rpm" size="5" mtime="100"/>` +
+		`<binary filename="a-empty-1.0-1.x86_64.rpm" size="0" mtime="100"/>` +
+		`<binary filename="a-small-1.0-1.x86_64.rpm" size="2" mtime="100"/>` +
+		`</binarylist>`
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	hook := captureLogs(t)
+
+	for _, tc := range []struct {
+		minSize int64
+		files   int
+	}{
+		{0, 3},
+		{1, 2},
+		{3, 1},
+	} {
+		hook.Reset()
+		proj := testProject(srv.URL)
+		proj.MinBinarySize = tc.minSize
+
+		pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+		if err := proj.PackageBinaries(&pkg); err != nil {
+			t.Fatal(err)
+		}
+		if len(pkg.Files) != tc.files {
+			t.Errorf("MinBinarySize %d: got files %+v", tc.minSize, pkg.Files)
+		}
+		for _, f := range pkg.Files {
+			if size, _ := f.SizeBytes(); size < tc.minSize {
+				t.Errorf("MinBinarySize %d: got file %+v", tc.minSize, f)
+			}
+		}
+		skipped := 0
+		for _, e := range hook.AllEntries() {
+			if e.Message == "Skipping OBS package file smaller than minimum size" {
+				skipped++
+			}
+		}
+		if skipped != 3-tc.files {
+			t.Errorf("MinBinarySize %d: %d files logged as skipped", tc.minSize, skipped)
+		}
+	}
+}
+
+func TestFindAllPackagesEmptyListings(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj"] = dir("repo1", "newrepo", "norepo")
+	routes["/build/proj/newrepo"] = "<directory/>"
+	routes["/build/proj/norepo"] = dir("x86_64")
+	routes["/build/proj/norepo/x86_64"] = "<directory/>"
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	hook := captureLogs(t)
+
+	var bar *pb.ProgressBar
+	proj := testProject(srv.URL)
+	proj.ProgressFormat = func(b *pb.ProgressBar) {
+		b.NotPrint = true
+		bar = b
+	}
+	pkgs, err := proj.FindAllPackages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("unexpected packages %+v", pkgs)
+	}
+
+	if !logged(hook, "No architectures found in OBS repo", logrus.Fields{"repo": "newrepo"}) {
+		t.Error("empty repo not logged")
+	}
+	if !logged(hook, "No packages found in OBS repo arch", logrus.Fields{"repo": "norepo", "arch": "x86_64"}) {
+		t.Error("empty arch not logged")
+	}
+	// Only the packages found count in the progress.
+	if bar.Total != 2 || bar.Get() != 2 {
+		t.Errorf("progress %d/%d", bar.Get(), bar.Total)
+	}
+}
+
+func TestFindAllPackagesRequireNonEmpty(t *testing.T) {
+	for name, routes := range map[string]map[string]string{
+		"no repos": {
+			"/build/proj": "<directory/>",
+		},
+		"no binaries": {
+			"/build/proj":                   dir("repo1"),
+			"/build/proj/repo1":             dir("x86_64"),
+			"/build/proj/repo1/x86_64":      dir("pkga"),
+			"/build/proj/repo1/x86_64/pkga": `<binarylist><binary filename="_log" size="2" mtime="1"/></binarylist>`,
+		},
+	} {
+		srv := mockServer(t, routes)
+		proj := testProject(srv.URL)
+
+		pkgs, err := proj.FindAllPackages()
+		if err != nil || len(pkgs) > 1 {
+			t.Errorf("%s: got %+v, %v", name, pkgs, err)
+		}
+
+		proj.RequireNonEmpty = true
+		if _, err := proj.FindAllPackages(); !errors.Is(err, ErrEmptyProject) {
+			t.Errorf("%s: expected ErrEmptyProject, got %v", name, err)
+		}
+		srv.Close()
+	}
+
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.RequireNonEmpty = true
+	if _, err := proj.FindAllPackages(); err != nil {
+		t.Errorf("got %v for a project with binaries", err)
+	}
+
+	// An unreachable server is not reported as an empty project.
+	srv.Close()
+	if _, err := proj.FindAllPackages(); err == nil || errors.Is(err, ErrEmptyProject) {
+		t.Errorf("got %v for an unreachable server", err)
+	}
+}
+
+func TestListPseudoDirs(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj"] = dir("repo1", "_repository")
+	routes["/build/proj/repo1"] = dir(":full", "x86_64")
+	routes["/build/proj/repo1/x86_64"] = dir("_repository", "pkga", "pkgb", ":import")
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		include                bool
+		repos, archs, packages []string
+	}{
+		{false, []string{"repo1"}, []string{"x86_64"}, []string{"pkga", "pkgb"}},
+		{true, []string{"repo1", "_repository"}, []string{":full", "x86_64"}, []string{"_repository", "pkga", "pkgb", ":import"}},
+	} {
+		proj := testProject(srv.URL)
+		proj.IncludePseudoDirs = tc.include
+
+		repos, err := proj.ListRepos()
+		if err != nil || !reflect.DeepEqual(repos, tc.repos) {
+			t.Errorf("IncludePseudoDirs %v: got repos %v, %v", tc.include, repos, err)
+		}
+		archs, err := proj.ListArchs("repo1")
+		if err != nil || !reflect.DeepEqual(archs, tc.archs) {
+			t.Errorf("IncludePseudoDirs %v: got archs %v, %v", tc.include, archs, err)
+		}
+		packages, err := proj.ListPackages("repo1", "x86_64")
+		if err != nil || !reflect.DeepEqual(packages, tc.packages) {
+			t.Errorf("IncludePseudoDirs %v: got packages %v, %v", tc.include, packages, err)
+		}
+	}
+
+	// The enumeration doesn't request the pseudo-directories.
+	proj := testProject(srv.URL)
+	pkgs, err := proj.FindAllPackages()
+	if err != nil || len(pkgs) != 2 {
+		t.Fatalf("got %+v, %v", pkgs, err)
+	}
+}
+
+func TestSourceFiles(t *testing.T) {
+	srv := mockServer(t, map[string]string{
+		"/source/proj/pkga": `<directory name="pkga" rev="3" vrev="3" srcmd5="abc">
+  <entry name="pkga.spec" md5="x" size="4" mtime="10"/>
+  <entry name="pkga.changes" md5="y" size="7" mtime="20"/>
+</directory>`,
+		"/source/proj/pkga/pkga.spec":    "spec",
+		"/source/proj/pkga/pkga.changes": "changes",
+	})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	files, err := proj.SourceFiles("pkga")
+	want := []PkgBinary{
+		{Filename: "pkga.spec", Size: "4", Mtime: "10"},
+		{Filename: "pkga.changes", Size: "7", Mtime: "20"},
+	}
+	if err != nil || !reflect.DeepEqual(files, want) {
+		t.Fatalf("got %+v, %v", files, err)
+	}
+
+	root := t.TempDir()
+	paths, err := proj.DownloadSourceFiles("pkga", files, root)
+	if err != nil || len(paths) != 2 {
+		t.Fatalf("got %v, %v", paths, err)
+	}
+	for name, content := range map[string]string{"pkga.spec": "spec", "pkga.changes": "changes"} {
+		data, err := ioutil.ReadFile(filepath.Join(root, "proj/_source/pkga", name))
+		if err != nil || string(data) != content {
+			t.Errorf("%s: got %q, %v", name, data, err)
+		}
+	}
+
+	// The names listed by the server don't escape the package directory.
+	for _, name := range []string{"../../evil", "sub/file", "..", "."} {
+		files := []PkgBinary{{Filename: name, Size: "1"}}
+		if _, err := proj.DownloadSourceFiles("pkga", files, root); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "evil")); !os.IsNotExist(err) {
+		t.Fatalf("file created outside of the package directory: %v", err)
+	}
+}
+
+func TestPackageBinariesListedFiles(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		include       []string
+		files, listed int
+	}{
+		// The _log file is never selected.
+		{nil, 2, 3},
+		{[]string{"*-debuginfo-*"}, 1, 3},
+		{[]string{"missing-*"}, 0, 3},
+	} {
+		proj := testProject(srv.URL)
+		proj.Include = tc.include
+		pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+		if err != nil || len(pkg.Files) != tc.files || pkg.ListedFiles != tc.listed {
+			t.Errorf("include %v: got %d of %d files, %v", tc.include, len(pkg.Files), pkg.ListedFiles, err)
+		}
+	}
+}
+
+func TestPackageBinariesDuplicates(t *testing.T) {
+	srv := mockServer(t, map[string]string{
+		"/build/proj/repo1/x86_64/pkga": `<binarylist>
+  <binary filename="a-1.0-1.x86_64.rpm" size="5" mtime="100"/>
+  <binary filename="b-1.0-1.x86_64.rpm" size="1" mtime="100"/>
+  <binary filename="a-1.0-1.x86_64.rpm" size="6" mtime="200"/>
+</binarylist>`,
+	})
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		policy DuplicatePolicy
+		sizes  []string
+	}{
+		{DuplicatesAllow, []string{"5", "6", "1"}},
+		{DuplicatesRemove, []string{"5", "1"}},
+	} {
+		proj := testProject(srv.URL)
+		proj.DuplicateFiles = tc.policy
+		pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sizes []string
+		for _, f := range pkg.Files {
+			sizes = append(sizes, f.Size)
+		}
+		if !reflect.DeepEqual(sizes, tc.sizes) {
+			t.Errorf("policy %v: got %+v", tc.policy, pkg.Files)
+		}
+	}
+
+	proj := testProject(srv.URL)
+	proj.DuplicateFiles = DuplicatesError
+	if _, err := proj.GetPackage("repo1", "x86_64", "pkga"); err == nil {
+		t.Fatal("expected an error for a duplicate file")
+	}
+}
+
+// Returns basicRoutes with repo2 and repo3, copies of repo1.
+func threeRepoRoutes() map[string]string {
+	routes := basicRoutes()
+	routes["/build/proj"] = dir("repo1", "repo2", "repo3")
+	for p, body := range basicRoutes() {
+		if strings.HasPrefix(p, "/build/proj/repo1") {
+			for _, repo := range []string{"repo2", "repo3"} {
+				routes[strings.Replace(p, "repo1", repo, 1)] = body
+			}
+		}
+	}
+	return routes
+}
+
+// Returns the repositories whose listings are in paths.
+func requestedRepos(paths []string) []string {
+	var repos []string
+	for _, p := range paths {
+		if parts := strings.Split(p, "/"); len(parts) == 4 {
+			repos = append(repos, parts[3])
+		}
+	}
+	return repos
+}
+
+func TestExcludeRepos(t *testing.T) {
+	srv, rec := recordingServer(t, threeRepoRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.ExcludeRepos = []string{"repo2", "missing"}
+
+	repos, err := proj.ListRepos()
+	if err != nil || !reflect.DeepEqual(repos, []string{"repo1", "repo3"}) {
+		t.Fatalf("got %v, %v", repos, err)
+	}
+	pkgs, err := proj.FindAllPackages()
+	if err != nil || len(pkgs) != 4 {
+		t.Fatalf("got %d packages, %v", len(pkgs), err)
+	}
+	// Not even the archs of the excluded repository are listed.
+	if got := requestedRepos(rec.paths()); !reflect.DeepEqual(got, []string{"repo1", "repo3"}) {
+		t.Fatalf("listed repos %v", got)
+	}
+}
+
+func TestRepos(t *testing.T) {
+	srv, rec := recordingServer(t, threeRepoRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.Repos = []string{"repo3", "repo1"}
+
+	pkgs, err := proj.FindAllPackages()
+	if err != nil || len(pkgs) != 4 || pkgs[0].Repo != "repo1" || pkgs[2].Repo != "repo3" {
+		t.Fatalf("got %+v, %v", pkgs, err)
+	}
+	// The project repositories are not listed.
+	got := rec.paths()
+	if got[0] == "/build/proj" {
+		t.Fatalf("project repos listed: %v", got)
+	}
+	if repos := requestedRepos(got); !reflect.DeepEqual(repos, []string{"repo1", "repo3"}) {
+		t.Fatalf("listed repos %v", repos)
+	}
+
+	// ExcludeRepos still applies.
+	proj.ExcludeRepos = []string{"repo1"}
+	if repos, err := proj.ListRepos(); err != nil || !reflect.DeepEqual(repos, []string{"repo3"}) {
+		t.Fatalf("got %v, %v", repos, err)
+	}
+}
+
+func TestPackageBinariesGlobs(t *testing.T) {
+	routes := map[string]string{
+		"/build/proj/repo1/x86_64/kernel": testBinaryList(
+			"kernel-default-6.0-1.x86_64.rpm",
+			"kernel-default-debuginfo-6.0-1.x86_64.rpm",
+			"kernel-devel-6.0-1.noarch.rpm",
+			"perf-6.0-1.x86_64.rpm",
+		),
+	}
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		include, exclude []string
+		files            []string
+	}{
+		{nil, nil, []string{"kernel-default-6.0-1.x86_64.rpm", "kernel-default-debuginfo-6.0-1.x86_64.rpm", "kernel-devel-6.0-1.noarch.rpm", "perf-6.0-1.x86_64.rpm"}},
+		{[]string{"kernel-*"}, nil, []string{"kernel-default-6.0-1.x86_64.rpm", "kernel-default-debuginfo-6.0-1.x86_64.rpm", "kernel-devel-6.0-1.noarch.rpm"}},
+		{nil, []string{"*-debuginfo-*"}, []string{"kernel-default-6.0-1.x86_64.rpm", "kernel-devel-6.0-1.noarch.rpm", "perf-6.0-1.x86_64.rpm"}},
+		// Exclude wins over include.
+		{[]string{"kernel-*"}, []string{"*-debuginfo-*"}, []string{"kernel-default-6.0-1.x86_64.rpm", "kernel-devel-6.0-1.noarch.rpm"}},
+		{[]string{"perf-*", "*.noarch.rpm"}, nil, []string{"kernel-devel-6.0-1.noarch.rpm", "perf-6.0-1.x86_64.rpm"}},
+	} {
+		proj := testProject(srv.URL)
+		proj.Include = tc.include
+		proj.Exclude = tc.exclude
+
+		pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "kernel"}
+		if err := proj.PackageBinaries(&pkg); err != nil {
+			t.Fatal(err)
+		}
+		if got := fileNames(pkg.Files); !reflect.DeepEqual(got, tc.files) {
+			t.Errorf("include %v, exclude %v: got %v", tc.include, tc.exclude, got)
+		}
+	}
+
+	proj := testProject(srv.URL)
+	proj.Exclude = []string{"[-"}
+	pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "kernel"}
+	if err := proj.PackageBinaries(&pkg); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+// Run with -race to check that a Project is safe for concurrent use.
+func TestProjectConcurrentUse(t *testing.T) {
+	routes := basicRoutes()
+	routes["/about"] = `<about><title>Open Build Service API</title><revision>2.10.1</revision></about>`
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	manifest := filepath.Join(t.TempDir(), "manifest")
+	if err := ioutil.WriteFile(manifest, []byte("elsewhere.rpm 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	proj := testProject(srv.URL)
+	proj.ByteBudget = 1 << 20
+	proj.ExclusionManifest = manifest
+
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if repos, err := proj.ListRepos(); err != nil || len(repos) != 1 {
+				errs <- fmt.Errorf("ListRepos: %v, %v", repos, err)
+			}
+			if _, err := proj.About(); err != nil {
+				errs <- fmt.Errorf("About: %v", err)
+			}
+
+			pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+			if err := proj.PackageBinaries(&pkg); err != nil || len(pkg.Files) != 2 {
+				errs <- fmt.Errorf("PackageBinaries: %+v, %v", pkg, err)
+				return
+			}
+			if _, n, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil || n != 8 {
+				errs <- fmt.Errorf("DownloadPackageFiles: %d bytes, %v", n, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestBinaryURL(t *testing.T) {
+	pkg := PackageInfo{Name: "pkga", Repo: "repo1", Arch: "x86_64"}
+	for _, tc := range []struct {
+		proj *Project
+		pkg  PackageInfo
+		want string
+	}{
+		{&Project{Name: "home:user"}, pkg, apiBaseURL + "/build/home:user/repo1/x86_64/pkga/a.rpm"},
+		{&Project{Name: "proj", BaseURL: "http://obs/"}, pkg, "http://obs/build/proj/repo1/x86_64/pkga/a.rpm"},
+		{&Project{Name: "proj", BaseURL: "http://obs", PathPrefix: "api/build"}, pkg, "http://obs/api/build/proj/repo1/x86_64/pkga/a.rpm"},
+		{&Project{Name: "proj", BaseURL: "http://obs", Public: true}, pkg, "http://obs/public/build/proj/repo1/x86_64/pkga/a.rpm"},
+		// The path of the package is kept, e.g. for multibuild flavors.
+		{&Project{Name: "proj", BaseURL: "http://obs"}, PackageInfo{Name: "pkga", Path: "repo1/x86_64/pkga:flavor"}, "http://obs/build/proj/repo1/x86_64/pkga:flavor/a.rpm"},
+		// The listed download links are used as they are.
+		{&Project{Name: "proj", BaseURL: "http://obs"}, PackageInfo{Files: []PkgBinary{{Filename: "a.rpm", DownloadURL: "http://cdn/a.rpm"}}}, "http://cdn/a.rpm"},
+	} {
+		if got := tc.proj.BinaryURL(tc.pkg, "a.rpm"); got != tc.want {
+			t.Errorf("got %s, want %s", got, tc.want)
+		}
+	}
+
+	// The URL is the one requested to download the file.
+	srv, rec := recordingServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := proj.DownloadBinaryTo(context.Background(), pkg, "a-1.0-1.x86_64.rpm", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.paths(); len(got) != 2 || srv.URL+got[1] != proj.BinaryURL(pkg, "a-1.0-1.x86_64.rpm") {
+		t.Fatalf("got requests %v", got)
+	}
+}
+
+func TestDownloadPackageFilesContinueOnError(t *testing.T) {
+	// The first of the two files fails to download.
+	routes := basicRoutes()
+	delete(routes, "/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm")
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		cont  bool
+		bytes int64
+	}{
+		{false, 0},
+		{true, 3},
+	} {
+		proj := testProject(srv.URL)
+		proj.ContinueOnDownloadError = tc.cont
+		pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		root := t.TempDir()
+		files, n, err := proj.DownloadPackageFiles(pkg, root)
+		if n != tc.bytes {
+			t.Errorf("continue %v: got %d bytes", tc.cont, n)
+		}
+		multi, ok := err.(MultiError)
+		if ok != tc.cont || (ok && (len(multi) != 1 || !errors.Is(multi[0], ErrNotFound))) || (!ok && !errors.Is(err, ErrNotFound)) {
+			t.Errorf("continue %v: got %v", tc.cont, err)
+		}
+
+		// The later file is only downloaded when continuing, and only the
+		// files downloaded are returned.
+		later := filepath.Join(root, "proj/repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm")
+		data, readErr := ioutil.ReadFile(later)
+		if tc.cont && (readErr != nil || string(data) != "DDD" || !reflect.DeepEqual(files, []string{later})) {
+			t.Errorf("continue %v: got %v, %q, %v", tc.cont, files, data, readErr)
+		}
+		if !tc.cont && !os.IsNotExist(readErr) {
+			t.Errorf("continue %v: later file downloaded, %v", tc.cont, readErr)
+		}
+	}
+}
+
+func TestDownloadPackageFilesMaxFiles(t *testing.T) {
+	srv, rec := recordingServer(t, basicRoutes())
+	defer srv.Close()
+	pkg, err := testProject(srv.URL).GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		max, files int
+	}{
+		{0, 2},
+		{1, 1},
+		{3, 2},
+	} {
+		proj := testProject(srv.URL)
+		proj.MaxFilesPerPackage = tc.max
+		before := len(rec.paths())
+		files, _, err := proj.DownloadPackageFiles(pkg, t.TempDir())
+		if err != nil || len(files) != tc.files {
+			t.Errorf("max %d: got %v, %v", tc.max, files, err)
+		}
+		// Only the files returned are requested.
+		if n := len(rec.paths()) - before; n != tc.files {
+			t.Errorf("max %d: got %d downloads", tc.max, n)
+		}
+	}
+}
+
+func TestAllBinaries(t *testing.T) {
+	srv := mockServer(t, threeRepoRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	pkgs, err := proj.FindAllPackages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binaries, err := proj.AllBinaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The binaries of each package, in the same order, with their repo,
+	// arch and package.
+	var want []PkgBinary
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			f.Repo, f.Arch, f.Package = pkg.Repo, pkg.Arch, pkg.Name
+			want = append(want, f)
+		}
+	}
+	if len(binaries) != 9 || !reflect.DeepEqual(binaries, want) {
+		t.Fatalf("got %+v", binaries)
+	}
+	if b := binaries[len(binaries)-1]; b.Repo != "repo3" || b.Arch != "x86_64" || b.Package != "pkgb" {
+		t.Fatalf("got %+v", b)
+	}
+}
+
+// Listings of an arch and of the sources of a package, with the revision
+// attributes set by OBS
+const (
+	revisionArchList   = `<directory rev="12" vrev="3" srcmd5="0123abcd"><entry name="pkga"/><entry name="pkgb"/></directory>`
+	revisionSourceList = `<directory name="pkga" rev="7" vrev="7" srcmd5="ffee"><entry name="a.spec" size="10" mtime="5"/></directory>`
+)
+
+func TestDirectoryInfo(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64"] = revisionArchList
+	routes["/source/proj/pkga"] = revisionSourceList
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	for _, tc := range []struct {
+		path string
+		want DirInfo
+	}{
+		{"repo1/x86_64", DirInfo{Rev: "12", Vrev: "3", Srcmd5: "0123abcd"}},
+		// Listings without the attributes.
+		{"repo1", DirInfo{}},
+	} {
+		if info, err := proj.DirectoryInfo(tc.path); err != nil || info != tc.want {
+			t.Errorf("%s: got %+v, %v", tc.path, info, err)
+		}
+	}
+	if info, err := proj.SourceInfo("pkga"); err != nil || info != (DirInfo{Rev: "7", Vrev: "7", Srcmd5: "ffee"}) {
+		t.Errorf("got %+v, %v", info, err)
+	}
+
+	// The entries are still parsed.
+	if pkgs, err := proj.ListPackages("repo1", "x86_64"); err != nil || !reflect.DeepEqual(pkgs, []string{"pkga", "pkgb"}) {
+		t.Errorf("got %v, %v", pkgs, err)
+	}
+	if files, err := proj.SourceFiles("pkga"); err != nil || len(files) != 1 || files[0].Filename != "a.spec" {
+		t.Errorf("got %+v, %v", files, err)
+	}
+	if _, err := proj.DirectoryInfo("repo1/s390x"); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestDownloadPackageFilesDirectURL(t *testing.T) {
+	cdn, cdnRec := recordingServer(t, map[string]string{"/a.rpm": "CDNCD"})
+	defer cdn.Close()
+	routes := basicRoutes()
+	// The debuginfo link is broken, and the file is downloaded from the API.
+	routes["/build/proj/repo1/x86_64/pkga"] = `<binarylist>` +
+		`<binary filename="a-1.0-1.x86_64.rpm" size="5" mtime="100" downloadurl="` + cdn.URL + `/a.rpm"/>` +
+		`<binary filename="a-debuginfo-1.0-1.x86_64.rpm" size="3" mtime="100" downloadurl="` + cdn.URL + `/missing.rpm"/>` +
+		`</binarylist>`
+	api, apiRec := recordingServer(t, routes)
+	defer api.Close()
+
+	proj := testProject(api.URL)
+	proj.User, proj.Password = "user", "secret"
+	proj.Headers = http.Header{"X-Api-Key": {"key"}}
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url := proj.BinaryURL(pkg, "a-1.0-1.x86_64.rpm"); url != cdn.URL+"/a.rpm" {
+		t.Errorf("got URL %s", url)
+	}
+	if url := proj.BinaryURL(pkg, "a-2.0-1.x86_64.rpm"); url != api.URL+"/build/proj/repo1/x86_64/pkga/a-2.0-1.x86_64.rpm" {
+		t.Errorf("got URL %s without a direct link", url)
+	}
+
+	root := t.TempDir()
+	if _, n, err := proj.DownloadPackageFiles(pkg, root); err != nil || n != 8 {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+	for file, want := range map[string]string{
+		"a-1.0-1.x86_64.rpm":           "CDNCD",
+		"a-debuginfo-1.0-1.x86_64.rpm": "DDD",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(root, "proj/repo1/x86_64/pkga", file))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v", file, data, err)
+		}
+	}
+
+	// The credentials and project headers are only sent to the API.
+	for _, path := range []string{"/a.rpm", "/missing.rpm"} {
+		h := cdnRec.headers(path)
+		if h == nil || h.Get("Authorization") != "" || h.Get("X-Api-Key") != "" {
+			t.Errorf("%s: got headers %v", path, h)
+		}
+	}
+	var fromAPI []string
+	for _, path := range apiRec.paths() {
+		if strings.HasSuffix(path, ".rpm") {
+			fromAPI = append(fromAPI, path)
+		}
+	}
+	if !reflect.DeepEqual(fromAPI, []string{"/build/proj/repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm"}) {
+		t.Errorf("got API downloads of %q", fromAPI)
+	}
+}
+
+func TestFindAllPackagesOrder(t *testing.T) {
+	// Listed out of order, with names differing only by case.
+	srv := mockServer(t, map[string]string{
+		"/build/proj":              dir("b", "B", "a"),
+		"/build/proj/a":            dir("x86_64", "aarch64"),
+		"/build/proj/b":            dir("x86_64"),
+		"/build/proj/B":            dir("x86_64"),
+		"/build/proj/a/x86_64":     dir("zz", "aa"),
+		"/build/proj/a/aarch64":    dir("mm"),
+		"/build/proj/b/x86_64":     dir("p"),
+		"/build/proj/B/x86_64":     dir("p"),
+		"/build/proj/a/x86_64/zz":  testBinaryList("zz-1-1.x86_64.rpm", "Zz-1-1.x86_64.rpm", "zy-1-1.x86_64.rpm"),
+		"/build/proj/a/x86_64/aa":  testBinaryList("aa-1-1.x86_64.rpm"),
+		"/build/proj/a/aarch64/mm": testBinaryList("mm-1-1.aarch64.rpm"),
+		"/build/proj/b/x86_64/p":   testBinaryList("p-1-1.x86_64.rpm"),
+		"/build/proj/B/x86_64/p":   testBinaryList("p-1-1.x86_64.rpm"),
+	})
+	defer srv.Close()
+
+	pkgs, err := testProject(srv.URL).FindAllPackages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, pkg := range pkgs {
+		paths = append(paths, pkg.Path)
+	}
+	// Sorted case-sensitively, so upper case first.
+	want := []string{"B/x86_64/p", "a/aarch64/mm", "a/x86_64/aa", "a/x86_64/zz", "b/x86_64/p"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got %v", paths)
+	}
+	if files := fileNames(pkgs[3].Files); !reflect.DeepEqual(files, []string{"Zz-1-1.x86_64.rpm", "zy-1-1.x86_64.rpm", "zz-1-1.x86_64.rpm"}) {
+		t.Fatalf("got %v", files)
+	}
+}
+
+func TestBinaryInfo(t *testing.T) {
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga?view=binaryversions"] = binaryVersionsXML
+	srv, rec := recordingServer(t, routes)
+	defer srv.Close()
+	pkga := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+
+	for _, tc := range []struct {
+		versions bool
+		pkg      PackageInfo
+		filename string
+		want     PkgBinary
+		found    bool
+	}{
+		{false, pkga, "a-1.0-1.x86_64.rpm", PkgBinary{Filename: "a-1.0-1.x86_64.rpm", Size: "5", Mtime: "100"}, true},
+		{true, pkga, "a-1.0-1.x86_64.rpm", PkgBinary{Filename: "a-1.0-1.x86_64.rpm", SizeK: "1", HdrMD5: "0fa8b7c5d1e2f3a4b5c6d7e8f9a0b1c2"}, true},
+		{false, PackageInfo{Path: "repo1/x86_64/pkgb"}, "b-1.0-1.noarch.rpm", PkgBinary{Filename: "b-1.0-1.noarch.rpm", Size: "0", Mtime: "200"}, true},
+		{false, pkga, "missing.rpm", PkgBinary{}, false},
+		{false, PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "missing"}, "a-1.0-1.x86_64.rpm", PkgBinary{}, false},
+	} {
+		proj := testProject(srv.URL)
+		proj.BinaryVersions = tc.versions
+		got, err := proj.BinaryInfo(tc.pkg, tc.filename)
+		if got != tc.want || (err == nil) != tc.found || (!tc.found && !errors.Is(err, ErrNotFound)) {
+			t.Errorf("%s, versions %v: got %+v, %v", tc.filename, tc.versions, got, err)
+		}
+	}
+
+	// Only the binary lists are requested.
+	for _, path := range rec.paths() {
+		if strings.HasSuffix(path, ".rpm") {
+			t.Errorf("got request for %s", path)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package obsgo
+
+import (
+	"io"
+	"time"
+)
+
+// Minimum interval between two consecutive progress callback invocations
+const progressInterval = 500 * time.Millisecond
+
+// DownloadProgress reports the state of an ongoing file download.
+type DownloadProgress struct {
+	// Name of the file being downloaded
+	Filename string
+	// Number of bytes written so far
+	Written int64
+	// Expected size of the file, zero when unknown
+	Total int64
+	// Download speed in bytes per second, measured over the last interval
+	Speed float64
+	// Estimated time left to complete the download, zero when unknown
+	Remaining time.Duration
+}
+
+// progressWriter counts the bytes written to w, and periodically reports them
+// to fn together with the download speed and the estimated time left.
+type progressWriter struct {
+	w           io.Writer
+	fn          func(DownloadProgress)
+	progress    DownloadProgress
+	now         func() time.Time
+	lastTime    time.Time
+	lastWritten int64
+}
+
+// Returns a progressWriter of a download resumed after the first offset bytes,
+// already written.
+func newProgressWriter(w io.Writer, fn func(DownloadProgress), filename string, total, offset int64, now func() time.Time) *progressWriter {
+	return &progressWriter{
+		w:  w,
+		fn: fn,
+		progress: DownloadProgress{
+			Filename: filename,
+			Written:  offset,
+			Total:    total,
+		},
+		now:         now,
+		lastTime:    now(),
+		lastWritten: offset,
+	}
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.progress.Written += int64(n)
+
+	t := pw.now()
+	elapsed := t.Sub(pw.lastTime)
+	done := pw.progress.Total > 0 && pw.progress.Written >= pw.progress.Total
+	if elapsed < progressInterval && !done {
+		return n, err
+	}
+
+	if elapsed > 0 {
+		pw.progress.Speed = float64(pw.progress.Written-pw.lastWritten) / elapsed.Seconds()
+	}
+	pw.progress.Remaining = 0
+	if left := pw.progress.Total - pw.progress.Written; left > 0 && pw.progress.Speed > 0 {
+		pw.progress.Remaining = time.Duration(float64(left) / pw.progress.Speed * float64(time.Second))
+	}
+	pw.lastTime = t
+	pw.lastWritten = pw.progress.Written
+
+	pw.fn(pw.progress)
+
+	return n, err
+}
+
+// Wraps w so that the download of the binary file f, resumed after its first
+// offset bytes, is reported to the project OnProgress callback, if any.
+func (proj *Project) progressWriter(w io.Writer, f PkgBinary, offset int64) io.Writer {
+	if proj.OnProgress == nil {
+		return w
+	}
+	total, _ := f.SizeBytes()
+	return newProgressWriter(w, proj.OnProgress, f.Filename, total, offset, time.Now)
+}
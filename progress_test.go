@@ -0,0 +1,158 @@
+package obsgo
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+func TestProgressWriterSpeed(t *testing.T) {
+	clock := time.Unix(0, 0)
+	now := func() time.Time { return clock }
+	var got []DownloadProgress
+	pw := newProgressWriter(ioutil.Discard, func(p DownloadProgress) { got = append(got, p) }, "file", 3000, 0, now)
+
+	clock = clock.Add(time.Second)
+	pw.Write(make([]byte, 1000))
+	// Not reported, too soon after the previous report.
+	clock = clock.Add(100 * time.Millisecond)
+	pw.Write(make([]byte, 1000))
+	// Reported, since the download is complete.
+	clock = clock.Add(900 * time.Millisecond)
+	pw.Write(make([]byte, 1000))
+
+	want := []DownloadProgress{
+		{Filename: "file", Written: 1000, Total: 3000, Speed: 1000, Remaining: 2 * time.Second},
+		{Filename: "file", Written: 3000, Total: 3000, Speed: 2000},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("report %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestProgressWriterUnknownTotal(t *testing.T) {
+	clock := time.Unix(0, 0)
+	now := func() time.Time { return clock }
+	var got []DownloadProgress
+	pw := newProgressWriter(ioutil.Discard, func(p DownloadProgress) { got = append(got, p) }, "file", 0, 0, now)
+
+	for i := 0; i < 4; i++ {
+		clock = clock.Add(250 * time.Millisecond)
+		pw.Write(make([]byte, 500))
+	}
+
+	// Reported every progressInterval, with no estimate of the time left.
+	want := []DownloadProgress{
+		{Filename: "file", Written: 1000, Speed: 2000},
+		{Filename: "file", Written: 2000, Speed: 2000},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("report %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestProgressWriterResumed(t *testing.T) {
+	clock := time.Unix(0, 0)
+	now := func() time.Time { return clock }
+	var got []DownloadProgress
+	pw := newProgressWriter(ioutil.Discard, func(p DownloadProgress) { got = append(got, p) }, "file", 3000, 2000, now)
+
+	// The bytes already downloaded are counted as written, but not in the
+	// speed.
+	clock = clock.Add(time.Second)
+	pw.Write(make([]byte, 500))
+	want := DownloadProgress{Filename: "file", Written: 2500, Total: 3000, Speed: 500, Remaining: time.Second}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestDownloadPackageFilesOnProgress(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	last := make(map[string]DownloadProgress)
+	proj := testProject(srv.URL)
+	proj.OnProgress = func(p DownloadProgress) { last[p.Filename] = p }
+
+	pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+	if err := proj.PackageBinaries(&pkg); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, size := range map[string]int64{"a-1.0-1.x86_64.rpm": 5, "a-debuginfo-1.0-1.x86_64.rpm": 3} {
+		if p := last[name]; p.Written != size || p.Total != size || p.Remaining != 0 {
+			t.Errorf("%s: last report %+v", name, p)
+		}
+	}
+}
+
+func TestDownloadPackageFilesProgressBar(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	var bars []*pb.ProgressBar
+	proj := testProject(srv.URL)
+	proj.ProgressFormat = func(bar *pb.ProgressBar) {
+		bar.NotPrint = true
+		bars = append(bars, bar)
+	}
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bar counts the bytes of the files, also when they are already
+	// downloaded.
+	root := t.TempDir()
+	for i := 0; i < 2; i++ {
+		bars = nil
+		if _, _, err := proj.DownloadPackageFiles(pkg, root); err != nil {
+			t.Fatal(err)
+		}
+		if len(bars) != 1 || bars[0].Total != 8 || bars[0].Get() != 8 || bars[0].Units != pb.U_BYTES {
+			t.Fatalf("run %d: got bars %+v", i, bars)
+		}
+	}
+}
+
+func TestDownloadPackageFilesProgressBarUnits(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	var bars []*pb.ProgressBar
+	proj := testProject(srv.URL)
+	proj.ProgressFormat = func(bar *pb.ProgressBar) {
+		bar.NotPrint = true
+		bar.SetUnits(pb.U_BYTES_DEC)
+		bars = append(bars, bar)
+	}
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The units set by ProgressFormat are kept on the download bar.
+	bars = nil
+	if _, _, err := proj.DownloadPackageFiles(pkg, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if len(bars) != 1 || bars[0].Units != pb.U_BYTES_DEC || bars[0].Total != 8 {
+		t.Fatalf("got bars %+v", bars)
+	}
+}
@@ -0,0 +1,320 @@
+package obsgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RepoMD is the parsed content of the repodata/repomd.xml file of a published
+// RPM repository.
+type RepoMD struct {
+	XMLName  xml.Name     `xml:"repomd"`
+	Revision string       `xml:"revision"`
+	Data     []RepoMDData `xml:"data"`
+}
+
+// RepoMDData describes one of the metadata files listed in repomd.xml, such as
+// primary, filelists or other.
+type RepoMDData struct {
+	// Type of metadata, e.g. "primary"
+	Type string `xml:"type,attr"`
+	// Checksum of the file as stored in the repository
+	Checksum RepoMDChecksum `xml:"checksum"`
+	// Checksum of the uncompressed file
+	OpenChecksum RepoMDChecksum `xml:"open-checksum"`
+	// Location of the file, relative to the repository root
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Timestamp string `xml:"timestamp"`
+	Size      string `xml:"size"`
+	OpenSize  string `xml:"open-size"`
+}
+
+// RepoMDChecksum is a checksum value together with its algorithm.
+type RepoMDChecksum struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Find returns the metadata file entry of the given type.
+func (md RepoMD) Find(dataType string) (RepoMDData, bool) {
+	for _, d := range md.Data {
+		if d.Type == dataType {
+			return d, true
+		}
+	}
+	return RepoMDData{}, false
+}
+
+// Returns the repomd.xml metadata published for the repository repo. OBS
+// publishes a single repodata tree per repository, so arch is usually left
+// empty; when set, repodata is looked up under the arch subdirectory.
+func (proj *Project) RepoMD(repo, arch string) (RepoMD, error) {
+	var md RepoMD
+
+	resource := path.Join(repo, arch, "repodata", "repomd.xml")
+	logrus.WithFields(logrus.Fields{
+		"resource": resource,
+	}).Debug("Retrieving OBS published repomd.xml")
+
+	xmlResp, err := proj.readURLPath(context.Background(), path.Join("/published", proj.Name, resource), nil)
+	if err != nil {
+		return md, errors.Wrapf(err, "failed to get repomd.xml for repo %s", repo)
+	}
+
+	if err := xml.Unmarshal(xmlResp, &md); err != nil {
+		return md, errors.Wrapf(err, "failed to parse repomd.xml for repo %s", repo)
+	}
+
+	return md, nil
+}
+
+// Names of the index files of a published Debian repository, the first one
+// being mandatory
+var debIndexFiles = []string{"Packages", "Packages.gz", "Release", "Release.gpg", "Release.key"}
+
+// Downloads the metadata published for the repository repo, without any
+// binary, into the project Storage under root/<project>/<repo>/<arch>. For RPM
+// repositories repomd.xml and the metadata files it lists are downloaded, for
+// Debian repositories the Packages and Release index files. As for RepoMD,
+// arch is usually left empty.
+func (proj *Project) DownloadMetadata(repo, arch, root string) error {
+	repoPath := path.Join(repo, arch)
+	localDir := filepath.Join(root, proj.Name, repoPath)
+
+	md, err := proj.RepoMD(repo, arch)
+	if err == nil {
+		for _, d := range md.Data {
+			if href := path.Clean(d.Location.Href); path.IsAbs(href) || strings.HasPrefix(href, "..") {
+				return errors.Errorf("invalid metadata location %s in repo %s", d.Location.Href, repo)
+			}
+			sum := d.Checksum
+			err := proj.downloadPublished(path.Join(repoPath, d.Location.Href), filepath.Join(localDir, d.Location.Href), &sum)
+			if err != nil {
+				return err
+			}
+		}
+		return proj.downloadPublished(path.Join(repoPath, "repodata", "repomd.xml"), filepath.Join(localDir, "repodata", "repomd.xml"), nil)
+	}
+	if !isNotFound(err) {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"repo": repo,
+	}).Debug("No repomd.xml in OBS repo, looking for Debian index files")
+
+	for i, name := range debIndexFiles {
+		err := proj.downloadPublished(path.Join(repoPath, name), filepath.Join(localDir, name), nil)
+		if isNotFound(err) && i > 0 {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "no RPM or Debian metadata found for repo %s", repo)
+		}
+	}
+
+	return nil
+}
+
+// Downloads the published file at resource into localFile, checking that it
+// matches the checksum sum when not nil. Local files are renamed once
+// verified, so that a corrupted download never replaces a previous one.
+func (proj *Project) downloadPublished(resource, localFile string, sum *RepoMDChecksum) error {
+	logrus.WithFields(logrus.Fields{
+		"resource": resource,
+	}).Debug("Downloading OBS published file")
+
+	var h hash.Hash
+	if sum != nil {
+		var err error
+		if h, err = newChecksumHash(sum.Type); err != nil {
+			return errors.Wrapf(err, "metadata file %s", resource)
+		}
+	}
+
+	resp, err := proj.publishedRequest(context.Background(), resource)
+	if err != nil {
+		return errors.Wrapf(err, "could not download published file %s", resource)
+	}
+	defer resp.Close()
+
+	store := proj.storage()
+	_, local := store.(FileStorage)
+	dlFile := localFile
+	if local {
+		dlFile = localFile + ".part"
+	}
+	destFile, err := store.Create(dlFile)
+	if err != nil {
+		return errors.Wrapf(err, "could not create local file %s", dlFile)
+	}
+
+	var dest io.Writer = destFile
+	if h != nil {
+		dest = io.MultiWriter(destFile, h)
+	}
+	_, err = io.Copy(dest, resp)
+	if closeErr := destFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "could not download published file %s", resource)
+	} else if h != nil {
+		if err = checkSum(h, *sum); err != nil {
+			err = errors.Wrapf(err, "metadata file %s", resource)
+		}
+	}
+	if err == nil && dlFile != localFile {
+		err = os.Rename(dlFile, localFile)
+	}
+	if err != nil && local {
+		os.Remove(dlFile)
+	}
+
+	return err
+}
+
+// RPMPackage is a package listed in the primary metadata of an RPM repository.
+type RPMPackage struct {
+	Name    string `xml:"name"`
+	Arch    string `xml:"arch"`
+	Version struct {
+		Epoch string `xml:"epoch,attr"`
+		Ver   string `xml:"ver,attr"`
+		Rel   string `xml:"rel,attr"`
+	} `xml:"version"`
+	Checksum RepoMDChecksum `xml:"checksum"`
+	Size     struct {
+		Package string `xml:"package,attr"`
+	} `xml:"size"`
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+}
+
+type xmlPrimary struct {
+	XMLName  xml.Name     `xml:"metadata"`
+	Packages []RPMPackage `xml:"package"`
+}
+
+// Returns the packages listed in the primary metadata published for the
+// repository repo. As for RepoMD, arch is usually left empty.
+func (proj *Project) Primary(repo, arch string) ([]RPMPackage, error) {
+	md, err := proj.RepoMD(repo, arch)
+	if err != nil {
+		return nil, err
+	}
+
+	d, ok := md.Find("primary")
+	if !ok {
+		return nil, errors.Errorf("no primary metadata in repo %s", repo)
+	}
+
+	data, err := proj.readRepoMDData(context.Background(), path.Join(repo, arch), d)
+	if err != nil {
+		return nil, err
+	}
+
+	var primary xmlPrimary
+	if err := xml.Unmarshal(data, &primary); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse primary metadata of repo %s", repo)
+	}
+
+	return primary.Packages, nil
+}
+
+// Downloads the metadata file d of the published repository at repoPath, and
+// returns its content, decompressed when gzip compressed. The checksum of the
+// downloaded file and, if listed, the one of the uncompressed content are
+// verified. The zstd and xz compressed files are not supported.
+func (proj *Project) readRepoMDData(ctx context.Context, repoPath string, d RepoMDData) ([]byte, error) {
+	resource := path.Join(repoPath, d.Location.Href)
+	if ext := path.Ext(d.Location.Href); ext == ".zst" || ext == ".xz" {
+		return nil, errors.Errorf("unsupported compression %s of metadata file %s", ext, resource)
+	}
+
+	data, err := proj.readURLPath(ctx, path.Join("/published", proj.Name, resource), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get metadata file %s", resource)
+	}
+
+	if err := verifyChecksum(data, d.Checksum); err != nil {
+		return nil, errors.Wrapf(err, "metadata file %s", resource)
+	}
+
+	if !strings.HasSuffix(d.Location.Href, ".gz") {
+		return data, nil
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decompress metadata file %s", resource)
+	}
+	defer gz.Close()
+
+	data, err = ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decompress metadata file %s", resource)
+	}
+
+	if d.OpenChecksum.Value != "" {
+		if err := verifyChecksum(data, d.OpenChecksum); err != nil {
+			return nil, errors.Wrapf(err, "uncompressed metadata file %s", resource)
+		}
+	}
+
+	return data, nil
+}
+
+// Checks that data matches the checksum sum.
+func verifyChecksum(data []byte, sum RepoMDChecksum) error {
+	h, err := newChecksumHash(sum.Type)
+	if err != nil {
+		return err
+	}
+
+	h.Write(data)
+	return checkSum(h, sum)
+}
+
+// Returns the hash computing the checksums of type sumType.
+func newChecksumHash(sumType string) (hash.Hash, error) {
+	switch sumType {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha", "sha1":
+		return sha1.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, errors.Errorf("unsupported checksum type %q", sumType)
+}
+
+// Checks that the data written to h matches the checksum sum.
+func checkSum(h hash.Hash, sum RepoMDChecksum) error {
+	if got := hex.EncodeToString(h.Sum(nil)); got != strings.TrimSpace(sum.Value) {
+		return errors.Errorf("%s checksum mismatch: got %s, expected %s", sum.Type, got, sum.Value)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package obsgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// repomd.xml as published by OBS for an RPM repository
+const repomdXML = `<?xml version="1.0" encoding="UTF-8"?>
+<repomd xmlns="http://linux.duke.edu/metadata/repo" xmlns:rpm="http://linux.duke.edu/metadata/rpm">
+  <revision>1557993534</revision>
+  <data type="primary">
+    <checksum type="sha256">5f3e1b2c</checksum>
+    <open-checksum type="sha256">9a8b7c6d</open-checksum>
+    <location href="repodata/5f3e1b2c-primary.xml.gz"/>
+    <timestamp>1557993534</timestamp>
+    <size>1234</size>
+    <open-size>5678</open-size>
+  </data>
+  <data type="filelists">
+    <checksum type="sha256">0a1b2c3d</checksum>
+    <location href="repodata/0a1b2c3d-filelists.xml.gz"/>
+  </data>
+  <data type="other">
+    <checksum type="sha256">4e5f6a7b</checksum>
+    <location href="repodata/4e5f6a7b-other.xml.gz"/>
+  </data>
+</repomd>`
+
+func TestRepoMD(t *testing.T) {
+	srv := mockServer(t, map[string]string{
+		"/published/proj/repo1/repodata/repomd.xml": repomdXML,
+	})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	md, err := proj.RepoMD("repo1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Revision != "1557993534" || len(md.Data) != 3 {
+		t.Fatalf("unexpected repomd %+v", md)
+	}
+
+	primary, ok := md.Find("primary")
+	if !ok {
+		t.Fatal("primary not found")
+	}
+	if primary.Checksum != (RepoMDChecksum{Type: "sha256", Value: "5f3e1b2c"}) ||
+		primary.OpenChecksum.Value != "9a8b7c6d" ||
+		primary.Location.Href != "repodata/5f3e1b2c-primary.xml.gz" ||
+		primary.Size != "1234" || primary.OpenSize != "5678" || primary.Timestamp != "1557993534" {
+		t.Fatalf("unexpected primary %+v", primary)
+	}
+	for _, dataType := range []string{"filelists", "other"} {
+		if d, ok := md.Find(dataType); !ok || d.Location.Href == "" {
+			t.Errorf("%s not found in %+v", dataType, md)
+		}
+	}
+	if _, ok := md.Find("updateinfo"); ok {
+		t.Error("found missing updateinfo")
+	}
+
+	if _, err := proj.RepoMD("missing", ""); err == nil {
+		t.Error("expected an error for a missing repository")
+	}
+}
+
+// Returns repomdXML with the checksums of the files "primary", "filelists"
+// and "other".
+func checkedRepoMDXML() string {
+	return strings.NewReplacer(
+		"5f3e1b2c</checksum>", sha256Hex("primary")+"</checksum>",
+		"0a1b2c3d</checksum>", sha256Hex("filelists")+"</checksum>",
+		"4e5f6a7b</checksum>", sha256Hex("other")+"</checksum>",
+	).Replace(repomdXML)
+}
+
+func TestDownloadMetadata(t *testing.T) {
+	srv, rec := recordingServer(t, map[string]string{
+		"/published/proj/rpm/repodata/repomd.xml":                checkedRepoMDXML(),
+		"/published/proj/rpm/repodata/5f3e1b2c-primary.xml.gz":   "primary",
+		"/published/proj/rpm/repodata/0a1b2c3d-filelists.xml.gz": "filelists",
+		"/published/proj/rpm/repodata/4e5f6a7b-other.xml.gz":     "other",
+		"/published/proj/rpm/x86_64/a-1.0-1.x86_64.rpm":          "AAAAA",
+		"/published/proj/deb/Packages":                           "Package: a",
+		"/published/proj/deb/amd64/a_1.0_amd64.deb":              "AAAAA",
+	})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	root := t.TempDir()
+	for _, repo := range []string{"rpm", "deb"} {
+		if err := proj.DownloadMetadata(repo, "", root); err != nil {
+			t.Fatalf("%s: %v", repo, err)
+		}
+	}
+	if err := proj.DownloadMetadata("none", "", root); err == nil {
+		t.Fatal("expected an error for a repository without metadata")
+	}
+
+	for name, want := range map[string]string{
+		"proj/rpm/repodata/repomd.xml":              checkedRepoMDXML(),
+		"proj/rpm/repodata/5f3e1b2c-primary.xml.gz": "primary",
+		"proj/rpm/repodata/4e5f6a7b-other.xml.gz":   "other",
+		"proj/deb/Packages":                         "Package: a",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(root, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v", name, data, err)
+		}
+	}
+	for _, p := range rec.paths() {
+		if strings.HasSuffix(p, ".rpm") || strings.HasSuffix(p, ".deb") {
+			t.Errorf("binary %s downloaded", p)
+		}
+	}
+}
+
+func TestDownloadMetadataChecksum(t *testing.T) {
+	srv := mockServer(t, map[string]string{
+		"/published/proj/rpm/repodata/repomd.xml":                checkedRepoMDXML(),
+		"/published/proj/rpm/repodata/5f3e1b2c-primary.xml.gz":   "corrupted",
+		"/published/proj/rpm/repodata/0a1b2c3d-filelists.xml.gz": "filelists",
+		"/published/proj/rpm/repodata/4e5f6a7b-other.xml.gz":     "other",
+	})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	// The corrupted file does not replace the previous one.
+	root := t.TempDir()
+	local := filepath.Join(root, "proj/rpm/repodata/5f3e1b2c-primary.xml.gz")
+	if err := os.MkdirAll(filepath.Dir(local), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(local, []byte("primary"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := proj.DownloadMetadata("rpm", "", root); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("got %v", err)
+	}
+	if data, err := ioutil.ReadFile(local); err != nil || string(data) != "primary" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if _, err := os.Stat(local + ".part"); !os.IsNotExist(err) {
+		t.Fatalf("partial file left: %v", err)
+	}
+	// Nor is repomd.xml, downloaded last, written.
+	if _, err := os.Stat(filepath.Join(root, "proj/rpm/repodata/repomd.xml")); !os.IsNotExist(err) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// Primary metadata of an RPM repository with a single package
+const primaryXML = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="1">
+  <package type="rpm">
+    <name>foo</name>
+    <arch>x86_64</arch>
+    <version epoch="0" ver="1.0" rel="2.1"/>
+    <checksum type="sha256" pkgid="YES">abc</checksum>
+    <size package="123"/>
+    <location href="x86_64/foo-1.0-2.1.x86_64.rpm"/>
+  </package>
+</metadata>`
+
+// Returns the routes of the published RPM repository "rpm", with primaryXML
+// gzip compressed, and the checksums listed in repomd.xml.
+func primaryRoutes(checksum, openChecksum string) map[string]string {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(primaryXML))
+	w.Close()
+
+	if checksum == "" {
+		checksum = sha256Hex(gz.String())
+	}
+	if openChecksum == "" {
+		openChecksum = sha256Hex(primaryXML)
+	}
+	return map[string]string{
+		"/published/proj/rpm/repodata/repomd.xml": fmt.Sprintf(`<repomd>
+  <data type="primary">
+    <checksum type="sha256">%s</checksum>
+    <open-checksum type="sha256">%s</open-checksum>
+    <location href="repodata/primary.xml.gz"/>
+  </data>
+</repomd>`, checksum, openChecksum),
+		"/published/proj/rpm/repodata/primary.xml.gz": gz.String(),
+	}
+}
+
+func TestPrimary(t *testing.T) {
+	srv := mockServer(t, primaryRoutes("", ""))
+	defer srv.Close()
+	proj := testProject(srv.URL)
+
+	pkgs, err := proj.Primary("rpm", "")
+	if err != nil || len(pkgs) != 1 {
+		t.Fatalf("got %+v, %v", pkgs, err)
+	}
+	pkg := pkgs[0]
+	if pkg.Name != "foo" || pkg.Arch != "x86_64" || pkg.Version.Ver != "1.0" || pkg.Version.Rel != "2.1" ||
+		pkg.Size.Package != "123" || pkg.Location.Href != "x86_64/foo-1.0-2.1.x86_64.rpm" {
+		t.Fatalf("unexpected package %+v", pkg)
+	}
+
+	// Both the compressed and the uncompressed checksums are verified.
+	bad := sha256Hex("other")
+	for _, routes := range []map[string]string{primaryRoutes(bad, ""), primaryRoutes("", bad)} {
+		srv := mockServer(t, routes)
+		if _, err := testProject(srv.URL).Primary("rpm", ""); err == nil {
+			t.Error("expected a checksum mismatch error")
+		}
+		srv.Close()
+	}
+
+	// The zstd and xz compressions are reported as such.
+	for _, ext := range []string{".zst", ".xz"} {
+		routes := primaryRoutes("", "")
+		routes["/published/proj/rpm/repodata/repomd.xml"] = strings.Replace(routes["/published/proj/rpm/repodata/repomd.xml"], "primary.xml.gz", "primary.xml"+ext, 1)
+		srv := mockServer(t, routes)
+		if _, err := testProject(srv.URL).Primary("rpm", ""); err == nil || !strings.Contains(err.Error(), "unsupported compression "+ext) {
+			t.Errorf("%s: got %v", ext, err)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,46 @@
+package obsgo
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Serializes the writes to the request logs of all projects
+var requestLogMutex sync.Mutex
+
+// Writes a line to the project RequestLog, if any.
+func (proj *Project) logRequest(method, url string, status int, bytes int64) {
+	if proj.RequestLog == nil {
+		return
+	}
+
+	requestLogMutex.Lock()
+	defer requestLogMutex.Unlock()
+	fmt.Fprintf(proj.RequestLog, "%s %s %d %d\n", method, url, status, bytes)
+}
+
+// loggedBody counts the bytes read from a response body, and logs the request
+// when the body is closed.
+type loggedBody struct {
+	io.ReadCloser
+	proj   *Project
+	method string
+	url    string
+	status int
+	bytes  int64
+	once   sync.Once
+}
+
+func (lb *loggedBody) Read(p []byte) (int, error) {
+	n, err := lb.ReadCloser.Read(p)
+	lb.bytes += int64(n)
+	return n, err
+}
+
+func (lb *loggedBody) Close() error {
+	lb.once.Do(func() {
+		lb.proj.logRequest(lb.method, lb.url, lb.status, lb.bytes)
+	})
+	return lb.ReadCloser.Close()
+}
@@ -0,0 +1,40 @@
+package obsgo
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequestLog(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	var buf bytes.Buffer
+	proj := testProject(srv.URL)
+	proj.RequestLog = &buf
+
+	if _, err := proj.FindAllPackages(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proj.GetPackage("repo1", "x86_64", "gone"); err == nil {
+		t.Fatal("expected an error for a missing package")
+	}
+
+	line := func(path string, status, bytes int) string {
+		return fmt.Sprintf("GET %s%s %d %d", srv.URL, path, status, bytes)
+	}
+	routes := basicRoutes()
+	want := []string{
+		line("/build/proj", 200, len(routes["/build/proj"])),
+		line("/build/proj/repo1", 200, len(routes["/build/proj/repo1"])),
+		line("/build/proj/repo1/x86_64", 200, len(routes["/build/proj/repo1/x86_64"])),
+		line("/build/proj/repo1/x86_64/pkga", 200, len(routes["/build/proj/repo1/x86_64/pkga"])),
+		line("/build/proj/repo1/x86_64/pkgb", 200, len(routes["/build/proj/repo1/x86_64/pkgb"])),
+		line("/build/proj/repo1/x86_64/gone", 404, 0),
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package obsgo
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Default delay before the first retry, doubled at every following attempt
+	defaultRetryDelay = time.Second
+	// Default maximum delay between two attempts of the exponential backoff
+	defaultMaxRetryDelay = time.Minute
+	// Default maximum delay honored from a Retry-After response header
+	defaultMaxRetryAfter = 2 * time.Minute
+	// Default delay between the start of concurrent workers
+	defaultWorkerStagger = 50 * time.Millisecond
+)
+
+// noRetry wraps an error that must not be retried.
+type noRetry struct {
+	err error
+}
+
+func (e noRetry) Error() string {
+	return e.err.Error()
+}
+
+func (e noRetry) Cause() error {
+	return e.err
+}
+
+// Calls op until it succeeds, up to retries more times after the first
+// attempt, sleeping with an exponential backoff between attempts.
+func (proj *Project) retry(ctx context.Context, retries int, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		if nr, ok := err.(noRetry); ok {
+			return nr.err
+		}
+		if attempt >= retries || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+
+		wait := proj.retryDelay(attempt)
+		if retryAfter := proj.retryAfter(err); retryAfter > 0 {
+			wait = retryAfter
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"attempt": attempt + 1,
+			"delay":   wait,
+			"error":   err,
+		}).Warn("OBS request failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Returns the backoff delay before the retry following the failed attempt,
+// starting from RetryDelay and doubled at every attempt up to MaxRetryDelay.
+func (proj *Project) retryDelay(attempt int) time.Duration {
+	delay := proj.RetryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	max := proj.MaxRetryDelay
+	if max <= 0 {
+		max = defaultMaxRetryDelay
+	}
+
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// Returns the delay requested by the server for the failed request, capped by
+// MaxRetryAfter, or zero if the server did not request any.
+func (proj *Project) retryAfter(err error) time.Duration {
+	httpErr, ok := errors.Cause(err).(*HTTPError)
+	if !ok || httpErr.RetryAfter <= 0 {
+		return 0
+	}
+
+	max := proj.MaxRetryAfter
+	if max <= 0 {
+		max = defaultMaxRetryAfter
+	}
+	if httpErr.RetryAfter > max {
+		return max
+	}
+	return httpErr.RetryAfter
+}
+
+// Parses the value of a Retry-After header, either in delta-seconds or in
+// HTTP-date form, into the delay to wait from now.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// Reports whether a failed request is worth retrying.
+func isRetryable(err error) bool {
+	err = errors.Cause(err)
+	if err == context.Canceled || err == context.DeadlineExceeded || err == ErrClosed {
+		return false
+	}
+	if httpErr, ok := err.(*HTTPError); ok {
+		switch httpErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return httpErr.StatusCode >= 500
+	}
+	return true
+}
+
+// Returns the error of ctx if it is done, which is likely the reason why an
+// operation failed with err, or err otherwise.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Returns how long the i-th of a group of concurrent workers waits before
+// starting, so that their first requests are spread over time instead of
+// bursting: each worker starts WorkerStagger after the previous one, plus up
+// to half WorkerStagger of random jitter. The first worker starts at once.
+func (proj *Project) staggerDelay(i int, jitter func(n int64) int64) time.Duration {
+	stagger := proj.WorkerStagger
+	if stagger == 0 {
+		stagger = defaultWorkerStagger
+	}
+	if i == 0 || stagger < 0 {
+		return 0
+	}
+
+	delay := time.Duration(i) * stagger
+	if half := int64(stagger / 2); half > 0 {
+		delay += time.Duration(jitter(half))
+	}
+	return delay
+}
+
+// Waits the stagger delay of the i-th concurrent worker, or until ctx is done.
+func (proj *Project) staggerStart(ctx context.Context, i int) {
+	delay := proj.staggerDelay(i, rand.Int63n)
+	if delay <= 0 {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	}
+}
@@ -0,0 +1,276 @@
+package obsgo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer answers like mockServer, but fails the requests to a path with
+// the status code set with fail, as many times as requested.
+type flakyServer struct {
+	*httptest.Server
+	mutex sync.Mutex
+	fails map[string]int
+	code  int
+}
+
+func newFlakyServer(t *testing.T, routes map[string]string) *flakyServer {
+	mock := mockHandler(routes)
+	s := &flakyServer{fails: make(map[string]int), code: http.StatusServiceUnavailable}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		fail := s.fails[r.URL.Path] > 0
+		if fail {
+			s.fails[r.URL.Path]--
+		}
+		code := s.code
+		s.mutex.Unlock()
+		if fail {
+			w.WriteHeader(code)
+			return
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Makes the next n requests to path fail.
+func (s *flakyServer) fail(path string, n int) {
+	s.mutex.Lock()
+	s.fails[path] = n
+	s.mutex.Unlock()
+}
+
+func TestMaxRetries(t *testing.T) {
+	srv := newFlakyServer(t, basicRoutes())
+	proj := testProject(srv.URL)
+	pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+	if err := proj.PackageBinaries(&pkg); err != nil {
+		t.Fatal(err)
+	}
+	const listing, file = "/build/proj", "/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm"
+
+	// Requests are not retried by default.
+	srv.fail(listing, 1)
+	if _, err := proj.ListRepos(); err == nil {
+		t.Fatal("expected an error")
+	} else if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %v", err)
+	}
+
+	// MaxRetries only applies to listings, not to downloads.
+	proj.MaxRetries = 1
+	srv.fail(listing, 1)
+	if repos, err := proj.ListRepos(); err != nil || len(repos) != 1 {
+		t.Fatalf("got %v, %v", repos, err)
+	}
+	var buf bytes.Buffer
+	srv.fail(file, 1)
+	if err := proj.DownloadBinaryTo(context.Background(), pkg, "a-1.0-1.x86_64.rpm", &buf); err == nil {
+		t.Fatal("expected a download error")
+	}
+
+	// DownloadMaxRetries only applies to downloads.
+	proj.MaxRetries, proj.DownloadMaxRetries = 0, 1
+	srv.fail(file, 1)
+	buf.Reset()
+	if err := proj.DownloadBinaryTo(context.Background(), pkg, "a-1.0-1.x86_64.rpm", &buf); err != nil || buf.String() != "AAAAA" {
+		t.Fatalf("got %q, %v", buf.String(), err)
+	}
+	srv.fail(listing, 1)
+	if _, err := proj.ListRepos(); err == nil {
+		t.Fatal("expected a listing error")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"2", 2 * time.Second},
+		{"-1", 0},
+		{now.Add(5 * time.Second).UTC().Format(http.TimeFormat), 5 * time.Second},
+		// A date in the past asks for no delay.
+		{now.Add(-5 * time.Second).UTC().Format(http.TimeFormat), 0},
+		{"soon", 0},
+	} {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Errorf("%q: got %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+// Returns a server answering the first request with the status code and
+// the Retry-After header, and the others with a directory listing.
+func retryAfterServer(t *testing.T, code int, retryAfter string) *httptest.Server {
+	var mutex sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests++
+		first := requests == 1
+		mutex.Unlock()
+		if first {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(code)
+			return
+		}
+		w.Write([]byte(dir("repo1")))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRetryAfter(t *testing.T) {
+	proj := testProject(retryAfterServer(t, http.StatusTooManyRequests, "2").URL)
+	proj.MaxRetries = 1
+	start := time.Now()
+	if _, err := proj.ListRepos(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Fatalf("retried after %v", elapsed)
+	}
+
+	// The delay requested is capped, rather than the default backoff used.
+	proj = testProject(retryAfterServer(t, http.StatusServiceUnavailable, "3600").URL)
+	proj.MaxRetries = 1
+	proj.MaxRetryAfter = 100 * time.Millisecond
+	start = time.Now()
+	if _, err := proj.ListRepos(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= defaultRetryDelay {
+		t.Fatalf("retried after %v", elapsed)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for _, tc := range []struct {
+		delay, max time.Duration
+		attempt    int
+		want       time.Duration
+	}{
+		{0, 0, 0, time.Second},
+		{0, 0, 3, 8 * time.Second},
+		{0, 0, 10, time.Minute},
+		{0, 0, 100, time.Minute},
+		{time.Millisecond, 0, 2, 4 * time.Millisecond},
+		{time.Millisecond, 5 * time.Millisecond, 2, 4 * time.Millisecond},
+		{time.Millisecond, 5 * time.Millisecond, 3, 5 * time.Millisecond},
+		{time.Second, 500 * time.Millisecond, 0, 500 * time.Millisecond},
+	} {
+		proj := &Project{RetryDelay: tc.delay, MaxRetryDelay: tc.max}
+		if got := proj.retryDelay(tc.attempt); got != tc.want {
+			t.Errorf("%v, %v, attempt %d: got %v", tc.delay, tc.max, tc.attempt, got)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&HTTPError{StatusCode: http.StatusRequestTimeout}, true},
+		{&HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{&HTTPError{StatusCode: http.StatusBadGateway}, true},
+		{&HTTPError{StatusCode: http.StatusNotFound}, false},
+		{&HTTPError{StatusCode: http.StatusUnauthorized}, false},
+		{context.Canceled, false},
+		{ErrClosed, false},
+		{io.ErrUnexpectedEOF, true},
+	} {
+		if got := isRetryable(tc.err); got != tc.want {
+			t.Errorf("%v: got %v", tc.err, got)
+		}
+	}
+}
+
+func TestStaggerDelay(t *testing.T) {
+	const stagger = 100 * time.Millisecond
+	for _, tc := range []struct {
+		name   string
+		jitter func(n int64) int64
+		extra  time.Duration
+	}{
+		{"no jitter", func(n int64) int64 { return 0 }, 0},
+		{"max jitter", func(n int64) int64 { return n - 1 }, stagger/2 - 1},
+	} {
+		proj := &Project{WorkerStagger: stagger}
+		for i := 0; i < 4; i++ {
+			want := time.Duration(i)*stagger + tc.extra
+			if i == 0 {
+				want = 0
+			}
+			if got := proj.staggerDelay(i, tc.jitter); got != want {
+				t.Errorf("%s, worker %d: got %v, want %v", tc.name, i, got, want)
+			}
+		}
+	}
+
+	// The jitter is drawn from half the stagger.
+	var drawn []int64
+	(&Project{}).staggerDelay(2, func(n int64) int64 {
+		drawn = append(drawn, n)
+		return 0
+	})
+	if len(drawn) != 1 || drawn[0] != int64(defaultWorkerStagger/2) {
+		t.Errorf("got jitter drawn from %v", drawn)
+	}
+	if d := (&Project{WorkerStagger: -1}).staggerDelay(3, rand.Int63n); d != 0 {
+		t.Errorf("got %v with stagger disabled", d)
+	}
+}
+
+func TestStaggerStart(t *testing.T) {
+	const stagger = 40 * time.Millisecond
+	data := make([]byte, 1<<20)
+	var mutex sync.Mutex
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		times = append(times, time.Now())
+		mutex.Unlock()
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	proj := testProject(srv.URL)
+	proj.DownloadConnections = 4
+	proj.WorkerStagger = stagger
+	dest, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dest.Close()
+	if _, err := proj.downloadRanges(context.Background(), "file", "", int64(len(data)), dest); err != nil {
+		t.Fatal(err)
+	}
+
+	// The connections are opened one stagger after the other, the jitter
+	// being less than a stagger.
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(times) != 4 {
+		t.Fatalf("got %d requests", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[0]); d < time.Duration(i)*stagger {
+			t.Errorf("request %d sent %v after the first", i, d)
+		}
+	}
+}
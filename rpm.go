@@ -0,0 +1,242 @@
+package obsgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	rpmLeadSize       = 96
+	rpmHeaderIntroLen = 16
+	rpmIndexEntryLen  = 16
+	// Limits of the header structures, as enforced by rpm, checked before
+	// allocating them
+	rpmMaxIndexEntries = 0xffff
+	rpmMaxHeaderSize   = 256 << 20
+	// Signature tags over the header only, used by rpm >= 4.0
+	rpmSigTagDSA = 267
+	rpmSigTagRSA = 268
+	// Signature tags over the header and the payload
+	rpmSigTagPGP = 1002
+	rpmSigTagGPG = 1005
+	// Header tags of the payload digest, covered by the header signatures
+	rpmTagPayloadDigest     = 5092
+	rpmTagPayloadDigestAlgo = 5093
+	rpmTypeInt32            = 4
+	rpmTypeStringArray      = 8
+)
+
+// Hash functions of the payload digests, by OpenPGP hash algorithm ID
+var rpmDigestAlgos = map[uint32]func() hash.Hash{
+	1:  md5.New,
+	2:  sha1.New,
+	8:  sha256.New,
+	9:  sha512.New384,
+	10: sha512.New,
+}
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// ErrBadSignature is returned by DownloadPackageFiles when the embedded
+// signature of a downloaded RPM file is missing or does not verify.
+var ErrBadSignature = errors.New("RPM signature verification failed")
+
+// RPMVerifier verifies the OpenPGP signature embedded in an RPM file. signed
+// is the signed content and signature is the binary OpenPGP signature packet,
+// e.g. as checked by openpgp.CheckDetachedSignature against the project key
+// returned by Project.PublicKey.
+type RPMVerifier func(signed io.Reader, signature []byte) error
+
+type rpmHeaderEntry struct {
+	Tag    uint32
+	Type   uint32
+	Offset uint32
+	Count  uint32
+}
+
+// Reads the intro of an RPM header structure, returning the number of index
+// entries and the size of the data store. Headers larger than rpm accepts are
+// rejected.
+func readRPMHeaderIntro(r io.Reader) ([]byte, uint32, uint32, error) {
+	intro := make([]byte, rpmHeaderIntroLen)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return nil, 0, 0, errors.Wrap(err, "could not read RPM header")
+	}
+	if !bytes.Equal(intro[:4], rpmHeaderMagic) {
+		return nil, 0, 0, errors.Errorf("invalid RPM header magic %x", intro[:4])
+	}
+	nindex, hsize := binary.BigEndian.Uint32(intro[8:12]), binary.BigEndian.Uint32(intro[12:16])
+	if nindex > rpmMaxIndexEntries || uint64(nindex)*rpmIndexEntryLen+uint64(hsize) > rpmMaxHeaderSize {
+		return nil, 0, 0, errors.Errorf("RPM header too large, %d entries and %d bytes", nindex, hsize)
+	}
+	return intro, nindex, hsize, nil
+}
+
+// Reads an RPM header structure, returning it whole.
+func readRPMHeader(r io.Reader) ([]byte, error) {
+	intro, nindex, hsize, err := readRPMHeaderIntro(r)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, rpmHeaderIntroLen+int(nindex)*rpmIndexEntryLen+int(hsize))
+	copy(header, intro)
+	if _, err := io.ReadFull(r, header[rpmHeaderIntroLen:]); err != nil {
+		return nil, errors.Wrap(err, "could not read RPM header")
+	}
+	return header, nil
+}
+
+// Returns the data of the entry with tag of the RPM header structure, from
+// its offset to the end of the data store, or nil when there is none.
+func rpmHeaderTag(header []byte, tag, typ uint32) []byte {
+	nindex := binary.BigEndian.Uint32(header[8:12])
+	store := header[rpmHeaderIntroLen+int(nindex)*rpmIndexEntryLen:]
+	for i := 0; i < int(nindex); i++ {
+		e := header[rpmHeaderIntroLen+i*rpmIndexEntryLen:]
+		if binary.BigEndian.Uint32(e[0:4]) != tag || binary.BigEndian.Uint32(e[4:8]) != typ {
+			continue
+		}
+		if offset := binary.BigEndian.Uint32(e[8:12]); uint64(offset) < uint64(len(store)) {
+			return store[offset:]
+		}
+	}
+	return nil
+}
+
+// Checks the payload read from r against the payload digest of the RPM
+// header. Returns false when the header has no payload digest, as in the
+// RPMs built before rpm 4.14.
+func checkRPMPayload(header []byte, r io.Reader) (bool, error) {
+	digest := rpmHeaderTag(header, rpmTagPayloadDigest, rpmTypeStringArray)
+	algo := rpmHeaderTag(header, rpmTagPayloadDigestAlgo, rpmTypeInt32)
+	if digest == nil || len(algo) < 4 {
+		return false, nil
+	}
+	if end := bytes.IndexByte(digest, 0); end >= 0 {
+		digest = digest[:end]
+	}
+	newHash, ok := rpmDigestAlgos[binary.BigEndian.Uint32(algo)]
+	if !ok {
+		return true, errors.Errorf("unsupported RPM payload digest algorithm %d", binary.BigEndian.Uint32(algo))
+	}
+
+	h := newHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return true, errors.Wrap(err, "could not read RPM payload")
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != strings.ToLower(string(digest)) {
+		return true, errors.Errorf("RPM payload digest mismatch, got %s, expected %s", sum, digest)
+	}
+	return true, nil
+}
+
+// Verifies the embedded signature of the RPM file read from r with verify.
+// Header-only signatures are preferred over header and payload ones, and the
+// payload is then checked against the digest in the signed header. Without
+// such a digest, the header and payload signature is required.
+func verifyRPM(r io.Reader, verify RPMVerifier) error {
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(r, lead); err != nil {
+		return errors.Wrap(err, "could not read RPM lead")
+	}
+	if !bytes.Equal(lead[:4], rpmLeadMagic) {
+		return errors.Errorf("invalid RPM lead magic %x", lead[:4])
+	}
+
+	_, nindex, hsize, err := readRPMHeaderIntro(r)
+	if err != nil {
+		return err
+	}
+	index := make([]rpmHeaderEntry, nindex)
+	if err := binary.Read(r, binary.BigEndian, index); err != nil {
+		return errors.Wrap(err, "could not read RPM signature index")
+	}
+	// The signature data store is padded to a multiple of 8 bytes.
+	store := make([]byte, (hsize+7)&^7)
+	if _, err := io.ReadFull(r, store); err != nil {
+		return errors.Wrap(err, "could not read RPM signature store")
+	}
+
+	sig := func(tag uint32) []byte {
+		for _, e := range index {
+			if e.Tag == tag && uint64(e.Offset)+uint64(e.Count) <= uint64(hsize) {
+				return store[e.Offset : e.Offset+e.Count]
+			}
+		}
+		return nil
+	}
+
+	for _, tag := range []uint32{rpmSigTagRSA, rpmSigTagDSA} {
+		if s := sig(tag); s != nil {
+			header, err := readRPMHeader(r)
+			if err != nil {
+				return err
+			}
+			if err := verify(bytes.NewReader(header), s); err != nil {
+				return err
+			}
+			if found, err := checkRPMPayload(header, r); found {
+				return err
+			}
+			for _, tag := range []uint32{rpmSigTagPGP, rpmSigTagGPG} {
+				if s := sig(tag); s != nil {
+					return verify(io.MultiReader(bytes.NewReader(header), r), s)
+				}
+			}
+			return errors.New("no signed payload digest in RPM file")
+		}
+	}
+	for _, tag := range []uint32{rpmSigTagPGP, rpmSigTagGPG} {
+		if s := sig(tag); s != nil {
+			return verify(r, s)
+		}
+	}
+
+	return errors.New("no signature found in RPM file")
+}
+
+// Verifies the embedded signature of the RPM localFile in store, with the
+// project RPMVerifier.
+func (proj *Project) verifyLocalRPM(store Storage, localFile string) error {
+	file, err := store.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := verifyRPM(file, proj.RPMVerifier); err != nil {
+		return errors.Wrapf(ErrBadSignature, "%s (%v)", localFile, err)
+	}
+	return nil
+}
+
+func isRPM(filename string) bool {
+	return strings.HasSuffix(filename, ".rpm")
+}
+
+// Returns the OpenPGP public key the OBS project binaries are signed with,
+// armored.
+func (proj *Project) PublicKey() ([]byte, error) {
+	resp, err := proj.sourceRequest(context.Background(), "_pubkey")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get public key of project %s", proj.Name)
+	}
+	defer resp.Close()
+
+	return ioutil.ReadAll(resp)
+}
@@ -0,0 +1,148 @@
+package obsgo
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+// Key the RPM fixtures are signed with
+var rpmTestKey = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+
+// Returns an RPM header structure with the index entries and the data store.
+func rpmHeader(entries []rpmHeaderEntry, store []byte) []byte {
+	var b bytes.Buffer
+	b.Write(rpmHeaderMagic)
+	b.Write([]byte{0, 0, 0, 0})
+	binary.Write(&b, binary.BigEndian, uint32(len(entries)))
+	binary.Write(&b, binary.BigEndian, uint32(len(store)))
+	binary.Write(&b, binary.BigEndian, entries)
+	b.Write(store)
+	return b.Bytes()
+}
+
+// Returns an RPM file whose signature header holds a signature with
+// rpmTestKey under each of tags, over the header and, for the header and
+// payload tags, over the payload too. When digest is set, the header holds
+// the SHA-256 digest of the payload. tamper selects the part modified after
+// signing, "header" or "payload".
+func signedRPM(tags []uint32, digest bool, tamper string) []byte {
+	payload := []byte("PAYLOAD")
+	entries := []rpmHeaderEntry{{Tag: 1000, Type: 6, Offset: 0, Count: 4}}
+	store := []byte("name\x00\x00\x00\x00")
+	if digest {
+		entries = append(entries,
+			rpmHeaderEntry{Tag: rpmTagPayloadDigest, Type: rpmTypeStringArray, Offset: 8, Count: 1},
+			rpmHeaderEntry{Tag: rpmTagPayloadDigestAlgo, Type: rpmTypeInt32, Offset: 76, Count: 1})
+		store = append(store, sha256Hex(string(payload))+"\x00\x00\x00\x00"...)
+		store = append(store, 0, 0, 0, 8)
+	}
+	header := rpmHeader(entries, store)
+
+	var sigEntries []rpmHeaderEntry
+	var sigStore []byte
+	for _, tag := range tags {
+		signed := header
+		if tag == rpmSigTagPGP || tag == rpmSigTagGPG {
+			signed = append(append([]byte(nil), header...), payload...)
+		}
+		sig := ed25519.Sign(rpmTestKey, signed)
+		sigEntries = append(sigEntries, rpmHeaderEntry{Tag: tag, Type: 7, Offset: uint32(len(sigStore)), Count: uint32(len(sig))})
+		sigStore = append(sigStore, sig...)
+	}
+	switch tamper {
+	case "header":
+		header[rpmHeaderIntroLen+len(entries)*rpmIndexEntryLen] = 'N'
+	case "payload":
+		payload[0] = 'p'
+	}
+
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	return bytes.Join([][]byte{lead, rpmHeader(sigEntries, sigStore), header, payload}, nil)
+}
+
+// Verifies the RPM signatures made with rpmTestKey.
+func testRPMVerifier(signed io.Reader, signature []byte) error {
+	data, err := ioutil.ReadAll(signed)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(rpmTestKey.Public().(ed25519.PublicKey), data, signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func TestVerifyRPM(t *testing.T) {
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	// An index larger than rpm accepts, rejected before allocating it.
+	huge := append(append([]byte(nil), lead...), rpmHeaderMagic...)
+	huge = append(huge, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0)
+
+	for _, tc := range []struct {
+		name string
+		rpm  []byte
+		ok   bool
+	}{
+		{"rsa", signedRPM([]uint32{rpmSigTagRSA}, true, ""), true},
+		{"dsa", signedRPM([]uint32{rpmSigTagDSA}, true, ""), true},
+		{"gpg", signedRPM([]uint32{rpmSigTagGPG}, false, ""), true},
+		{"tampered", signedRPM([]uint32{rpmSigTagRSA}, true, "header"), false},
+		{"tampered gpg", signedRPM([]uint32{rpmSigTagGPG}, false, "header"), false},
+		// The header signature does not cover the payload, checked against
+		// the signed digest.
+		{"tampered payload", signedRPM([]uint32{rpmSigTagRSA}, true, "payload"), false},
+		{"tampered gpg payload", signedRPM([]uint32{rpmSigTagGPG}, false, "payload"), false},
+		// Without a payload digest, the header and payload signature is
+		// checked.
+		{"rsa and gpg", signedRPM([]uint32{rpmSigTagRSA, rpmSigTagGPG}, false, ""), true},
+		{"tampered rsa and gpg payload", signedRPM([]uint32{rpmSigTagRSA, rpmSigTagGPG}, false, "payload"), false},
+		{"rsa without digest", signedRPM([]uint32{rpmSigTagRSA}, false, ""), false},
+		{"unsigned", signedRPM([]uint32{1004}, false, ""), false},
+		{"not an rpm", []byte("AAAAA"), false},
+		{"truncated", signedRPM([]uint32{rpmSigTagRSA}, true, "")[:rpmLeadSize+20], false},
+		{"huge index", huge, false},
+	} {
+		if err := verifyRPM(bytes.NewReader(tc.rpm), testRPMVerifier); (err == nil) != tc.ok {
+			t.Errorf("%s: got %v", tc.name, err)
+		}
+	}
+}
+
+func TestDownloadPackageFilesRPMVerifier(t *testing.T) {
+	good, bad := signedRPM([]uint32{rpmSigTagRSA}, true, ""), signedRPM([]uint32{rpmSigTagRSA}, true, "payload")
+	routes := basicRoutes()
+	routes["/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm"] = string(good)
+	routes["/build/proj/repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm"] = string(bad)
+	srv := mockServer(t, routes)
+	defer srv.Close()
+
+	proj := testProject(srv.URL)
+	proj.RPMVerifier = testRPMVerifier
+	proj.ContinueOnDownloadError = true
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.Files[0].Size = strconv.Itoa(len(good))
+	pkg.Files[1].Size = strconv.Itoa(len(bad))
+
+	files, _, err := proj.DownloadPackageFiles(pkg, t.TempDir())
+	multi, ok := err.(MultiError)
+	if !ok || len(multi) != 1 || !errors.Is(multi[0], ErrBadSignature) {
+		t.Fatalf("got %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %v", files)
+	}
+	if data, err := ioutil.ReadFile(files[0]); err != nil || !bytes.Equal(data, good) {
+		t.Fatalf("got %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,113 @@
+package obsgo
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DownloadStaged calls fn to download a whole mirror into a new staging
+// directory "<root>.mirror-<timestamp>", and when fn succeeds, atomically
+// points root to it. Root is a symlink to the current mirror directory,
+// replaced with a rename, so consumers of root never see a missing or
+// partially updated mirror, even if the process is killed. The previous
+// mirror directory is then removed. When fn fails, the staging directory is
+// removed and root is left untouched.
+//
+// The staging directory starts empty, so fn downloads the whole mirror again.
+// To only download the files that changed, fn can use a Project whose
+// ReferenceDir is root, so that the files of the previous mirror are hard
+// linked instead.
+//
+// Since the mirror is switched with a symlink, staging is only supported when
+// writing to the local filesystem, with the default FileStorage. Root must
+// not be a directory.
+func (proj *Project) DownloadStaged(root string, fn func(stagingRoot string) error) error {
+	if _, ok := proj.storage().(FileStorage); !ok {
+		return errors.New("Staged downloads require the local FileStorage")
+	}
+
+	var current string
+	if info, err := os.Lstat(root); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return errors.Errorf("Mirror root %s is not a symlink", root)
+		}
+		if current, err = os.Readlink(root); err != nil {
+			return errors.Wrapf(err, "Failed to read mirror symlink")
+		}
+		if !filepath.IsAbs(current) {
+			current = filepath.Join(filepath.Dir(root), current)
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Failed to read mirror symlink")
+	}
+
+	// Leftovers of interrupted runs can not be trusted.
+	removeStaleMirrors(root, current)
+
+	staging := root + ".mirror-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := os.MkdirAll(staging, 0700); err != nil {
+		return errors.Wrapf(err, "Failed to create staging directory")
+	}
+
+	if err := fn(staging); err != nil {
+		if rmErr := os.RemoveAll(staging); rmErr != nil {
+			logrus.WithFields(logrus.Fields{
+				"dir":   staging,
+				"error": rmErr,
+			}).Warn("Failed to remove staging directory")
+		}
+		return err
+	}
+
+	if err := switchMirror(staging, root); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+
+	if current != "" {
+		if err := os.RemoveAll(current); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"dir":   current,
+				"error": err,
+			}).Warn("Failed to remove previous mirror directory")
+		}
+	}
+	return nil
+}
+
+// Atomically replaces the symlink root with one pointing to the directory
+// dir, next to it.
+func switchMirror(dir, root string) error {
+	tmp := root + ".link"
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(dir), tmp); err != nil {
+		return errors.Wrapf(err, "Failed to create mirror symlink")
+	}
+	if err := os.Rename(tmp, root); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "Failed to switch mirror symlink")
+	}
+	return nil
+}
+
+// Removes the mirror directories of root left by interrupted runs, other than
+// the current one.
+func removeStaleMirrors(root, current string) {
+	stale, _ := filepath.Glob(root + ".mirror-*")
+	for _, dir := range stale {
+		if dir == current {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"dir":   dir,
+				"error": err,
+			}).Warn("Failed to remove stale staging directory")
+		}
+	}
+}
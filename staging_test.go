@@ -0,0 +1,95 @@
+package obsgo
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Returns the mirror directories next to root.
+func mirrorDirs(t *testing.T, root string) []string {
+	dirs, err := filepath.Glob(root + ".mirror-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dirs
+}
+
+func TestDownloadStaged(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(t.TempDir(), "mirror")
+	file := filepath.Join(root, "proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm")
+	download := func(staging string) error {
+		_, _, err := proj.DownloadPackageFiles(pkg, staging)
+		return err
+	}
+
+	// Each successful run switches root to a new mirror directory, and
+	// removes the previous one.
+	var previous string
+	for i := 0; i < 2; i++ {
+		if err := proj.DownloadStaged(root, download); err != nil {
+			t.Fatal(err)
+		}
+		current, err := os.Readlink(root)
+		if err != nil || current == previous {
+			t.Fatalf("run %d: got link to %s, %v", i, current, err)
+		}
+		if data, err := ioutil.ReadFile(file); err != nil || string(data) != "AAAAA" {
+			t.Fatalf("run %d: got %q, %v", i, data, err)
+		}
+		if dirs := mirrorDirs(t, root); len(dirs) != 1 || filepath.Base(dirs[0]) != current {
+			t.Fatalf("run %d: got mirror directories %v", i, dirs)
+		}
+		previous = current
+	}
+
+	// A stale directory of an interrupted run, and the staging directory of
+	// a failed one, are removed, and root is left untouched.
+	if err := os.Mkdir(root+".mirror-1", 0700); err != nil {
+		t.Fatal(err)
+	}
+	errFailed := errors.New("failed")
+	err = proj.DownloadStaged(root, func(staging string) error {
+		if err := download(staging); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if err != errFailed {
+		t.Fatalf("got %v", err)
+	}
+	if current, err := os.Readlink(root); err != nil || current != previous {
+		t.Fatalf("got link to %s, %v", current, err)
+	}
+	if dirs := mirrorDirs(t, root); len(dirs) != 1 || filepath.Base(dirs[0]) != previous {
+		t.Fatalf("got mirror directories %v", dirs)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadStagedDirectoryRoot(t *testing.T) {
+	proj := testProject("")
+	root := t.TempDir()
+	called := false
+	err := proj.DownloadStaged(root, func(string) error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Fatalf("got %v, called %v", err, called)
+	}
+	if dirs := mirrorDirs(t, root); len(dirs) != 0 {
+		t.Fatalf("got mirror directories %v", dirs)
+	}
+}
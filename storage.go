@@ -0,0 +1,48 @@
+package obsgo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Storage abstracts the destination where downloaded package files are
+// written, so that files can be stored somewhere other than the local disk.
+type Storage interface {
+	// Create returns a writer for the file at path, creating any missing
+	// parent directory and truncating an existing file.
+	Create(path string) (io.WriteCloser, error)
+	// Open returns a reader for the file at path.
+	Open(path string) (io.ReadCloser, error)
+	// Stat returns the information about the file at path. When the file
+	// does not exist the returned error must satisfy os.IsNotExist.
+	Stat(path string) (os.FileInfo, error)
+}
+
+// FileStorage is the default Storage, writing files on the local filesystem.
+type FileStorage struct{}
+
+// Create creates the local file at path, including its parent directories.
+func (FileStorage) Create(path string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// Open opens the local file at path for reading.
+func (FileStorage) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// Stat returns the os.FileInfo of the local file at path.
+func (FileStorage) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (proj *Project) storage() Storage {
+	if proj.Storage == nil {
+		return FileStorage{}
+	}
+	return proj.Storage
+}
@@ -0,0 +1,139 @@
+package obsgo
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStorage is a Storage keeping the files in memory.
+type memStorage struct {
+	mutex sync.Mutex
+	files map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{files: make(map[string][]byte)}
+}
+
+type memFile struct {
+	bytes.Buffer
+	storage *memStorage
+	path    string
+}
+
+func (f *memFile) Close() error {
+	f.storage.mutex.Lock()
+	f.storage.files[f.path] = f.Bytes()
+	f.storage.mutex.Unlock()
+	return nil
+}
+
+func (s *memStorage) Create(path string) (io.WriteCloser, error) {
+	s.mutex.Lock()
+	s.files[path] = nil
+	s.mutex.Unlock()
+	return &memFile{storage: s, path: path}, nil
+}
+
+func (s *memStorage) Open(path string) (io.ReadCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.files[path]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memStorage) Stat(path string) (os.FileInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.files[path]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+	return memFileInfo{name: filepath.Base(path), size: int64(len(data))}, nil
+}
+
+func (s *memStorage) file(path string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.files[path]
+	return data, ok
+}
+
+type memFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi memFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi memFileInfo) IsDir() bool        { return false }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+func TestFileStorage(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a", "b", "file")
+	var store FileStorage
+
+	if _, err := store.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected a not exist error, got %v", err)
+	}
+
+	w, err := store.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("data"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := store.Stat(path)
+	if err != nil || info.Size() != 4 {
+		t.Fatalf("got %v, %v", info, err)
+	}
+	r, err := store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := ioutil.ReadAll(r); string(data) != "data" {
+		t.Fatalf("got %q", data)
+	}
+}
+
+func TestDownloadPackageFilesStorage(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+	store := newMemStorage()
+	proj := testProject(srv.URL)
+	proj.Storage = store
+
+	pkg := PackageInfo{Repo: "repo1", Arch: "x86_64", Name: "pkga"}
+	if err := proj.PackageBinaries(&pkg); err != nil {
+		t.Fatal(err)
+	}
+	files, n, err := proj.DownloadPackageFiles(pkg, "/mirror")
+	if err != nil || len(files) != 2 || n != 8 {
+		t.Fatalf("got %v, %d bytes, %v", files, n, err)
+	}
+	data, ok := store.file("/mirror/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm")
+	if !ok || string(data) != "AAAAA" {
+		t.Fatalf("got %q, %v", data, ok)
+	}
+
+	// The files in the storage are not downloaded again.
+	if _, n, err := proj.DownloadPackageFiles(pkg, "/mirror"); err != nil || n != 0 {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+}
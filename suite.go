@@ -0,0 +1,30 @@
+package obsgo
+
+// Distribution suite names of the common OBS repository names
+var defaultRepoSuites = map[string]string{
+	"Debian_10":           "buster",
+	"Debian_11":           "bullseye",
+	"Debian_12":           "bookworm",
+	"Debian_13":           "trixie",
+	"Debian_Testing":      "testing",
+	"Debian_Unstable":     "unstable",
+	"xUbuntu_20.04":       "focal",
+	"xUbuntu_22.04":       "jammy",
+	"xUbuntu_24.04":       "noble",
+	"openSUSE_Tumbleweed": "tumbleweed",
+	"openSUSE_Factory":    "factory",
+}
+
+// Returns the distribution suite name of the OBS repository repo, e.g.
+// "bookworm" for "Debian_12", as mapped by RepoToSuite or else by the default
+// mapping. Unknown repositories are returned unchanged. It is the suite of
+// the dists directories and the suite pools of the Debian layouts.
+func (proj *Project) Suite(repo string) string {
+	if suite, ok := proj.RepoToSuite[repo]; ok {
+		return suite
+	}
+	if suite, ok := defaultRepoSuites[repo]; ok {
+		return suite
+	}
+	return repo
+}
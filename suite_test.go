@@ -0,0 +1,56 @@
+package obsgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSuite(t *testing.T) {
+	proj := &Project{Name: "proj", RepoToSuite: map[string]string{"Debian_12": "stable", "custom": "mine"}}
+	for _, tc := range []struct {
+		repo, want string
+	}{
+		// The configured mapping takes precedence over the defaults.
+		{"Debian_12", "stable"},
+		{"custom", "mine"},
+		{"Debian_11", "bullseye"},
+		{"xUbuntu_22.04", "jammy"},
+		{"openSUSE_Tumbleweed", "tumbleweed"},
+		{"other", "other"},
+	} {
+		if got := proj.Suite(tc.repo); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.repo, got, tc.want)
+		}
+	}
+}
+
+func TestRepoToSuiteDebianPool(t *testing.T) {
+	srv := mockServer(t, map[string]string{
+		"/build/proj/Debian_12/x86_64/foo":                   `<binarylist><binary filename="foo_1.0_amd64.deb" size="3" mtime="1"/></binarylist>`,
+		"/build/proj/Debian_12/x86_64/foo/foo_1.0_amd64.deb": "deb",
+	})
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	proj.Layout = LayoutDebianSuitePools
+	proj.RepoToSuite = map[string]string{"Debian_12": "stable"}
+	pkg, err := proj.GetPackage("Debian_12", "x86_64", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	if _, _, err := proj.DownloadPackageFiles(pkg, root); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(root, "proj/pool/stable/main/f/foo/foo_1.0_amd64.deb")); err != nil || string(data) != "deb" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(root, "proj/dists/stable/main/binary-amd64")); err != nil || !info.IsDir() {
+		t.Fatalf("dists directory missing, %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "proj/dists/bookworm")); !os.IsNotExist(err) {
+		t.Fatalf("got %v for the default suite", err)
+	}
+}
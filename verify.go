@@ -0,0 +1,146 @@
+package obsgo
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Reports whether localFile in store is a complete copy of the binary file f,
+// i.e. whether it exists with the expected size, or when f is decompressed,
+// whether it was written after f was built.
+func (proj *Project) isDownloaded(store Storage, localFile string, f PkgBinary) (bool, error) {
+	if dec, _ := proj.decompressor(f.Filename); dec != nil {
+		return isDecompressed(store, localFile, f)
+	}
+
+	info, err := store.Stat(localFile)
+	if !(err == nil || os.IsNotExist(err)) {
+		return false, err
+	}
+
+	if f.Size == "" && f.SizeK != "" {
+		// Only the size rounded up to KiB is known.
+		sizek, err := strconv.ParseInt(f.SizeK, 10, 64)
+		if err != nil {
+			return false, errors.Wrapf(err, "could not parse file size %s", localFile)
+		}
+		return info != nil && (info.Size()+1023)/1024 == sizek, nil
+	}
+
+	fsize, err := strconv.ParseInt(f.Size, 10, 64)
+	if err != nil {
+		return false, errors.Wrapf(err, "could not parse file size %s", localFile)
+	}
+
+	return info != nil && info.Size() == fsize, nil
+}
+
+// Checks whether localFile, not matching the binary file f, is larger than f,
+// e.g. when corrupted. It is then downloaded again after logging a warning,
+// unless StrictLocalSize is set, in which case ErrLocalFileTooLarge is
+// returned. Decompressed files and the files of unknown exact size are not
+// checked.
+func (proj *Project) checkLocalSize(store Storage, localFile string, f PkgBinary) error {
+	if dec, _ := proj.decompressor(f.Filename); dec != nil || f.Size == "" {
+		return nil
+	}
+	size, err := f.SizeBytes()
+	if err != nil {
+		return nil
+	}
+	info, err := store.Stat(localFile)
+	if err != nil || info.Size() <= size {
+		return nil
+	}
+
+	if proj.StrictLocalSize {
+		return errors.Wrapf(ErrLocalFileTooLarge, "%s is %d bytes, expected %d", localFile, info.Size(), size)
+	}
+	logrus.WithFields(logrus.Fields{
+		"filename": localFile,
+		"size":     info.Size(),
+		"expected": size,
+	}).Warn("Local OBS file larger than expected, downloading it again")
+	return nil
+}
+
+// Checks that all the files of the packages in pkgList have been downloaded
+// under root, as done by DownloadPackageFiles, and returns the list of the
+// local files that are missing or do not have the expected size. The files
+// listed in the SHA256SUMS file of their package, as written when Checksums is
+// set, must also match their checksum.
+func (proj *Project) VerifyLocal(pkgList []PackageInfo, root string) ([]string, error) {
+	store := proj.storage()
+
+	var bad []string
+	for _, pkgInfo := range pkgList {
+		pkgRoot, err := proj.archRoot(root, pkgInfo.Arch)
+		if err != nil {
+			return bad, err
+		}
+
+		sums, err := readChecksums(store, filepath.Join(pkgRoot, proj.Name, proj.localPkgPath(pkgInfo), checksumsFileName))
+		if err != nil {
+			return bad, err
+		}
+
+		for _, f := range pkgInfo.Files {
+			localFile := proj.localPath(pkgRoot, pkgInfo, f)
+
+			ok, err := proj.isDownloaded(store, localFile, f)
+			if err != nil {
+				return bad, errors.Wrapf(err, "could not verify local file %s", localFile)
+			}
+			if recorded := sums[filepath.Base(localFile)]; ok && recorded != "" {
+				sum, err := hashFile(store, localFile)
+				if err != nil {
+					return bad, errors.Wrapf(err, "could not compute checksum of %s", localFile)
+				}
+				ok = sum == recorded
+			}
+			if !ok {
+				logrus.WithFields(logrus.Fields{
+					"filename": localFile,
+				}).Debug("Local OBS file missing or corrupted")
+				bad = append(bad, localFile)
+			}
+		}
+	}
+
+	return bad, nil
+}
+
+// Looks for the binary file f of pkgInfo in ReferenceDir, and when found, hard
+// links it to localFile in store, if possible. Returns whether the file was
+// found and whether it was linked.
+func (proj *Project) linkReference(store Storage, pkgInfo PackageInfo, f PkgBinary, localFile string) (bool, bool, error) {
+	refFile := proj.localPath(proj.ReferenceDir, pkgInfo, f)
+	found, err := proj.isDownloaded(FileStorage{}, refFile, f)
+	if err != nil || !found {
+		return false, false, err
+	}
+
+	if _, ok := store.(FileStorage); !ok {
+		return true, false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(localFile), 0700); err != nil {
+		return true, false, errors.Wrapf(err, "could not create directory of %s", localFile)
+	}
+	os.Remove(localFile)
+	if err := os.Link(refFile, localFile); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"filename": refFile,
+			"error":    err,
+		}).Debug("Could not link OBS file from reference directory, skipping it")
+		return true, false, nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"filename": refFile,
+	}).Debug("OBS file linked from reference directory")
+	return true, true, nil
+}
@@ -0,0 +1,200 @@
+package obsgo
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestVerifyLocal(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	for _, checksums := range []bool{false, true} {
+		proj := testProject(srv.URL)
+		proj.Checksums = checksums
+		pkgs, err := proj.FindAllPackages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := t.TempDir()
+		for _, pkg := range pkgs {
+			if _, _, err := proj.DownloadPackageFiles(pkg, root); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if bad, err := proj.VerifyLocal(pkgs, root); err != nil || len(bad) != 0 {
+			t.Fatalf("Checksums %v: got %v, %v", checksums, bad, err)
+		}
+
+		// A missing file, a truncated one, and one corrupted with the same
+		// size, only detected with the recorded checksums.
+		pkgDir := filepath.Join(root, "proj/repo1/x86_64")
+		missing := filepath.Join(pkgDir, "pkgb/b-1.0-1.noarch.rpm")
+		truncated := filepath.Join(pkgDir, "pkga/a-debuginfo-1.0-1.x86_64.rpm")
+		corrupted := filepath.Join(pkgDir, "pkga/a-1.0-1.x86_64.rpm")
+		if err := os.Remove(missing); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(truncated, []byte("D"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(corrupted, []byte("XXXXX"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{truncated, missing}
+		if checksums {
+			want = []string{corrupted, truncated, missing}
+		}
+		if bad, err := proj.VerifyLocal(pkgs, root); err != nil || !reflect.DeepEqual(bad, want) {
+			t.Errorf("Checksums %v: got %v, %v", checksums, bad, err)
+		}
+	}
+}
+
+func TestReferenceDir(t *testing.T) {
+	srv, rec := recordingServer(t, basicRoutes())
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reference mirror has the first file, and a different version of
+	// the second one.
+	ref := t.TempDir()
+	refFile := proj.localPath(ref, pkg, pkg.Files[0])
+	if err := os.MkdirAll(filepath.Dir(refFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(refFile, []byte("AAAAA"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(proj.localPath(ref, pkg, pkg.Files[1]), []byte("DDDD"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	proj.ReferenceDir = ref
+	proj.Checksums = true
+	before := len(rec.paths())
+	files, n, err := proj.DownloadPackageFiles(pkg, t.TempDir())
+	if err != nil || n != 3 || len(files) != 2 {
+		t.Fatalf("got %v, %d bytes, %v", files, n, err)
+	}
+	if got := rec.paths()[before:]; !reflect.DeepEqual(got, []string{"/build/proj/repo1/x86_64/pkga/a-debuginfo-1.0-1.x86_64.rpm"}) {
+		t.Fatalf("got requests %v", got)
+	}
+
+	// The file found is hard linked, and its checksum recorded.
+	linked, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(refFile); err != nil || !os.SameFile(info, linked) {
+		t.Fatalf("%s not linked, %v", files[0], err)
+	}
+	sums, err := readChecksums(FileStorage{}, filepath.Join(filepath.Dir(files[0]), checksumsFileName))
+	if err != nil || sums["a-1.0-1.x86_64.rpm"] != sha256Hex("AAAAA") {
+		t.Fatalf("got %v, %v", sums, err)
+	}
+}
+
+func TestReferenceDirUpdated(t *testing.T) {
+	routes := basicRoutes()
+	srv := mockServer(t, routes)
+	defer srv.Close()
+	proj := testProject(srv.URL)
+	pkg, err := proj.GetPackage("repo1", "x86_64", "pkga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := t.TempDir()
+	refFile := proj.localPath(ref, pkg, pkg.Files[0])
+	if err := os.MkdirAll(filepath.Dir(refFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(refFile, []byte("AAAAA"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	proj.ReferenceDir = ref
+	root := t.TempDir()
+	files, _, err := proj.DownloadPackageFiles(pkg, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file linked from the reference mirror is rebuilt.
+	routes["/build/proj/repo1/x86_64/pkga"] = `<binarylist><binary filename="a-1.0-1.x86_64.rpm" size="6" mtime="300"/></binarylist>`
+	routes["/build/proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm"] = "BBBBBB"
+	srv = mockServer(t, routes)
+	defer srv.Close()
+	proj.BaseURL = srv.URL
+	if pkg, err = proj.GetPackage("repo1", "x86_64", "pkga"); err != nil {
+		t.Fatal(err)
+	}
+	if _, n, err := proj.DownloadPackageFiles(pkg, root); err != nil || n != 6 {
+		t.Fatalf("got %d bytes, %v", n, err)
+	}
+	if data, err := ioutil.ReadFile(files[0]); err != nil || string(data) != "BBBBBB" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if data, err := ioutil.ReadFile(refFile); err != nil || string(data) != "AAAAA" {
+		t.Fatalf("reference file rewritten, got %q, %v", data, err)
+	}
+}
+
+func TestStrictLocalSize(t *testing.T) {
+	srv := mockServer(t, basicRoutes())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		strict, resumable bool
+	}{
+		{false, false},
+		{false, true},
+		{true, false},
+		{true, true},
+	} {
+		hook := captureLogs(t)
+		root := t.TempDir()
+		local := filepath.Join(root, "proj/repo1/x86_64/pkga/a-1.0-1.x86_64.rpm")
+		if err := os.MkdirAll(filepath.Dir(local), 0700); err != nil {
+			t.Fatal(err)
+		}
+		const corrupted = "XXXXXXXXXXXX"
+		if err := ioutil.WriteFile(local, []byte(corrupted), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		proj := testProject(srv.URL)
+		proj.MirrorWorkers = 1
+		proj.StrictLocalSize = tc.strict
+		proj.ResumableMirror = tc.resumable
+		summary, err := proj.Mirror(root)
+		data, readErr := ioutil.ReadFile(local)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if tc.strict {
+			// The local file is left untouched.
+			if !errors.Is(err, ErrLocalFileTooLarge) || summary.Failed != 1 || string(data) != corrupted {
+				t.Errorf("strict, resumable %v: got %+v, %v, %q", tc.resumable, summary, err, data)
+			}
+			continue
+		}
+		if err != nil || summary.Downloaded != 3 || string(data) != "AAAAA" {
+			t.Errorf("resumable %v: got %+v, %v, %q", tc.resumable, summary, err, data)
+		}
+		if !logged(hook, "Local OBS file larger than expected, downloading it again", logrus.Fields{"filename": local, "size": int64(12), "expected": int64(5)}) {
+			t.Errorf("resumable %v: no warning logged", tc.resumable)
+		}
+	}
+}